@@ -0,0 +1,235 @@
+package blast
+
+import (
+	"io"
+	"math"
+
+	"github.com/TuftsBCB/io/search"
+	"github.com/TuftsBCB/seq"
+)
+
+// Iteration is the search of a single query. (psiblast searches the same
+// query several times, and each round is an iteration.)
+type Iteration struct {
+	// The program (e.g., "blastp"), its version and the database that was
+	// searched.
+	Program, Version, Database string
+
+	// The number of the iteration, starting at 1. For psiblast, this is the
+	// round of the search. Otherwise, it counts the queries.
+	Num int
+
+	// The identifier of the query (e.g., "Query_1"), its definition line
+	// and its length.
+	QueryID, QueryDef string
+	QueryLen          int
+
+	// The hits of the query, sorted by E-value.
+	Hits []Hit
+
+	// A message from BLAST (e.g., "No hits found"), if there is one.
+	Message string
+}
+
+// Hit is a sequence of the database that was hit by a query along with its
+// high-scoring segment pairs (HSPs), which are the local alignments of the
+// query and the sequence.
+type Hit struct {
+	Num int
+
+	// The identifier, definition line and accession of the sequence, and
+	// its length.
+	ID, Def, Accession string
+	Len                int
+
+	// The HSPs of the hit, sorted by E-value.
+	HSPs []HSP
+}
+
+// HSP is a high-scoring segment pair: a local alignment of the query and the
+// sequence of a hit.
+//
+// Residue numbers start at 1 and are inclusive. For nucleotide sequences,
+// the range of a sequence on the minus strand starts at the greater residue
+// number (i.e., HitFrom > HitTo).
+type HSP struct {
+	Num int
+
+	// The score in bits, the raw score and the E-value of the alignment.
+	BitScore float64
+	Score    int
+	EValue   float64
+
+	QueryFrom, QueryTo int
+	HitFrom, HitTo     int
+
+	// The reading frames of translated searches (e.g., blastx). They are
+	// zero for protein searches.
+	QueryFrame, HitFrame int
+
+	// The number of identical and positive columns, the number of gaps and
+	// the length of the alignment.
+	Identity, Positive, Gaps, AlignLen int
+
+	// The aligned query and hit sequences, and the midline between them,
+	// which shows identical residues and '+' for positive scores.
+	QSeq, HSeq, Midline []seq.Residue
+}
+
+// Reader reads the iterations of BLAST results one at a time.
+type Reader struct {
+	dec decoder
+}
+
+// decoder is implemented by the decoders of each format.
+type decoder interface {
+	next() (*Iteration, error)
+}
+
+// NewXMLReader creates a new Reader that is ready to read BLAST results in
+// the XML format ('-outfmt 5') from some io.Reader.
+func NewXMLReader(r io.Reader) *Reader {
+	return &Reader{newXMLDecoder(r)}
+}
+
+// NewJSONReader creates a new Reader that is ready to read BLAST results in
+// the single file JSON format ('-outfmt 15') from some io.Reader.
+func NewJSONReader(r io.Reader) *Reader {
+	return &Reader{newJSONDecoder(r)}
+}
+
+// Read reads the next iteration. When there are no more iterations, io.EOF
+// is returned.
+func (r *Reader) Read() (*Iteration, error) {
+	return r.dec.next()
+}
+
+// ReadAll reads all remaining iterations. If an error is encountered,
+// processing is stopped, and the error is returned.
+func (r *Reader) ReadAll() ([]*Iteration, error) {
+	its := make([]*Iteration, 0, 10)
+	for {
+		it, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		its = append(its, it)
+	}
+	return its, nil
+}
+
+// SearchHits returns the hits of an iteration as search hits.
+func (it *Iteration) SearchHits() []search.Hit {
+	hits := make([]search.Hit, len(it.Hits))
+	for i := range it.Hits {
+		hits[i] = it.Hits[i]
+	}
+	return hits
+}
+
+// The methods of Hit below satisfy the search.Hit interface. The scores and
+// ranges of a hit are those of its best HSP, which is the first one.
+
+// TargetName returns the identifier of the sequence that was hit.
+func (hit Hit) TargetName() string {
+	return hit.ID
+}
+
+// Expect returns the E-value of the best HSP, or +Inf if the hit has no HSP.
+func (hit Hit) Expect() float64 {
+	if len(hit.HSPs) == 0 {
+		return math.Inf(1)
+	}
+	return hit.HSPs[0].EValue
+}
+
+// BitScore returns the score in bits of the best HSP.
+func (hit Hit) BitScore() float64 {
+	if len(hit.HSPs) == 0 {
+		return 0
+	}
+	return hit.HSPs[0].BitScore
+}
+
+// Probability returns -1, since BLAST does not compute probabilities.
+func (hit Hit) Probability() float64 {
+	return -1
+}
+
+// QueryRange returns the range of the query in the best HSP.
+func (hit Hit) QueryRange() (start, end int) {
+	if len(hit.HSPs) == 0 {
+		return 0, 0
+	}
+	return ordered(hit.HSPs[0].QueryFrom, hit.HSPs[0].QueryTo)
+}
+
+// TargetRange returns the range of the hit's sequence in the best HSP. For
+// sequences on the minus strand, the start is HitTo.
+func (hit Hit) TargetRange() (start, end int) {
+	if len(hit.HSPs) == 0 {
+		return 0, 0
+	}
+	return ordered(hit.HSPs[0].HitFrom, hit.HSPs[0].HitTo)
+}
+
+// Alignment returns the aligned query and hit sequences of the best HSP.
+func (hit Hit) Alignment() (query, target []seq.Residue) {
+	if len(hit.HSPs) == 0 {
+		return nil, nil
+	}
+	return hit.HSPs[0].QSeq, hit.HSPs[0].HSeq
+}
+
+func ordered(from, to int) (int, int) {
+	if from > to {
+		return to, from
+	}
+	return from, to
+}
+
+// rawHSP is an HSP as it is encoded in both the XML and JSON formats.
+type rawHSP struct {
+	Num        int     `xml:"Hsp_num" json:"num"`
+	BitScore   float64 `xml:"Hsp_bit-score" json:"bit_score"`
+	Score      int     `xml:"Hsp_score" json:"score"`
+	EValue     float64 `xml:"Hsp_evalue" json:"evalue"`
+	QueryFrom  int     `xml:"Hsp_query-from" json:"query_from"`
+	QueryTo    int     `xml:"Hsp_query-to" json:"query_to"`
+	HitFrom    int     `xml:"Hsp_hit-from" json:"hit_from"`
+	HitTo      int     `xml:"Hsp_hit-to" json:"hit_to"`
+	QueryFrame int     `xml:"Hsp_query-frame" json:"query_frame"`
+	HitFrame   int     `xml:"Hsp_hit-frame" json:"hit_frame"`
+	Identity   int     `xml:"Hsp_identity" json:"identity"`
+	Positive   int     `xml:"Hsp_positive" json:"positive"`
+	Gaps       int     `xml:"Hsp_gaps" json:"gaps"`
+	AlignLen   int     `xml:"Hsp_align-len" json:"align_len"`
+	QSeq       string  `xml:"Hsp_qseq" json:"qseq"`
+	HSeq       string  `xml:"Hsp_hseq" json:"hseq"`
+	Midline    string  `xml:"Hsp_midline" json:"midline"`
+}
+
+func (raw rawHSP) hsp() HSP {
+	return HSP{
+		Num:        raw.Num,
+		BitScore:   raw.BitScore,
+		Score:      raw.Score,
+		EValue:     raw.EValue,
+		QueryFrom:  raw.QueryFrom,
+		QueryTo:    raw.QueryTo,
+		HitFrom:    raw.HitFrom,
+		HitTo:      raw.HitTo,
+		QueryFrame: raw.QueryFrame,
+		HitFrame:   raw.HitFrame,
+		Identity:   raw.Identity,
+		Positive:   raw.Positive,
+		Gaps:       raw.Gaps,
+		AlignLen:   raw.AlignLen,
+		QSeq:       []seq.Residue(raw.QSeq),
+		HSeq:       []seq.Residue(raw.HSeq),
+		Midline:    []seq.Residue(raw.Midline),
+	}
+}
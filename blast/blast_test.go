@@ -0,0 +1,194 @@
+package blast
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TuftsBCB/io/search"
+	"github.com/TuftsBCB/seq"
+)
+
+func ExampleReader() {
+	f, err := os.Open("cdk1.xml")
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer f.Close()
+
+	r := NewXMLReader(f)
+	for {
+		it, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		fmt.Printf("%s: %d hits\n", it.QueryID, len(it.Hits))
+		for _, hit := range it.Hits {
+			fmt.Println(hit.ID, hit.HSPs[0].EValue, len(hit.HSPs))
+		}
+	}
+	// Output:
+	// Query_1: 3 hits
+	// sp|P24941.2|CDK2_HUMAN 1.7e-27 1
+	// sp|Q00526.1|CDK3_HUMAN 2.3e-25 1
+	// sp|P43568.1|CAK1_YEAST 6.1e-05 2
+	// Query_2: 0 hits
+}
+
+func readFile(t *testing.T, fname string) []*Iteration {
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer f.Close()
+
+	var r *Reader
+	if strings.HasSuffix(fname, ".json") {
+		r = NewJSONReader(f)
+	} else {
+		r = NewXMLReader(f)
+	}
+	its, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("%s: %s", fname, err)
+	}
+	return its
+}
+
+func TestRead(t *testing.T) {
+	its := readFile(t, "cdk1.xml")
+	if len(its) != 2 {
+		t.Fatalf("Expected 2 iterations but got %d.", len(its))
+	}
+	it := its[0]
+	if it.Program != "blastp" || it.Database != "swissprot" ||
+		it.Num != 1 || it.QueryLen != 60 {
+		t.Fatalf("Unexpected iteration: %#v", it)
+	}
+	if its[1].Num != 2 || len(its[1].Hits) != 0 {
+		t.Fatalf("Unexpected iteration: %#v", its[1])
+	}
+
+	hit := it.Hits[2]
+	def := "RecName: Full=Cyclin-dependent kinase-activating kinase " +
+		"<CAK1> & more"
+	if hit.Accession != "P43568" || hit.Def != def || len(hit.HSPs) != 2 {
+		t.Fatalf("Unexpected hit: %#v", hit)
+	}
+	hsp := hit.HSPs[0]
+	if hsp.BitScore != 42.7 || hsp.EValue != 6.1e-05 ||
+		hsp.QueryFrom != 8 || hsp.QueryTo != 56 ||
+		hsp.HitFrom != 132 || hsp.HitTo != 178 || hsp.Gaps != 2 {
+		t.Fatalf("Unexpected HSP: %#v", hsp)
+	}
+	for _, s := range [][]byte{seqBytes(hsp.QSeq), seqBytes(hsp.Midline)} {
+		if len(s) != len(hsp.HSeq) || len(s) != hsp.AlignLen {
+			t.Fatalf("Expected aligned sequences of length %d but got "+
+				"'%s'.", hsp.AlignLen, s)
+		}
+	}
+	if string(seqBytes(hsp.HSeq[13:19])) != "AKDK--" {
+		t.Fatalf("Expected 'AKDK--' but got '%s'.",
+			seqBytes(hsp.HSeq[13:19]))
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	xml, json := readFile(t, "cdk1.xml"), readFile(t, "cdk1.json")
+	if !reflect.DeepEqual(xml, json) {
+		t.Fatalf("The XML and JSON results differ.")
+	}
+}
+
+func TestReadIterations(t *testing.T) {
+	psi := `{"BlastOutput2": [{"report": {
+		"program": "psiblast",
+		"search_target": {"db": "pdbaa"},
+		"results": {"iterations": [
+			{"iter_num": 1, "search": {
+				"query_id": "Query_1", "query_len": 10,
+				"hits": [{"num": 1,
+					"description": [{"id": "1abc_A"}, {"id": "2abc_A"}],
+					"len": 20,
+					"hsps": [{"num": 1, "evalue": 0.1, "query_from": 2,
+						"query_to": 9, "hit_from": 12, "hit_to": 19}]
+				}]
+			}},
+			{"iter_num": 2, "search": {
+				"query_id": "Query_1", "query_len": 10,
+				"message": "CONVERGED"
+			}}
+		]}
+	}}]}`
+	its, err := NewJSONReader(strings.NewReader(psi)).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(its) != 2 {
+		t.Fatalf("Expected 2 iterations but got %d.", len(its))
+	}
+	if its[0].Num != 1 || its[1].Num != 2 || its[1].Message != "CONVERGED" {
+		t.Fatalf("Unexpected iterations: %#v, %#v", its[0], its[1])
+	}
+	if its[0].Database != "pdbaa" || its[0].Hits[0].ID != "1abc_A" {
+		t.Fatalf("Unexpected iteration: %#v", its[0])
+	}
+}
+
+func TestReadEmpty(t *testing.T) {
+	for _, r := range []*Reader{
+		NewXMLReader(strings.NewReader("")),
+		NewJSONReader(strings.NewReader("")),
+	} {
+		if _, err := r.Read(); err != io.EOF {
+			t.Fatalf("Expected io.EOF but got '%v'.", err)
+		}
+	}
+	_, err := NewJSONReader(strings.NewReader(`{"BlastOutput2": {}}`)).Read()
+	if err == nil || err == io.EOF {
+		t.Fatalf("Expected an error but got '%v'.", err)
+	}
+}
+
+func TestSearchHit(t *testing.T) {
+	its := readFile(t, "cdk1.json")
+
+	var hit search.Hit = its[0].Hits[2]
+	if hit.TargetName() != "sp|P43568.1|CAK1_YEAST" ||
+		hit.Expect() != 6.1e-05 || hit.BitScore() != 42.7 {
+		t.Fatalf("Unexpected hit: %#v", hit)
+	}
+	if start, end := hit.QueryRange(); start != 8 || end != 56 {
+		t.Fatalf("Expected query range 8-56 but got %d-%d.", start, end)
+	}
+	if start, end := hit.TargetRange(); start != 132 || end != 178 {
+		t.Fatalf("Expected target range 132-178 but got %d-%d.", start, end)
+	}
+
+	// The ranges of sequences on the minus strand are reversed.
+	minus := Hit{HSPs: []HSP{{HitFrom: 90, HitTo: 1}}}
+	if start, end := minus.TargetRange(); start != 1 || end != 90 {
+		t.Fatalf("Expected target range 1-90 but got %d-%d.", start, end)
+	}
+
+	// Hits without HSPs are never significant.
+	if e := (Hit{}).Expect(); !math.IsInf(e, 1) {
+		t.Fatalf("Expected an E-value of +Inf but got %f.", e)
+	}
+}
+
+func seqBytes(rs []seq.Residue) []byte {
+	bs := make([]byte, len(rs))
+	for i, r := range rs {
+		bs[i] = byte(r)
+	}
+	return bs
+}
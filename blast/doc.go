@@ -0,0 +1,10 @@
+/*
+Package blast provides routines for reading the results of NCBI BLAST+
+searches (e.g., blastp, blastn or psiblast) in the XML format ('-outfmt 5')
+or the single file JSON format ('-outfmt 15').
+
+Results are read one iteration at a time, where an iteration is the search
+of a single query (or a single round of psiblast), so that the results of
+many queries need not be in memory at once.
+*/
+package blast
@@ -0,0 +1,173 @@
+package blast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonDecoder reads the reports in the "BlastOutput2" array of BLAST's JSON
+// output one at a time. Each report is the search of a single query, which
+// has several iterations for psiblast.
+type jsonDecoder struct {
+	dec     *json.Decoder
+	started bool
+
+	// The number of reports that have been read.
+	reports int
+
+	// The iterations of the last report that haven't been returned.
+	pending []*Iteration
+}
+
+func newJSONDecoder(r io.Reader) *jsonDecoder {
+	return &jsonDecoder{dec: json.NewDecoder(r)}
+}
+
+func (d *jsonDecoder) next() (*Iteration, error) {
+	for len(d.pending) == 0 {
+		if !d.started {
+			if err := d.start(); err != nil {
+				return nil, err
+			}
+			d.started = true
+		}
+		if !d.dec.More() {
+			return nil, io.EOF
+		}
+		var rep jsonReport
+		if err := d.dec.Decode(&rep); err != nil {
+			return nil, fmt.Errorf("Error reading BLAST JSON: %s", err)
+		}
+		d.reports++
+		d.pending = rep.iterations(d.reports)
+	}
+	it := d.pending[0]
+	d.pending = d.pending[1:]
+	return it, nil
+}
+
+// start skips to the first report in the "BlastOutput2" array. If the input
+// is empty, then io.EOF is returned.
+func (d *jsonDecoder) start() error {
+	tok, err := d.dec.Token()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading BLAST JSON: %s", err)
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("Expected a JSON object but got '%v'.", tok)
+	}
+	for d.dec.More() {
+		key, err := d.dec.Token()
+		if err != nil {
+			return fmt.Errorf("Error reading BLAST JSON: %s", err)
+		}
+		if key != "BlastOutput2" {
+			var skip json.RawMessage
+			if err := d.dec.Decode(&skip); err != nil {
+				return fmt.Errorf("Error reading BLAST JSON: %s", err)
+			}
+			continue
+		}
+		tok, err := d.dec.Token()
+		if err != nil {
+			return fmt.Errorf("Error reading BLAST JSON: %s", err)
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("Expected an array of reports in "+
+				"'BlastOutput2' but got '%v'.", tok)
+		}
+		return nil
+	}
+	return fmt.Errorf("Missing 'BlastOutput2' in BLAST JSON.")
+}
+
+type jsonReport struct {
+	Report struct {
+		Program      string `json:"program"`
+		Version      string `json:"version"`
+		SearchTarget struct {
+			DB string `json:"db"`
+		} `json:"search_target"`
+		Results struct {
+			Search     *jsonSearch `json:"search"`
+			Iterations []struct {
+				Num    int        `json:"iter_num"`
+				Search jsonSearch `json:"search"`
+			} `json:"iterations"`
+		} `json:"results"`
+	} `json:"report"`
+}
+
+type jsonSearch struct {
+	QueryID    string    `json:"query_id"`
+	QueryTitle string    `json:"query_title"`
+	QueryLen   int       `json:"query_len"`
+	Hits       []jsonHit `json:"hits"`
+	Message    string    `json:"message"`
+}
+
+type jsonHit struct {
+	Num         int `json:"num"`
+	Description []struct {
+		ID        string `json:"id"`
+		Accession string `json:"accession"`
+		Title     string `json:"title"`
+	} `json:"description"`
+	Len  int      `json:"len"`
+	HSPs []rawHSP `json:"hsps"`
+}
+
+// iterations returns the iterations of a report. A report without
+// iterations (i.e., not from psiblast) has one, which is numbered by the
+// position of the report in the output.
+func (rep jsonReport) iterations(position int) []*Iteration {
+	r := rep.Report
+	newIteration := func(num int, s jsonSearch) *Iteration {
+		it := &Iteration{
+			Program:  r.Program,
+			Version:  r.Version,
+			Database: r.SearchTarget.DB,
+			Num:      num,
+			QueryID:  s.QueryID,
+			QueryDef: s.QueryTitle,
+			QueryLen: s.QueryLen,
+			Hits:     make([]Hit, len(s.Hits)),
+			Message:  s.Message,
+		}
+		for i, jh := range s.Hits {
+			it.Hits[i] = jh.hit()
+		}
+		return it
+	}
+
+	if r.Results.Search != nil {
+		return []*Iteration{newIteration(position, *r.Results.Search)}
+	}
+	its := make([]*Iteration, len(r.Results.Iterations))
+	for i, ji := range r.Results.Iterations {
+		its[i] = newIteration(ji.Num, ji.Search)
+	}
+	return its
+}
+
+// hit converts a hit of a report. If a hit has several descriptions (i.e.,
+// identical sequences in the database), only the first is used.
+func (jh jsonHit) hit() Hit {
+	hit := Hit{
+		Num:  jh.Num,
+		Len:  jh.Len,
+		HSPs: make([]HSP, len(jh.HSPs)),
+	}
+	if len(jh.Description) > 0 {
+		desc := jh.Description[0]
+		hit.ID, hit.Def, hit.Accession = desc.ID, desc.Title, desc.Accession
+	}
+	for j, raw := range jh.HSPs {
+		hit.HSPs[j] = raw.hsp()
+	}
+	return hit
+}
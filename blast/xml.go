@@ -0,0 +1,103 @@
+package blast
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// xmlDecoder reads the Iteration elements of BLAST's XML output one at a
+// time. The program, version and database that precede them are kept for
+// every iteration.
+type xmlDecoder struct {
+	dec                        *xml.Decoder
+	program, version, database string
+}
+
+func newXMLDecoder(r io.Reader) *xmlDecoder {
+	return &xmlDecoder{dec: xml.NewDecoder(r)}
+}
+
+func (d *xmlDecoder) next() (*Iteration, error) {
+	for {
+		tok, err := d.dec.Token()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading BLAST XML: %s", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var v interface{}
+		switch start.Name.Local {
+		case "BlastOutput_program":
+			v = &d.program
+		case "BlastOutput_version":
+			v = &d.version
+		case "BlastOutput_db":
+			v = &d.database
+		case "Iteration":
+			var it xmlIteration
+			if err := d.dec.DecodeElement(&it, &start); err != nil {
+				return nil, fmt.Errorf("Error reading BLAST XML: %s", err)
+			}
+			return it.iteration(d), nil
+		default:
+			continue
+		}
+		if err := d.dec.DecodeElement(v, &start); err != nil {
+			return nil, fmt.Errorf("Error reading BLAST XML: %s", err)
+		}
+	}
+}
+
+type xmlIteration struct {
+	Num      int      `xml:"Iteration_iter-num"`
+	QueryID  string   `xml:"Iteration_query-ID"`
+	QueryDef string   `xml:"Iteration_query-def"`
+	QueryLen int      `xml:"Iteration_query-len"`
+	Hits     []xmlHit `xml:"Iteration_hits>Hit"`
+	Message  string   `xml:"Iteration_message"`
+}
+
+type xmlHit struct {
+	Num       int      `xml:"Hit_num"`
+	ID        string   `xml:"Hit_id"`
+	Def       string   `xml:"Hit_def"`
+	Accession string   `xml:"Hit_accession"`
+	Len       int      `xml:"Hit_len"`
+	HSPs      []rawHSP `xml:"Hit_hsps>Hsp"`
+}
+
+func (x xmlIteration) iteration(d *xmlDecoder) *Iteration {
+	it := &Iteration{
+		Program:  d.program,
+		Version:  d.version,
+		Database: d.database,
+		Num:      x.Num,
+		QueryID:  x.QueryID,
+		QueryDef: x.QueryDef,
+		QueryLen: x.QueryLen,
+		Hits:     make([]Hit, len(x.Hits)),
+		Message:  x.Message,
+	}
+	for i, xh := range x.Hits {
+		hit := Hit{
+			Num:       xh.Num,
+			ID:        xh.ID,
+			Def:       xh.Def,
+			Accession: xh.Accession,
+			Len:       xh.Len,
+			HSPs:      make([]HSP, len(xh.HSPs)),
+		}
+		for j, raw := range xh.HSPs {
+			hit.HSPs[j] = raw.hsp()
+		}
+		it.Hits[i] = hit
+	}
+	return it
+}
@@ -0,0 +1,16 @@
+/*
+Package ffindex reads and writes the ffindex databases used by HHsuite. (e.g.,
+"pdb70_hhm.ffdata" and "pdb70_hhm.ffindex".)
+
+An ffindex database is a pair of files. The data file is the concatenation of
+every entry, where each entry is terminated by a NUL byte. The index file has
+one line for every entry with its name, its byte offset in the data file and
+its length in bytes (including the NUL byte), separated by tabs. The lines of
+the index are sorted by name, so that entries can be found with a binary
+search.
+
+Entries can be read randomly by name with a DB, or in the order they appear
+in the data file with a Reader. Either way, the contents of each entry can be
+given to the reader of its format, e.g., hmm.ReadHHM, msa.Read or hhr.Read.
+*/
+package ffindex
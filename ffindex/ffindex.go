@@ -0,0 +1,254 @@
+package ffindex
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Entry corresponds to a single line in an ffindex file.
+type Entry struct {
+	Name string
+
+	// The byte offset of the entry in the data file and its length in
+	// bytes, including its terminating NUL byte.
+	Offset, Length int64
+}
+
+// ReadIndex reads all of the entries in an ffindex file, in the order that
+// they appear.
+func ReadIndex(r io.Reader) ([]Entry, error) {
+	entries := make([]Entry, 0, 100)
+	buf := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := buf.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := bytes.Split(line, []byte{'\t'})
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Error on line %d of ffindex: Expected "+
+				"3 tab separated fields but got %d.", lineNum, len(fields))
+		}
+		entry := Entry{Name: string(fields[0])}
+		entry.Offset, err = strconv.ParseInt(string(fields[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error on line %d of ffindex: Invalid "+
+				"offset: %s", lineNum, err)
+		}
+		entry.Length, err = strconv.ParseInt(string(fields[2]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error on line %d of ffindex: Invalid "+
+				"length: %s", lineNum, err)
+		}
+		if entry.Offset < 0 || entry.Length < 0 {
+			return nil, fmt.Errorf("Error on line %d of ffindex: Negative "+
+				"offset or length.", lineNum)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// WriteIndex writes entries as an ffindex file in the order given. (Use
+// SortIndex first to write an index that HHsuite can search.)
+func WriteIndex(w io.Writer, entries []Entry) error {
+	buf := bufio.NewWriter(w)
+	for _, entry := range entries {
+		_, err := fmt.Fprintf(buf, "%s\t%d\t%d\n",
+			entry.Name, entry.Offset, entry.Length)
+		if err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// SortIndex sorts entries by name in byte order, which is the order used by
+// ffindex_build.
+func SortIndex(entries []Entry) {
+	sort.Sort(byName(entries))
+}
+
+type byName []Entry
+
+func (es byName) Len() int           { return len(es) }
+func (es byName) Less(i, j int) bool { return es[i].Name < es[j].Name }
+func (es byName) Swap(i, j int)      { es[i], es[j] = es[j], es[i] }
+
+// DB provides random access to the entries of an ffindex database.
+type DB struct {
+	data io.ReaderAt
+
+	// The entries in the index, in the order that they appear.
+	Entries []Entry
+
+	names  map[string]int
+	closer io.Closer
+}
+
+// NewDB creates a database from an index and random access to its data file.
+// If more than one entry has the same name, the first one is used.
+func NewDB(index io.Reader, data io.ReaderAt) (*DB, error) {
+	entries, err := ReadIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		data:    data,
+		Entries: entries,
+		names:   make(map[string]int, len(entries)),
+	}
+	for i, entry := range entries {
+		if _, ok := db.names[entry.Name]; !ok {
+			db.names[entry.Name] = i
+		}
+	}
+	return db, nil
+}
+
+// Open opens the ffindex database with the given data and index files. The
+// database should be closed with Close when it is no longer needed.
+func Open(dataPath, indexPath string) (*DB, error) {
+	index, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	db, err := NewDB(index, data)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	db.closer = data
+	return db, nil
+}
+
+// Close closes the data file of a database opened with Open. It does nothing
+// for databases created with NewDB.
+func (db *DB) Close() error {
+	if db.closer == nil {
+		return nil
+	}
+	return db.closer.Close()
+}
+
+// Lookup returns the entry with the given name.
+func (db *DB) Lookup(name string) (Entry, bool) {
+	i, ok := db.names[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return db.Entries[i], true
+}
+
+// Reader returns a reader for the contents of the entry with the given name,
+// without its terminating NUL byte. e.g., hmm.ReadHHM(db.Reader("1abc_A")).
+func (db *DB) Reader(name string) (io.Reader, error) {
+	entry, ok := db.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("No entry named '%s' in ffindex.", name)
+	}
+	return db.EntryReader(entry), nil
+}
+
+// EntryReader returns a reader for the contents of an entry, without its
+// terminating NUL byte.
+func (db *DB) EntryReader(entry Entry) io.Reader {
+	return io.NewSectionReader(db.data, entry.Offset, contentLength(entry))
+}
+
+// Bytes returns the contents of the entry with the given name, without its
+// terminating NUL byte.
+func (db *DB) Bytes(name string) ([]byte, error) {
+	r, err := db.Reader(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// contentLength returns the length of an entry without its NUL byte.
+func contentLength(entry Entry) int64 {
+	if entry.Length == 0 {
+		return 0
+	}
+	return entry.Length - 1
+}
+
+// A Reader reads the entries of an ffindex database one at a time from the
+// start of its data file to the end, without seeking. This is faster than
+// random access when every entry is needed.
+type Reader struct {
+	data    *bufio.Reader
+	entries []Entry
+	next    int
+	offset  int64
+}
+
+// NewReader creates a Reader for an index and a data file. The entries are
+// read in the order of their offsets in the data file.
+func NewReader(index, data io.Reader) (*Reader, error) {
+	entries, err := ReadIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byOffset(entries))
+	return &Reader{data: bufio.NewReader(data), entries: entries}, nil
+}
+
+type byOffset []Entry
+
+func (es byOffset) Len() int           { return len(es) }
+func (es byOffset) Less(i, j int) bool { return es[i].Offset < es[j].Offset }
+func (es byOffset) Swap(i, j int)      { es[i], es[j] = es[j], es[i] }
+
+// Read returns the next entry and its contents, without its terminating NUL
+// byte. When there are no more entries, io.EOF is returned.
+func (r *Reader) Read() (Entry, []byte, error) {
+	if r.next >= len(r.entries) {
+		return Entry{}, nil, io.EOF
+	}
+	entry := r.entries[r.next]
+	if entry.Offset < r.offset {
+		return Entry{}, nil, fmt.Errorf("Entry '%s' at offset %d overlaps "+
+			"the previous entry.", entry.Name, entry.Offset)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r.data,
+		entry.Offset-r.offset); err != nil {
+		return Entry{}, nil, r.unexpectedEOF(entry, err)
+	}
+	contents := make([]byte, entry.Length)
+	if _, err := io.ReadFull(r.data, contents); err != nil {
+		return Entry{}, nil, r.unexpectedEOF(entry, err)
+	}
+	r.next++
+	r.offset = entry.Offset + entry.Length
+	return entry, contents[:contentLength(entry)], nil
+}
+
+func (r *Reader) unexpectedEOF(entry Entry, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("Data file ends before entry '%s' at offset %d.",
+			entry.Name, entry.Offset)
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package ffindex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/TuftsBCB/io/hhr"
+	"github.com/TuftsBCB/io/hmm"
+	"github.com/TuftsBCB/io/msa"
+)
+
+// testFiles are added to the test database under the given names. They are
+// deliberately out of order.
+var testFiles = []struct{ name, path string }{
+	{"yal001c_2-12", "../hmm/yal001c_2-12.hhm"},
+	{"yal001c_1-11", "../hmm/yal001c_1-11.hhm"},
+	{"yal001c_hhr", "../hhr/yal001c.hhr"},
+	{"a3m", ""},
+}
+
+const testA3M = ">query\nMVLTIYPDELV\n>s1\nMLFScTPYELV\n"
+
+// testDB builds a database in memory and returns its data and index.
+func testDB() (data, index []byte, err error) {
+	dataBuf, indexBuf := new(bytes.Buffer), new(bytes.Buffer)
+	w := NewWriter(dataBuf)
+	for _, f := range testFiles {
+		if len(f.path) == 0 {
+			err = w.AddReader(f.name, strings.NewReader(testA3M))
+		} else {
+			var contents []byte
+			if contents, err = ioutil.ReadFile(f.path); err != nil {
+				return nil, nil, err
+			}
+			err = w.Add(f.name, contents)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := w.WriteIndex(indexBuf); err != nil {
+		return nil, nil, err
+	}
+	return dataBuf.Bytes(), indexBuf.Bytes(), nil
+}
+
+func ExampleDB() {
+	data, index, err := testDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := NewDB(bytes.NewReader(index), bytes.NewReader(data))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, entry := range db.Entries {
+		fmt.Println(entry.Name)
+	}
+
+	r, err := db.Reader("yal001c_2-12")
+	if err != nil {
+		log.Fatal(err)
+	}
+	hhm, err := hmm.ReadHHM(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(hhm.HMM.Nodes))
+	// Output:
+	// a3m
+	// yal001c_1-11
+	// yal001c_2-12
+	// yal001c_hhr
+	// 11
+}
+
+func TestDB(t *testing.T) {
+	data, index, err := testDB()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	db, err := NewDB(bytes.NewReader(index), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	r, err := db.Reader("a3m")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	aligned, err := msa.Read(r)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(aligned.Entries) != 2 || aligned.Len() != 12 {
+		t.Fatalf("Unexpected MSA:\n%s", aligned)
+	}
+
+	r, err = db.Reader("yal001c_hhr")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	results, err := hhr.Read(r)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(results.Hits) == 0 {
+		t.Fatalf("Expected hits in the hhr entry.")
+	}
+
+	contents, err := db.Bytes("a3m")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if string(contents) != testA3M {
+		t.Fatalf("Expected '%s' but got '%s'.", testA3M, contents)
+	}
+	if _, err := db.Reader("missing"); err == nil {
+		t.Fatalf("Expected an error for a missing entry.")
+	}
+}
+
+func TestReader(t *testing.T) {
+	data, index, err := testDB()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	r, err := NewReader(bytes.NewReader(index), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	for i := 0; ; i++ {
+		entry, contents, err := r.Read()
+		if err == io.EOF {
+			if i != len(testFiles) {
+				t.Fatalf("Expected %d entries but got %d.", len(testFiles), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		// Entries are read in the order they were written.
+		if entry.Name != testFiles[i].name {
+			t.Fatalf("Expected entry '%s' but got '%s'.",
+				testFiles[i].name, entry.Name)
+		}
+		if bytes.IndexByte(contents, 0) >= 0 {
+			t.Fatalf("Entry '%s' contains a NUL byte.", entry.Name)
+		}
+	}
+
+	r, err = NewReader(bytes.NewReader(index), bytes.NewReader(data[:100]))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, _, err := r.Read(); err == nil || err == io.EOF {
+		t.Fatalf("Expected an error for a truncated data file.")
+	}
+}
+
+func TestReadIndex(t *testing.T) {
+	entries, err := ReadIndex(strings.NewReader("a\t0\t5\nb\t5\t10\n"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(entries) != 2 || entries[1] != (Entry{"b", 5, 10}) {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+
+	_, err = ReadIndex(strings.NewReader("a\t0\t5\nb\t5\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("Expected an error on line 2 but got: %v", err)
+	}
+}
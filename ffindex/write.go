@@ -0,0 +1,64 @@
+package ffindex
+
+import (
+	"io"
+)
+
+// A Writer builds an ffindex database. Entries are written to the data file
+// as they are added, and the index is written at the end with WriteIndex.
+type Writer struct {
+	data    io.Writer
+	offset  int64
+	entries []Entry
+}
+
+// NewWriter creates a new Writer that writes entries to the given data file.
+func NewWriter(data io.Writer) *Writer {
+	return &Writer{data: data}
+}
+
+// Add writes an entry with the given name and contents to the data file,
+// followed by a NUL byte.
+func (w *Writer) Add(name string, contents []byte) error {
+	n, err := w.data.Write(contents)
+	if err != nil {
+		return err
+	}
+	if _, err := w.data.Write([]byte{0}); err != nil {
+		return err
+	}
+	w.addEntry(name, int64(n))
+	return nil
+}
+
+// AddReader writes an entry with the given name whose contents are read from
+// r until EOF. (e.g., the output of hmm.WriteHHM.)
+func (w *Writer) AddReader(name string, r io.Reader) error {
+	n, err := io.Copy(w.data, r)
+	if err != nil {
+		return err
+	}
+	if _, err := w.data.Write([]byte{0}); err != nil {
+		return err
+	}
+	w.addEntry(name, n)
+	return nil
+}
+
+func (w *Writer) addEntry(name string, n int64) {
+	w.entries = append(w.entries, Entry{name, w.offset, n + 1})
+	w.offset += n + 1
+}
+
+// Entries returns the entries added so far, in the order they were added.
+func (w *Writer) Entries() []Entry {
+	return w.entries
+}
+
+// WriteIndex writes the index of every entry added so far, sorted by name.
+func (w *Writer) WriteIndex(index io.Writer) error {
+	entries := make([]Entry, len(w.entries))
+	copy(entries, w.entries)
+	SortIndex(entries)
+	return WriteIndex(index, entries)
+}
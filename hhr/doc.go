@@ -1,5 +1,5 @@
 /*
-Package hhr provides routines for reading (but not writing) hhr files, which
-are the output produced by hhsuite's hhsearch and hhblits programs.
+Package hhr provides routines for reading and writing hhr files, which are the
+output produced by hhsuite's hhsearch and hhblits programs.
 */
 package hhr
@@ -1,10 +1,8 @@
 package hhr
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"io"
 	"log"
 	"strconv"
 	"strings"
@@ -42,114 +40,133 @@ type Hit struct {
 	TemplateEnd     int
 	NumTemplateCols int
 	Aligned         Alignment
+
+	// The description of the template, which follows its name on the '>'
+	// line above its alignment. It is empty if there is none. Hits without
+	// an alignment only have the beginning of the description that is in
+	// the hit list. (HHsuite 3 puts it after the name.)
+	Description string
+
+	// The fraction of aligned columns with identical residues, the average
+	// substitution score per aligned column, the sum of the posterior
+	// probabilities of the aligned columns and the diversity of the template
+	// profile, as reported above the alignment. TemplateNeff is zero if it is
+	// not reported. (It was added in HHsuite 2.0.16.)
+	Identities, Similarity, SumProbs, TemplateNeff float64
+
+	// The probability, E-value and score above the alignment, which have
+	// more digits than Prob, EValue and ViterbiScore in the hit list. (e.g.,
+	// 42.14 instead of 42.1.) They are zero if the hit has no alignment.
+	AlignProb, AlignEValue, AlignScore float64
 }
 
 type Alignment struct {
 	QSeq, QConsensus, QDssp, QPred, QConf []seq.Residue
 	TSeq, TConsensus, TDssp, TPred, TConf []seq.Residue
+
+	// The match symbol of every column, which describes the similarity of
+	// the query and template profiles: '|' (very good), '+' (good), '.'
+	// (neutral), '-' (bad) and '=' (very bad). Columns without a symbol are
+	// spaces.
+	Match []seq.Residue
+
+	// The confidence of every column as a digit from 0 to 9, which is the
+	// posterior probability of the column in tenths. Columns without a
+	// confidence (e.g., gaps) are spaces. See Confidences.
+	Confidence []seq.Residue
+
+	// The blocks in which the alignment was written, in order.
+	Blocks []Block
 }
 
-func Read(r io.Reader) (*HHR, error) {
-	mode := 1 // 1 for meta, 2 for hits, 3 for alignments
-	bmeta := new(bytes.Buffer)
-	bhits := new(bytes.Buffer)
-	balign := new(bytes.Buffer)
-
-	buf := bufio.NewReader(r)
-	for {
-		line, err := buf.ReadBytes('\n')
-		if err == io.EOF && len(line) == 0 {
-			break
-		}
-		if err != nil && err != io.EOF {
-			return nil, fmt.Errorf("Error reading hhm: %s", err)
-		}
-		line = trim(line)
-
-		// Unfortunately, HHR files really aren't meant to be parsed. At all.
-		// They are totally human readable, so I expect this parser is pretty
-		// brittle.
-		// There are two portions that we care about in this file: the meta
-		// information and the hit list. (The rest we don't parse, which are
-		// alignments.) The meta information is always first. We don't
-		// transition into the second part (the hit list) until we see
-		// the header line starting with " No Hit". After that, a hit is on
-		// each subsequent line. Once an empty line is reached, the hit list
-		// is complete and we quit.
-		switch {
-		case mode == 1 && len(line) == 0: // skip empty lines in meta data
-			continue
-		case mode == 1 && hasPrefix(line, "No Hit"): // hit list begins
-			mode = 2
-			continue
-		case mode == 2 && len(line) == 0: // done with hit list, alignment time
-			mode = 3
-			continue
-		}
-		switch mode {
-		case 1: // meta data
-			_, err = bmeta.Write(append(line, '\n'))
-		case 2: // hit list
-			_, err = bhits.Write(append(line, '\n'))
-		case 3: // alignments
-			_, err = balign.Write(append(line, '\n'))
-		default:
-			panic(fmt.Sprintf("BUG: Unknown mode: %d", mode))
-		}
-		if err != nil {
-			return nil, fmt.Errorf("Error updating buffer for hhr: %s", err)
+// Block is a part of an alignment as it is written in an hhr file. Start and
+// End are the columns of the alignment in the block, such that QSeq[Start:End]
+// is its query sequence. The query and template ranges are the residue
+// numbers printed at the start and end of the block's sequence lines.
+type Block struct {
+	Start, End                 int
+	QueryStart, QueryEnd       int
+	TemplateStart, TemplateEnd int
+}
+
+// Confidences returns the confidence of every column of the alignment as an
+// integer from 0 to 9. Columns without a confidence are -1.
+func (a Alignment) Confidences() []int {
+	conf := make([]int, len(a.Confidence))
+	for i, r := range a.Confidence {
+		if r >= '0' && r <= '9' {
+			conf[i] = int(r - '0')
+		} else {
+			conf[i] = -1
 		}
 	}
+	return conf
+}
 
-	hhr, err := readMeta(bmeta)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading meta data from hhr: %s", err)
-	}
+// Names of the sections of an hhr file, as reported in a ParseError.
+const (
+	SectionHeader     = "header"
+	SectionHits       = "hit list"
+	SectionAlignments = "alignments"
+)
 
-	hhr.Hits, err = readHits(bhits)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading hit list from hhr: %s", err)
-	}
+// ParseError is returned when an hhr file is malformed. It records the
+// section of the file, the line number (counted from the start of the input)
+// and the text of the offending line.
+type ParseError struct {
+	Section string
+	Line    int
+	Text    string
+	Err     error
+}
 
-	if err = readAlignments(balign, hhr.Query, hhr.Hits); err != nil {
-		return nil, fmt.Errorf("Error reading alignments from hhr: %s", err)
-	}
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error on line %d in the %s of hhr: %s (line: '%s')",
+		e.Line, e.Section, e.Err, e.Text)
+}
 
-	return hhr, nil
+// hhrLine is a single line of an hhr file along with its line number.
+type hhrLine struct {
+	num  int
+	text []byte
 }
 
-func readMeta(buf *bytes.Buffer) (*HHR, error) {
-	hhr := &HHR{}
-	for {
-		line, err := buf.ReadBytes('\n')
-		if err == io.EOF && len(line) == 0 {
-			break
-		}
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		line = trim(line)
+func (l hhrLine) errorf(section, format string, v ...interface{}) error {
+	return &ParseError{
+		Section: section,
+		Line:    l.num,
+		Text:    string(l.text),
+		Err:     fmt.Errorf(format, v...),
+	}
+}
 
+func readMeta(lines []hhrLine) (*HHR, error) {
+	hhr := &HHR{}
+	for _, l := range lines {
+		var err error
+		line := trim(l.text)
 		switch {
 		case hasPrefix(line, "Query"):
 			hhr.Query = str(line[5:])
 		case hasPrefix(line, "Match_columns"):
 			hhr.MatchColumns, err = strconv.Atoi(str(line[13:]))
 			if err != nil {
-				return nil, err
+				return nil, l.errorf(SectionHeader,
+					"Invalid Match_columns: %s", err)
 			}
 		case hasPrefix(line, "No_of_seqs"):
 			hhr.NumSeqs = str(line[10:])
 		case hasPrefix(line, "Neff"):
 			f, err := strconv.ParseFloat(str(line[4:]), 64)
 			if err != nil {
-				return nil, err
+				return nil, l.errorf(SectionHeader, "Invalid Neff: %s", err)
 			}
 			hhr.Neff = seq.Prob(f)
 		case hasPrefix(line, "Searched_HMMs"):
 			hhr.SearchedHMMs, err = strconv.Atoi(str(line[13:]))
 			if err != nil {
-				return nil, err
+				return nil, l.errorf(SectionHeader,
+					"Invalid Searched_HMMs: %s", err)
 			}
 		case hasPrefix(line, "Date"):
 			hhr.Date = str(line[4:])
@@ -160,186 +177,315 @@ func readMeta(buf *bytes.Buffer) (*HHR, error) {
 	return hhr, nil
 }
 
-func readHits(buf *bytes.Buffer) (hits []Hit, err error) {
-	hits = make([]Hit, 0, 10)
-	for {
-		line, err := buf.ReadBytes('\n')
-		if err == io.EOF && len(line) == 0 {
-			break
-		}
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		line = trim(line)
-
-		if len(line) == 0 {
-			panic(fmt.Sprintf("BUG: Empty line in hit list."))
-		}
-		hit := Hit{}
-
-		// Grrrr. Variable length fields with fixed width fields without
-		// a delimiter.
-		numRest := bytes.SplitN(line, []byte{' '}, 2)
-
-		hit.Num, err = strconv.Atoi(str(numRest[0]))
-		if err != nil {
-			return nil, err
-		}
-
-		// Thankfully, the hit name is the only variable length field.
-		hit.Name = str(numRest[1][0:32])
-
-		// So now we can split the rest by whitespace.
-		// Except for when there isn't any whitespace to delimit columns!
-		// Oh my. *facepalm*
-		delim := func(r rune) bool {
-			return unicode.IsSpace(r) || r == '('
-		}
-		rest := bytes.FieldsFunc(numRest[1][32:], delim)
-
-		hit.Prob, err = readFloat(rest[0])
-		if err != nil {
-			return nil, err
-		}
-		hit.Prob /= 100.0
+// hitColumns are the positions of columns in the hit list, which are found
+// in its header. Values in the hit list are aligned with the header, except
+// that hit numbers with more than three digits shift the rest of the line to
+// the right.
+type hitColumns struct {
+	numEnd    int // the end of 'No', where hit numbers end
+	nameStart int // the start of 'Hit', where names begin
+	probEnd   int // the end of 'Prob', where probabilities end
+}
 
-		hit.EValue, err = readFloat(rest[1])
-		if err != nil {
-			return nil, err
-		}
+// probWidth is the width of a probability in the hit list. (e.g., '100.0')
+const probWidth = 5
+
+func readHitColumns(header hhrLine) (hitColumns, error) {
+	text := string(header.text)
+	no, hit, prob := strings.Index(text, "No"), strings.Index(text, "Hit"),
+		strings.Index(text, "Prob")
+	if no == -1 || hit == -1 || prob == -1 ||
+		no+len("No") > hit || hit+len("Hit") > prob-probWidth {
+		return hitColumns{}, header.errorf(SectionHits,
+			"Expected the columns 'No', 'Hit' and 'Prob' in the header "+
+				"of the hit list.")
+	}
+	return hitColumns{
+		numEnd:    no + len("No"),
+		nameStart: hit,
+		probEnd:   prob + len("Prob"),
+	}, nil
+}
 
-		hit.PValue, err = readFloat(rest[2])
+func readHits(header hhrLine, lines []hhrLine) ([]Hit, error) {
+	hits := make([]Hit, 0, len(lines))
+	if len(lines) == 0 {
+		return hits, nil
+	}
+	cols, err := readHitColumns(header)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		hit, err := readHit(cols, l)
 		if err != nil {
 			return nil, err
 		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
 
-		hit.ViterbiScore, err = readFloat(rest[3])
-		if err != nil {
-			return nil, err
-		}
+// readHit reads a single line of the hit list, e.g.,
+// '  1 1p4xA                           81.6   0.026 1.1E-05   42.1   0.0
+// 50  106-155    32-83  (250)'. The name column may also contain the
+// beginning of the template's description (as in HHsuite 3), which is
+// stored in Description until the complete description is read from the
+// alignment of the hit.
+func readHit(cols hitColumns, l hhrLine) (Hit, error) {
+	hit := Hit{}
+	line := string(l.text)
+	errorf := func(format string, v ...interface{}) (Hit, error) {
+		return Hit{}, l.errorf(SectionHits, format, v...)
+	}
 
-		hit.SSScore, err = readFloat(rest[4])
-		if err != nil {
-			return nil, err
-		}
+	// Everything before the name is the hit number. Since the number is
+	// right aligned, the number of extra digits is how far the rest of the
+	// line is shifted.
+	trimmed := strings.TrimLeft(line, " ")
+	numLen := strings.IndexByte(trimmed, ' ')
+	if numLen == -1 {
+		return errorf("Expected a hit number followed by a name.")
+	}
+	num := trimmed[:numLen]
+	shift := len(line) - len(trimmed) + numLen - cols.numEnd
+	if shift < 0 {
+		shift = 0
+	}
+	nameStart, nameEnd := cols.nameStart+shift, cols.probEnd-probWidth+shift
+	if len(line) < nameEnd {
+		return errorf("Expected a name ending at column %d.", nameEnd)
+	}
 
-		hit.NumAlignedCols, err = strconv.Atoi(str(rest[5]))
-		if err != nil {
-			return nil, err
-		}
+	var err error
+	if hit.Num, err = strconv.Atoi(num); err != nil {
+		return errorf("Invalid hit number '%s': %s", num, err)
+	}
+	name := strings.SplitN(strings.TrimSpace(line[nameStart:nameEnd]), " ", 2)
+	hit.Name = name[0]
+	if len(name) == 2 {
+		hit.Description = strings.TrimSpace(name[1])
+	}
 
-		// query/template range look like '{start}-{end}' where '{...}' is
-		// an integer.
-		queryRange := bytes.Split(rest[6], []byte{'-'})
-		templateRange := bytes.Split(rest[7], []byte{'-'})
+	// The rest of the columns are separated by whitespace, except for the
+	// template length, which may touch the template range.
+	// e.g., '1234-1270(1300)'.
+	rest := strings.FieldsFunc(line[nameEnd:], func(r rune) bool {
+		return unicode.IsSpace(r) || r == '('
+	})
+	if len(rest) != 9 {
+		return errorf("Expected 9 columns after the name but got %d.",
+			len(rest))
+	}
 
-		hit.QueryStart, err = strconv.Atoi(str(queryRange[0]))
-		if err != nil {
-			return nil, err
+	floats := []struct {
+		name string
+		dest *float64
+	}{
+		{"Prob", &hit.Prob},
+		{"E-value", &hit.EValue},
+		{"P-value", &hit.PValue},
+		{"Score", &hit.ViterbiScore},
+		{"SS", &hit.SSScore},
+	}
+	for i, f := range floats {
+		if *f.dest, err = strconv.ParseFloat(rest[i], 64); err != nil {
+			return errorf("Invalid %s '%s': %s", f.name, rest[i], err)
 		}
+	}
+	hit.Prob /= 100.0
 
-		hit.QueryEnd, err = strconv.Atoi(str(queryRange[1]))
-		if err != nil {
-			return nil, err
-		}
+	if hit.NumAlignedCols, err = strconv.Atoi(rest[5]); err != nil {
+		return errorf("Invalid Cols '%s': %s", rest[5], err)
+	}
 
-		hit.TemplateStart, err = strconv.Atoi(str(templateRange[0]))
-		if err != nil {
-			return nil, err
+	// query/template range look like '{start}-{end}' where '{...}' is
+	// an integer.
+	ranges := []struct {
+		name       string
+		start, end *int
+		text       string
+	}{
+		{"Query HMM", &hit.QueryStart, &hit.QueryEnd, rest[6]},
+		{"Template HMM", &hit.TemplateStart, &hit.TemplateEnd, rest[7]},
+	}
+	for _, r := range ranges {
+		bounds := strings.Split(r.text, "-")
+		if len(bounds) != 2 {
+			return errorf("Invalid %s range '%s'.", r.name, r.text)
 		}
-
-		hit.TemplateEnd, err = strconv.Atoi(str(templateRange[1]))
-		if err != nil {
-			return nil, err
+		if *r.start, err = strconv.Atoi(bounds[0]); err != nil {
+			return errorf("Invalid %s range '%s': %s", r.name, r.text, err)
 		}
-
-		numPart := rest[8][0 : len(rest[8])-1] // i.e., remove parens in '(52)'.
-		hit.NumTemplateCols, err = strconv.Atoi(str(numPart))
-		if err != nil {
-			return nil, err
+		if *r.end, err = strconv.Atoi(bounds[1]); err != nil {
+			return errorf("Invalid %s range '%s': %s", r.name, r.text, err)
 		}
+	}
 
-		hits = append(hits, hit)
+	tlen := strings.TrimSuffix(rest[8], ")") // i.e., remove parens in '(52)'.
+	if hit.NumTemplateCols, err = strconv.Atoi(tlen); err != nil {
+		return errorf("Invalid template length '%s': %s", rest[8], err)
 	}
-	return hits, nil
+	return hit, nil
 }
 
-func readAlignments(buf *bytes.Buffer, queryName string, hits []Hit) error {
-	hi := -1 // the current hit index
-	for {
-		line, err := buf.ReadBytes('\n')
-		if err == io.EOF && len(line) == 0 {
-			break
-		}
-		if err != nil && err != io.EOF {
-			return err
-		}
-		line = trim(line)
-		if len(line) == 0 {
+// readAlignment reads the alignment of a hit, which is every line after the
+// "No" line of the hit up to the "No" line of the next hit.
+func readAlignment(lines []hhrLine, queryName string, hit *Hit) error {
+	hit.Aligned = Alignment{
+		QSeq:  make([]seq.Residue, 0),
+		QDssp: make([]seq.Residue, 0),
+		QPred: make([]seq.Residue, 0),
+		QConf: make([]seq.Residue, 0),
+		TSeq:  make([]seq.Residue, 0),
+		TDssp: make([]seq.Residue, 0),
+		TPred: make([]seq.Residue, 0),
+		TConf: make([]seq.Residue, 0),
+	}
+	aligned := &hit.Aligned
+	offset := 0 // the position of the first column in the current block
+	for _, l := range lines {
+		line := l.text
+		if len(trim(line)) == 0 {
 			continue
 		}
+		errorf := func(format string, v ...interface{}) error {
+			return l.errorf(SectionAlignments, format, v...)
+		}
+		var err error
 
 		switch {
-		case hasPrefix(line, "No "):
-			hitno, err := strconv.Atoi(str(line[3:]))
-			if err != nil {
-				return err
-			}
-			hi = -1
-			for i := range hits {
-				if hits[i].Num == hitno {
-					hi = i
-					break
-				}
+		case hasPrefix(line, ">"):
+			fields := strings.SplitN(str(line[1:]), " ", 2)
+			if len(fields) == 2 {
+				hit.Description = strings.TrimSpace(fields[1])
 			}
-			if hi == -1 {
-				return fmt.Errorf("Invalid hit number: %d\n", hi)
-			}
-			hits[hi].Aligned = Alignment{
-				QSeq:  make([]seq.Residue, 0),
-				QDssp: make([]seq.Residue, 0),
-				QPred: make([]seq.Residue, 0),
-				QConf: make([]seq.Residue, 0),
-				TSeq:  make([]seq.Residue, 0),
-				TDssp: make([]seq.Residue, 0),
-				TPred: make([]seq.Residue, 0),
-				TConf: make([]seq.Residue, 0),
+		case hasPrefix(line, "Probab="):
+			if err := readScores(line, hit); err != nil {
+				return errorf("%s", err)
 			}
+		case hasPrefix(line, "Confidence"):
+			aligned.Confidence = append(aligned.Confidence,
+				blockColumns(line, offset, aligned)...)
+		case hasPrefix(line, " "): // match symbols
+			aligned.Match = append(aligned.Match,
+				blockColumns(line, offset, aligned)...)
+		case (hasPrefix(line, "Q") || hasPrefix(line, "T")) && len(line) < 19:
+			return errorf("Expected a name followed by a sequence.")
 		case hasPrefix(line, "Q"): // query part of alignment
 			rest := line[2:]
-			aligned := &hits[hi].Aligned
 			switch {
 			case strings.HasPrefix(queryName, str(rest[0:14])):
-				aligned.QSeq = append(aligned.QSeq, getSeq(rest)...)
+				rs, first, last, err := getNumberedSeq(rest)
+				if err != nil {
+					return errorf("%s", err)
+				}
+				offset = 2 + 15 + bytes.Index(rest[15:], seqBytes(rs))
+				aligned.Blocks = append(aligned.Blocks, Block{
+					Start:      len(aligned.QSeq),
+					End:        len(aligned.QSeq) + len(rs),
+					QueryStart: first,
+					QueryEnd:   last,
+				})
+				aligned.QSeq = append(aligned.QSeq, rs...)
 			case hasPrefix(rest, "Consensus"):
-				aligned.QConsensus = append(aligned.QConsensus, getSeq(rest)...)
+				err = appendSeq(&aligned.QConsensus, rest)
 			case hasPrefix(rest, "ss_dssp"):
-				aligned.QDssp = append(aligned.QDssp, getSeq(rest)...)
+				err = appendSeq(&aligned.QDssp, rest)
 			case hasPrefix(rest, "ss_pred"):
-				aligned.QPred = append(aligned.QPred, getSeq(rest)...)
+				err = appendSeq(&aligned.QPred, rest)
 			case hasPrefix(rest, "ss_conf"):
-				aligned.QConf = append(aligned.QConf, getSeq(rest)...)
+				err = appendSeq(&aligned.QConf, rest)
 			}
 		case hasPrefix(line, "T"): // template part of alignment
 			rest := line[2:]
-			aligned := &hits[hi].Aligned
 			switch {
-			case strings.HasPrefix(hits[hi].Name, str(rest[0:14])):
-				aligned.TSeq = append(aligned.TSeq, getSeq(rest)...)
+			case strings.HasPrefix(hit.Name, str(rest[0:14])):
+				rs, first, last, err := getNumberedSeq(rest)
+				if err != nil {
+					return errorf("%s", err)
+				}
+				if len(aligned.Blocks) > 0 {
+					block := &aligned.Blocks[len(aligned.Blocks)-1]
+					block.TemplateStart, block.TemplateEnd = first, last
+				}
+				aligned.TSeq = append(aligned.TSeq, rs...)
 			case hasPrefix(rest, "Consensus"):
-				aligned.TConsensus = append(aligned.TConsensus, getSeq(rest)...)
+				err = appendSeq(&aligned.TConsensus, rest)
 			case hasPrefix(rest, "ss_dssp"):
-				aligned.TDssp = append(aligned.TDssp, getSeq(rest)...)
+				err = appendSeq(&aligned.TDssp, rest)
 			case hasPrefix(rest, "ss_pred"):
-				aligned.TPred = append(aligned.TPred, getSeq(rest)...)
+				err = appendSeq(&aligned.TPred, rest)
 			case hasPrefix(rest, "ss_conf"):
-				aligned.TConf = append(aligned.TConf, getSeq(rest)...)
+				err = appendSeq(&aligned.TConf, rest)
 			}
 		}
+		if err != nil {
+			return errorf("%s", err)
+		}
+	}
+	return nil
+}
+
+// readScores reads the line of scores above an alignment, e.g.,
+// 'Probab=81.64  E-value=0.026  Score=42.14  Aligned_cols=50
+// Identities=12%  Similarity=0.107  Sum_probs=38.7'. The number of aligned
+// columns is already in the hit list, so it is ignored.
+func readScores(line []byte, hit *Hit) error {
+	for _, field := range strings.Fields(string(line)) {
+		keyval := strings.SplitN(field, "=", 2)
+		if len(keyval) != 2 {
+			continue
+		}
+		var dest *float64
+		switch keyval[0] {
+		case "Probab":
+			dest = &hit.AlignProb
+		case "E-value":
+			dest = &hit.AlignEValue
+		case "Score":
+			dest = &hit.AlignScore
+		case "Identities":
+			dest = &hit.Identities
+		case "Similarity":
+			dest = &hit.Similarity
+		case "Sum_probs":
+			dest = &hit.SumProbs
+		case "Template_Neff":
+			dest = &hit.TemplateNeff
+		default:
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSuffix(keyval[1], "%"), 64)
+		if err != nil {
+			return fmt.Errorf("Invalid %s '%s': %s", keyval[0], keyval[1], err)
+		}
+		*dest = f
 	}
+	hit.AlignProb /= 100.0
+	hit.Identities /= 100.0
 	return nil
 }
 
+// blockColumns returns the columns of a match or confidence line in the
+// current (i.e., last) block of an alignment. The columns start at the given
+// offset, which is the position of the query sequence of the block. Missing
+// columns are spaces.
+func blockColumns(line []byte, offset int, aligned *Alignment) []seq.Residue {
+	if len(aligned.Blocks) == 0 {
+		return nil
+	}
+	block := aligned.Blocks[len(aligned.Blocks)-1]
+	cols := make([]seq.Residue, block.End-block.Start)
+	for i := range cols {
+		cols[i] = ' '
+		if j := offset + i; j < len(line) {
+			cols[i] = seq.Residue(line[j])
+		}
+	}
+	return cols
+}
+
 func hasPrefix(bs []byte, prefix string) bool {
 	return bytes.HasPrefix(bs, []byte(prefix))
 }
@@ -348,27 +494,68 @@ func trim(bs []byte) []byte {
 	return bytes.TrimSpace(bs)
 }
 
-func getSeq(line []byte) []seq.Residue {
+// appendSeq appends the sequence of a line of an alignment to dst. See getSeq.
+func appendSeq(dst *[]seq.Residue, line []byte) error {
+	rs, err := getSeq(line)
+	if err != nil {
+		return err
+	}
+	*dst = append(*dst, rs...)
+	return nil
+}
+
+// getSeq returns the sequence of a line of an alignment, which follows its
+// name and, in numbered lines, the residue number at its start. An error is
+// returned if the line has no sequence.
+func getSeq(line []byte) ([]seq.Residue, error) {
 	fs := bytes.Fields(line[17:])
 	var fseq []byte
-	if len(fs) == 1 {
+	switch len(fs) {
+	case 0:
+		return nil, fmt.Errorf("Expected a sequence after the name.")
+	case 1:
 		fseq = fs[0]
-	} else {
+	default:
 		fseq = fs[1]
 	}
 	rs := make([]seq.Residue, len(fseq))
 	for i, r := range fseq {
 		rs[i] = seq.Residue(r)
 	}
-	return rs
+	return rs, nil
 }
 
-func readFloat(bs []byte) (float64, error) {
-	f, err := strconv.ParseFloat(str(bs), 64)
+// getNumberedSeq returns the sequence of a numbered line of an alignment
+// along with the residue numbers at its start and end. e.g., 'YAL001C
+// 106 IGNSAFELL  114 (240)'.
+func getNumberedSeq(line []byte) ([]seq.Residue, int, int, error) {
+	fs := bytes.Fields(line[15:])
+	if len(fs) < 3 {
+		return nil, 0, 0, fmt.Errorf("Expected a residue number, a "+
+			"sequence and a residue number in '%s'.", line)
+	}
+	first, err := strconv.Atoi(string(fs[0]))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	last, err := strconv.Atoi(string(fs[2]))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	rs, err := getSeq(line)
 	if err != nil {
-		return 0, err
+		return nil, 0, 0, err
+	}
+	return rs, first, last, nil
+}
+
+// seqBytes converts residues to bytes.
+func seqBytes(rs []seq.Residue) []byte {
+	bs := make([]byte, len(rs))
+	for i, r := range rs {
+		bs[i] = byte(r)
 	}
-	return f, nil
+	return bs
 }
 
 func str(bs []byte) string {
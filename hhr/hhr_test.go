@@ -1,10 +1,16 @@
 package hhr
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"reflect"
+	"strings"
+	"testing"
 )
 
 var (
@@ -61,6 +67,132 @@ func ExampleRead() {
 	// LNINEHHILWIAY--QLNGASISEIAKFGVMHVSTAFNFSKKLEERGYLRF
 }
 
+func TestWrite(t *testing.T) {
+	for _, fname := range testFiles {
+		original, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		hhr, err := Read(bytes.NewReader(original))
+		if err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+
+		written := new(bytes.Buffer)
+		if err := Write(written, hhr); err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+		again, err := Read(bytes.NewReader(written.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+		if !reflect.DeepEqual(hhr, again) {
+			t.Fatalf("%s: Reading the written hhr file did not reproduce "+
+				"the original.", fname)
+		}
+
+		// Every line is written exactly as HHsuite writes it.
+		expected := comparableLines(original)
+		got := comparableLines(written.Bytes())
+		if len(expected) != len(got) {
+			t.Fatalf("%s: Expected %d lines but got %d.",
+				fname, len(expected), len(got))
+		}
+		for i := range expected {
+			if expected[i] != got[i] {
+				t.Fatalf("%s: Expected line\n%s\nbut got\n%s",
+					fname, expected[i], got[i])
+			}
+		}
+	}
+}
+
+// comparableLines returns the lines of an hhr file without trailing spaces.
+func comparableLines(hhr []byte) []string {
+	lines := strings.Split(string(hhr), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return lines
+}
+
+// testFiles are hhr files in the formats of HHsuite 2 and 3, respectively.
+// yal001c.hhr was written by hhblits 2. hhsuite3.hhr is its first three hits
+// in the layout of hhblits 3 (i.e., with descriptions in the hit list and
+// Template_Neff above alignments) and written with '-aliw 40'. Only those
+// differences were edited in, so it is only as faithful as that layout.
+var testFiles = []string{"yal001c.hhr", "hhsuite3.hhr"}
+
+func readFile(t *testing.T, fname string) *HHR {
+	r, err := os.Open(fname)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer r.Close()
+	hhr, err := Read(r)
+	if err != nil {
+		t.Fatalf("%s: %s", fname, err)
+	}
+	return hhr
+}
+
+func TestWriteChangedScores(t *testing.T) {
+	hhr := readFile(t, "yal001c.hhr")
+	hhr.Hits = hhr.Hits[2:3]
+
+	// Scores above the alignment that disagree with the hit list are not
+	// written.
+	hhr.Hits[0].ViterbiScore = 40.0
+	buf := new(bytes.Buffer)
+	if err := Write(buf, hhr); err != nil {
+		t.Fatalf("%s", err)
+	}
+	scores := "Probab=75.01  E-value=0.059  Score=40.00  Aligned_cols=42"
+	if !strings.Contains(buf.String(), scores) {
+		t.Fatalf("Expected '%s' in\n%s", scores, buf.String())
+	}
+}
+
+func TestReadAlignment(t *testing.T) {
+	hhr := readFile(t, "yal001c.hhr")
+	hit := hhr.Hits[2]
+	if hit.Identities != 0.10 || hit.Similarity != 0.139 ||
+		hit.SumProbs != 30.5 || hit.TemplateNeff != 0 {
+		t.Fatalf("Unexpected scores: %v %v %v %v", hit.Identities,
+			hit.Similarity, hit.SumProbs, hit.TemplateNeff)
+	}
+	if hit.ViterbiScore != 33.0 || hit.AlignScore != 33.05 ||
+		math.Abs(hit.AlignProb-0.7501) > 1e-9 || hit.AlignEValue != 0.059 {
+		t.Fatalf("Unexpected scores above the alignment: %v %v %v",
+			hit.AlignProb, hit.AlignEValue, hit.AlignScore)
+	}
+	aligned := hit.Aligned
+	block := Block{
+		Start: 0, End: 49,
+		QueryStart: 192, QueryEnd: 240,
+		TemplateStart: 7, TemplateEnd: 48,
+	}
+	if len(aligned.Blocks) != 1 || aligned.Blocks[0] != block {
+		t.Fatalf("Expected blocks %v but got %v.", []Block{block},
+			aligned.Blocks)
+	}
+
+	match := "|.+.+++  ++..++.+|-++||++.     -++++.+..|++.|+|+|"
+	if string(seqBytes(aligned.Match)) != match {
+		t.Fatalf("Expected match symbols\n%s\nbut got\n%s",
+			match, string(seqBytes(aligned.Match)))
+	}
+	confidence := "4555655  35678889999999874     345677788888898764"
+	if string(seqBytes(aligned.Confidence)) != confidence {
+		t.Fatalf("Expected confidence\n%s\nbut got\n%s",
+			confidence, string(seqBytes(aligned.Confidence)))
+	}
+	conf := aligned.Confidences()
+	if conf[0] != 4 || conf[7] != -1 || conf[48] != 4 {
+		t.Fatalf("Unexpected confidence values: %v", conf)
+	}
+}
+
 func getFile() *os.File {
 	if len(flagReadFile) == 0 {
 		log.Fatalf("Please set the '--hhr path/to/file.hhr' flag.")
@@ -72,3 +204,173 @@ func getFile() *os.File {
 	}
 	return r
 }
+
+func TestReadHHsuite3(t *testing.T) {
+	hhr := readFile(t, "hhsuite3.hhr")
+	if !strings.HasPrefix(hhr.Query, "YAL001C TFC3") ||
+		hhr.MatchColumns != 240 || hhr.SearchedHMMs != 199 ||
+		len(hhr.Hits) != 3 {
+		t.Fatalf("Unexpected header: %#v", hhr)
+	}
+
+	// Names in the hit list are followed by the start of the description,
+	// which is replaced by the description above the alignment.
+	hit := hhr.Hits[0]
+	desc := "Staphylococcal accessory regulator A homolog S; winged " +
+		"helix, transcription regulator; 2.20A {Staphylococcus aureus}"
+	if hit.Name != "1p4xA" || hit.Description != desc {
+		t.Fatalf("Unexpected name '%s' and description '%s'.",
+			hit.Name, hit.Description)
+	}
+	if hit.Prob != 0.816 || hit.EValue != 0.026 || hit.TemplateNeff != 7.861 {
+		t.Fatalf("Unexpected scores: %v %v %v", hit.Prob, hit.EValue,
+			hit.TemplateNeff)
+	}
+
+	// The alignment was written in blocks of 40 columns. (-aliw 40)
+	blocks := []Block{
+		{Start: 0, End: 40, QueryStart: 106, QueryEnd: 145,
+			TemplateStart: 32, TemplateEnd: 71},
+		{Start: 40, End: 52, QueryStart: 146, QueryEnd: 155,
+			TemplateStart: 72, TemplateEnd: 83},
+	}
+	if !reflect.DeepEqual(hit.Aligned.Blocks, blocks) {
+		t.Fatalf("Expected blocks %v but got %v.", blocks,
+			hit.Aligned.Blocks)
+	}
+	if n := len(hit.Aligned.QSeq); len(hit.Aligned.Match) != n ||
+		len(hit.Aligned.Confidence) != n || len(hit.Aligned.TPred) != n {
+		t.Fatalf("Expected rows of length %d but got %d, %d and %d.", n,
+			len(hit.Aligned.Match), len(hit.Aligned.Confidence),
+			len(hit.Aligned.TPred))
+	}
+}
+
+func TestReadLargeNumbers(t *testing.T) {
+	original, err := ioutil.ReadFile("hhsuite3.hhr")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// HHsuite prints E-values of at least 100 in the hit list with "%7.1E",
+	// and template positions with "%4d-%-4d(%d)", so that positions with
+	// four digits run into the template length. Move the third hit as if
+	// its template was over 1000 residues long and it was found in a much
+	// larger database.
+	text := string(original)
+	for _, r := range []struct{ old, new string }{
+		{"  0.059 2.5E-05", "1.2E+02 2.5E-05"},
+		{"   7-48  (78)", "1207-1248(1278)"},
+		{"E-value=0.059", "E-value=1.2e+02"},
+		{"T Consensus         7 ", "T Consensus      1207 "},
+		{"T 1xn7A             7 ", "T 1xn7A          1207 "},
+		{"   48 (78)", " 1248 (1278)"},
+		{"   48 (78)", " 1248 (1278)"},
+	} {
+		if !strings.Contains(text, r.old) {
+			t.Fatalf("hhsuite3.hhr does not contain '%s'.", r.old)
+		}
+		text = strings.Replace(text, r.old, r.new, 1)
+	}
+
+	hhr, err := Read(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hit := hhr.Hits[2]
+	if hit.Name != "1xn7A" || hit.EValue != 120 ||
+		hit.TemplateStart != 1207 || hit.TemplateEnd != 1248 ||
+		hit.NumTemplateCols != 1278 {
+		t.Fatalf("Unexpected hit: %#v", hit)
+	}
+	block := hit.Aligned.Blocks[0]
+	if block.TemplateStart != 1207 || block.TemplateEnd != 1248 {
+		t.Fatalf("Unexpected block: %v", block)
+	}
+}
+
+func TestReadManyHits(t *testing.T) {
+	original, err := ioutil.ReadFile("yal001c.hhr")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// HHsuite prints hit numbers with "%3d" in the hit list and "No %-3d"
+	// above the alignments, so four digits shift the rest of the hit list.
+	// Renumber the hits as if they were the last hits of a search with over
+	// 999 hits.
+	const offset = 980
+	lines := strings.SplitAfter(string(original), "\n")
+	for i, line := range lines {
+		var num int
+		if i >= 9 && i < 37 {
+			if _, err := fmt.Sscanf(line[:3], "%d", &num); err != nil {
+				t.Fatalf("Line %d is not a hit: %s", i+1, err)
+			}
+			lines[i] = fmt.Sprintf("%3d", num+offset) + line[3:]
+		} else if strings.HasPrefix(line, "No ") {
+			if _, err := fmt.Sscanf(line, "No %d", &num); err != nil {
+				t.Fatalf("Line %d is not a hit: %s", i+1, err)
+			}
+			lines[i] = fmt.Sprintf("No %-3d\n", num+offset)
+		}
+	}
+	if !strings.HasPrefix(lines[36], "1008 2zcmA  ") {
+		t.Fatalf("Unexpected last hit: %s", lines[36])
+	}
+
+	expected := readFile(t, "yal001c.hhr")
+	hhr, err := Read(strings.NewReader(strings.Join(lines, "")))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hhr.Hits) != len(expected.Hits) {
+		t.Fatalf("Expected %d hits but got %d.",
+			len(expected.Hits), len(hhr.Hits))
+	}
+	for i, hit := range hhr.Hits {
+		hit.Num -= offset
+		if !reflect.DeepEqual(hit, expected.Hits[i]) {
+			t.Fatalf("Expected\n%#v\nbut got\n%#v", expected.Hits[i], hit)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	original, err := ioutil.ReadFile("yal001c.hhr")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	lines := strings.SplitAfter(string(original), "\n")
+
+	tests := []struct {
+		line    int
+		text    string
+		section string
+	}{
+		{2, "Match_columns two hundred forty\n", SectionHeader},
+		{10, "  1 1p4xA\n", SectionHits},
+		{11, strings.Replace(lines[10], "77.2", "77.2.2", 1), SectionHits},
+		{39, "No 99\n", SectionAlignments},
+		{41, strings.Replace(lines[40], "12%", "twelve%", 1),
+			SectionAlignments},
+		{43, "Q YAL001C\n", SectionAlignments},
+		{48, "T ss_dssp" + strings.Repeat(" ", 20) + "\n", SectionAlignments},
+		{44, "Q Consensus" + strings.Repeat(" ", 20) + "\n", SectionAlignments},
+	}
+	for _, test := range tests {
+		corrupt := make([]string, len(lines))
+		copy(corrupt, lines)
+		corrupt[test.line-1] = test.text
+
+		_, err := Read(strings.NewReader(strings.Join(corrupt, "")))
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("Line %d: Expected a *ParseError but got '%v'.",
+				test.line, err)
+		}
+		if perr.Line != test.line || perr.Section != test.section {
+			t.Fatalf("Line %d: Unexpected error: %s", test.line, perr)
+		}
+	}
+}
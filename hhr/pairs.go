@@ -0,0 +1,154 @@
+package hhr
+
+import (
+	"github.com/TuftsBCB/seq"
+)
+
+// ResiduePair is a pair of aligned residues in the alignment of a hit.
+// Column is the index of the pair in the alignment (i.e., in Aligned.QSeq
+// and Aligned.TSeq), while Query and Template are the residue numbers of the
+// pair in the query and template. Residue numbers start at 1, like the
+// ranges in the hit list.
+type ResiduePair struct {
+	Column                        int
+	Query, Template               int
+	QueryResidue, TemplateResidue seq.Residue
+}
+
+// EachPair calls f for every pair of aligned residues in the alignment of the
+// hit, in order. Columns with a gap in either the query or the template are
+// skipped, but they are still counted in residue numbers. Iteration stops
+// early when f returns false.
+//
+// Residue numbers are counted from QueryStart and TemplateStart.
+func (hit Hit) EachPair(f func(pair ResiduePair) bool) {
+	qseq, tseq := hit.Aligned.QSeq, hit.Aligned.TSeq
+	qi, ti := hit.QueryStart, hit.TemplateStart
+	for col := 0; col < len(qseq) && col < len(tseq); col++ {
+		qgap, tgap := isGap(qseq[col]), isGap(tseq[col])
+		if !qgap && !tgap {
+			pair := ResiduePair{
+				Column:          col,
+				Query:           qi,
+				Template:        ti,
+				QueryResidue:    qseq[col],
+				TemplateResidue: tseq[col],
+			}
+			if !f(pair) {
+				return
+			}
+		}
+		if !qgap {
+			qi++
+		}
+		if !tgap {
+			ti++
+		}
+	}
+}
+
+// Pairs returns every pair of aligned residues in the alignment of the hit.
+// See EachPair.
+func (hit Hit) Pairs() []ResiduePair {
+	pairs := make([]ResiduePair, 0, hit.NumAlignedCols)
+	hit.EachPair(func(pair ResiduePair) bool {
+		pairs = append(pairs, pair)
+		return true
+	})
+	return pairs
+}
+
+// QueryToTemplate maps the residue number of every query residue that is
+// aligned with a template residue to the residue number of that template
+// residue.
+func (hit Hit) QueryToTemplate() map[int]int {
+	m := make(map[int]int, hit.NumAlignedCols)
+	hit.EachPair(func(pair ResiduePair) bool {
+		m[pair.Query] = pair.Template
+		return true
+	})
+	return m
+}
+
+// TemplateToQuery maps the residue number of every template residue that is
+// aligned with a query residue to the residue number of that query residue.
+func (hit Hit) TemplateToQuery() map[int]int {
+	m := make(map[int]int, hit.NumAlignedCols)
+	hit.EachPair(func(pair ResiduePair) bool {
+		m[pair.Template] = pair.Query
+		return true
+	})
+	return m
+}
+
+// MSA returns the alignment of the hit as a multiple sequence alignment with
+// two rows: the query (with the given name) and the template. Only the
+// aligned ranges of the query and template are included.
+//
+// The query defines the match columns. Template residues aligned with a gap
+// in the query are insertions, so the template row in A3M format (see A3M)
+// can be added to an alignment of the query, as hhblits does.
+//
+// If the hit has no alignment, then the MSA has no rows.
+func (hit Hit) MSA(query string) seq.MSA {
+	qseq, tseq := hit.Aligned.QSeq, hit.Aligned.TSeq
+	var qrow, trow []seq.Residue
+	for col := 0; col < len(qseq) && col < len(tseq); col++ {
+		q, t := qseq[col], tseq[col]
+		switch {
+		case isGap(q) && isGap(t):
+			continue
+		case isGap(q):
+			qrow, trow = append(qrow, '-'), append(trow, lower(t))
+		case isGap(t):
+			qrow, trow = append(qrow, upper(q)), append(trow, '-')
+		default:
+			qrow, trow = append(qrow, upper(q)), append(trow, upper(t))
+		}
+	}
+
+	msa := seq.NewMSA()
+	msa.AddFasta(seq.Sequence{Name: query, Residues: qrow})
+	msa.AddFasta(seq.Sequence{Name: hit.templateName(), Residues: trow})
+	return msa
+}
+
+// A3M returns the template's row of the hit's alignment in A3M format, where
+// the match columns are the aligned range of the query. See MSA.
+//
+// If the hit has no alignment, then the row has the template's name but no
+// residues.
+func (hit Hit) A3M() seq.Sequence {
+	msa := hit.MSA("")
+	if len(msa.Entries) < 2 {
+		return seq.Sequence{Name: hit.templateName()}
+	}
+	return msa.GetA3M(1)
+}
+
+// templateName returns the name of the template followed by its description,
+// if it has one.
+func (hit Hit) templateName() string {
+	if len(hit.Description) == 0 {
+		return hit.Name
+	}
+	return hit.Name + " " + hit.Description
+}
+
+func isGap(r seq.Residue) bool {
+	return r == '-' || r == '.'
+}
+
+func upper(r seq.Residue) seq.Residue {
+	if r >= 'a' && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
+
+func lower(r seq.Residue) seq.Residue {
+	if r >= 'A' && r <= 'Z' {
+		return r - 'A' + 'a'
+	}
+	return r
+}
@@ -0,0 +1,97 @@
+package hhr
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"testing"
+)
+
+func ExampleHit_Pairs() {
+	r, err := os.Open("yal001c.hhr")
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer r.Close()
+	hhr, err := Read(r)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	hit := hhr.Hits[9]
+	for _, pair := range hit.Pairs()[42:] {
+		fmt.Printf("%d %c %d %c\n", pair.Query, pair.QueryResidue,
+			pair.Template, pair.TemplateResidue)
+	}
+	fmt.Println(hit.QueryToTemplate()[150])
+
+	msa := hit.MSA("YAL001C")
+	fmt.Printf("%s\n", msa.GetA2M(0).Residues)
+	fmt.Printf("%s\n", msa.GetA2M(1).Residues)
+	fmt.Printf("%s\n", hit.A3M().Residues)
+	// Output:
+	// 150 H 88 E
+	// 151 L 91 Y
+	// 152 L 92 L
+	// 153 T 93 R
+	// 154 S 94 F
+	// 88
+	// IGNSAFELLLEVAKSGEKGINTMDLAQVTGQDPRSVTGRIKKINH..LLTS
+	// LNINEHHILWIAY--QLNGASISEIAKFGVMHVSTAFNFSKKLEErgYLRF
+	// LNINEHHILWIAY--QLNGASISEIAKFGVMHVSTAFNFSKKLEErgYLRF
+}
+
+func TestPairs(t *testing.T) {
+	for _, fname := range testFiles {
+		testPairs(t, readFile(t, fname))
+	}
+}
+
+func testPairs(t *testing.T, hhr *HHR) {
+	for _, hit := range hhr.Hits {
+		pairs := hit.Pairs()
+		if len(pairs) != hit.NumAlignedCols {
+			t.Fatalf("Hit %d: Expected %d aligned pairs but got %d.",
+				hit.Num, hit.NumAlignedCols, len(pairs))
+		}
+		for i, pair := range pairs {
+			if pair.Query < hit.QueryStart || pair.Query > hit.QueryEnd ||
+				pair.Template < hit.TemplateStart ||
+				pair.Template > hit.TemplateEnd {
+				t.Fatalf("Hit %d: Pair %v is outside of the aligned "+
+					"ranges.", hit.Num, pair)
+			}
+			if i > 0 && (pair.Query <= pairs[i-1].Query ||
+				pair.Template <= pairs[i-1].Template) {
+				t.Fatalf("Hit %d: Pair %v does not follow %v.",
+					hit.Num, pair, pairs[i-1])
+			}
+		}
+
+		// The A3M row has one residue or gap for every query residue.
+		msa := hit.MSA("query")
+		a3m := hit.A3M()
+		matches := 0
+		for _, r := range a3m.Residues {
+			if !(r >= 'a' && r <= 'z') {
+				matches++
+			}
+		}
+		if n := hit.QueryEnd - hit.QueryStart + 1; matches != n {
+			t.Fatalf("Hit %d: Expected %d match columns but got %d.",
+				hit.Num, n, matches)
+		}
+		if msa.Len() != len(msa.GetA2M(1).Residues) {
+			t.Fatalf("Hit %d: Rows of the MSA have different lengths.",
+				hit.Num)
+		}
+
+		q2t, t2q := hit.QueryToTemplate(), hit.TemplateToQuery()
+		for q, tmpl := range q2t {
+			if t2q[tmpl] != q {
+				t.Fatalf("Hit %d: %d maps to %d but %d maps to %d.",
+					hit.Num, q, tmpl, tmpl, t2q[tmpl])
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package hhr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Read reads an hhr file produced by hhsearch or hhblits from HHsuite 2 or 3.
+// Only the first query report in the input is read. (Use a Reader to read
+// all of them, or to read hits one at a time.) If the input has no report,
+// then io.EOF is returned.
+//
+// If the file is malformed, then a *ParseError is returned.
+func Read(r io.Reader) (*HHR, error) {
+	return NewReader(r).readReport()
+}
+
+// A Reader reads hhr files one hit at a time, so that the alignments of
+// large result files (e.g., from 'hhblits -Z 10000') need not be in memory at
+// once. The input may contain several query reports, one after the other.
+// (e.g., the output of a batch of searches or an hhsuite "_hhr.ffdata"
+// file.) Each report starts with a "Query" line. NUL bytes at the start of a
+// line are ignored.
+//
+// For each report, ReadHeader is called first and then ReadHit is called
+// until it returns io.EOF.
+type Reader struct {
+	buf    *bufio.Reader
+	lineno int
+
+	// A line that was read but not used, if unread is set.
+	pending hhrLine
+	unread  bool
+
+	// The query of the current report and its hits that haven't been read.
+	query string
+	hits  []Hit
+}
+
+// NewReader creates a new Reader that is ready to read query reports from
+// some io.Reader.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{buf: bufio.NewReader(r)}
+}
+
+// ReadHeader reads the header and the hit list of the next query report and
+// returns the header. Its Hits are empty. They are read with ReadHit. Any
+// hits of the previous report that haven't been read are skipped. When there
+// are no more reports, io.EOF is returned.
+func (r *Reader) ReadHeader() (*HHR, error) {
+	r.query, r.hits = "", nil
+
+	// Skip to the start of the next report.
+	var lmeta []hhrLine
+	for {
+		l, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if hasPrefix(l.text, "Query") {
+			lmeta = append(lmeta, l)
+			break
+		}
+	}
+
+	// The header ends at the header of the hit list. (If there is no hit
+	// list, it ends at the next report.)
+	var header hhrLine
+	hasHits := false
+HEADER:
+	for {
+		l, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch line := trim(l.text); {
+		case hasPrefix(line, "No Hit"):
+			header, hasHits = l, true
+			break HEADER
+		case hasPrefix(line, "Query"):
+			r.unread, r.pending = true, l
+			break HEADER
+		case len(line) > 0:
+			lmeta = append(lmeta, l)
+		}
+	}
+	hhr, err := readMeta(lmeta)
+	if err != nil {
+		return nil, err
+	}
+
+	// The hit list ends at an empty line.
+	var lhits []hhrLine
+	for hasHits {
+		l, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(trim(l.text)) == 0 {
+			break
+		}
+		lhits = append(lhits, l)
+	}
+	if r.hits, err = readHits(header, lhits); err != nil {
+		return nil, err
+	}
+	r.query = hhr.Query
+	return hhr, nil
+}
+
+// ReadHit reads the next hit of the current query report, in the order of
+// the hit list, along with its alignment. (Hits without an alignment, e.g.,
+// beyond the number of alignments given to hhblits with -B, have an empty
+// Alignment.) When there are no more hits in the report, io.EOF is returned.
+//
+// Alignments must be in the same order as the hit list, as they are in files
+// written by HHsuite.
+func (r *Reader) ReadHit() (Hit, error) {
+	if len(r.hits) == 0 {
+		return Hit{}, io.EOF
+	}
+	hit := r.hits[0]
+	r.hits = r.hits[1:]
+
+	// The alignment of the hit is next, unless it has none.
+	var l hhrLine
+	for {
+		var err error
+		l, err = r.next()
+		if err == io.EOF {
+			return hit, nil
+		}
+		if err != nil {
+			return Hit{}, err
+		}
+		if len(trim(l.text)) > 0 {
+			break
+		}
+	}
+	if !hasPrefix(l.text, "No ") {
+		r.unread, r.pending = true, l
+		return hit, nil
+	}
+	num, err := strconv.Atoi(str(l.text[3:]))
+	if err != nil {
+		return Hit{}, l.errorf(SectionAlignments, "Invalid hit number: %s",
+			err)
+	}
+	if num != hit.Num {
+		for _, later := range r.hits {
+			if later.Num == num {
+				r.unread, r.pending = true, l
+				return hit, nil
+			}
+		}
+		return Hit{}, l.errorf(SectionAlignments,
+			"Hit %d is not in the rest of the hit list.", num)
+	}
+
+	// The alignment ends at the next hit, the end of the report or the start
+	// of the next report.
+	var lines []hhrLine
+	for {
+		l, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Hit{}, err
+		}
+		if hasPrefix(l.text, "No ") || hasPrefix(l.text, "Done!") ||
+			hasPrefix(l.text, "Query") {
+			r.unread, r.pending = true, l
+			break
+		}
+		lines = append(lines, l)
+	}
+	if err := readAlignment(lines, r.query, &hit); err != nil {
+		return Hit{}, err
+	}
+	return hit, nil
+}
+
+// ReadAll reads all remaining query reports in the input. If an error is
+// encountered, processing is stopped, and the error is returned.
+func (r *Reader) ReadAll() ([]*HHR, error) {
+	hhrs := make([]*HHR, 0, 10)
+	for {
+		hhr, err := r.readReport()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		hhrs = append(hhrs, hhr)
+	}
+	return hhrs, nil
+}
+
+// readReport reads the header and all hits of the next query report.
+func (r *Reader) readReport() (*HHR, error) {
+	hhr, err := r.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+	hhr.Hits = make([]Hit, 0, len(r.hits))
+	for {
+		hit, err := r.ReadHit()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		hhr.Hits = append(hhr.Hits, hit)
+	}
+	return hhr, nil
+}
+
+// next returns the next line of the input without its line terminator and
+// leading NUL bytes. At the end of the input, io.EOF is returned.
+func (r *Reader) next() (hhrLine, error) {
+	if r.unread {
+		r.unread = false
+		return r.pending, nil
+	}
+	line, err := r.buf.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return hhrLine{}, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return hhrLine{}, fmt.Errorf("Error reading hhr: %s", err)
+	}
+	r.lineno++
+
+	// Lines keep their leading and inner spaces, since the hit list and the
+	// match and confidence lines of alignments are aligned by column.
+	line = bytes.TrimLeft(bytes.TrimRight(line, "\r\n"), "\x00")
+	return hhrLine{r.lineno, line}, nil
+}
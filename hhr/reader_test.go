@@ -0,0 +1,145 @@
+package hhr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// concatenated returns the test files one after the other, as in an hhsuite
+// "_hhr.ffdata" file, where every file is followed by a NUL byte.
+func concatenated() ([]byte, error) {
+	var all []byte
+	for _, fname := range testFiles {
+		bs, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		all = append(append(all, bs...), 0)
+	}
+	return all, nil
+}
+
+func ExampleReader() {
+	all, err := concatenated()
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	r := NewReader(bytes.NewReader(all))
+	for {
+		hhr, err := r.ReadHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		fmt.Println(strings.Fields(hhr.Query)[0])
+
+		for {
+			hit, err := r.ReadHit()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Fatalf("%s", err)
+			}
+			if hit.Prob >= 0.75 {
+				fmt.Printf("%d %s %0.2f %d\n", hit.Num, hit.Name, hit.Prob,
+					len(hit.Aligned.QSeq))
+			}
+		}
+	}
+	// Output:
+	// YAL001C
+	// 1 1p4xA 0.82 52
+	// 2 1p4xA 0.77 52
+	// 3 1xn7A 0.75 49
+	// YAL001C
+	// 1 1p4xA 0.82 52
+	// 2 1p4xA 0.77 52
+	// 3 1xn7A 0.75 49
+}
+
+func TestReader(t *testing.T) {
+	all, err := concatenated()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhrs, err := NewReader(bytes.NewReader(all)).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hhrs) != len(testFiles) {
+		t.Fatalf("Expected %d reports but got %d.", len(testFiles),
+			len(hhrs))
+	}
+	for i, fname := range testFiles {
+		if !reflect.DeepEqual(hhrs[i], readFile(t, fname)) {
+			t.Fatalf("Report %d is not the same as '%s'.", i+1, fname)
+		}
+	}
+
+	// Hits that haven't been read are skipped.
+	r := NewReader(bytes.NewReader(all))
+	if _, err := r.ReadHeader(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := r.ReadHit(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhr, err := r.ReadHeader()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !strings.HasSuffix(hhr.Command, "-aliw 40") {
+		t.Fatalf("Expected the second report but got '%s'.", hhr.Command)
+	}
+	if _, err := r.ReadHeader(); err != io.EOF {
+		t.Fatalf("Expected io.EOF but got '%v'.", err)
+	}
+}
+
+func TestReaderMissingAlignments(t *testing.T) {
+	original, err := ioutil.ReadFile("yal001c.hhr")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Only the first 20 hits have alignments. (e.g., with 'hhblits -B 20'.)
+	cut := bytes.Index(original, []byte("\nNo 21 "))
+	truncated := append(original[:cut+1:cut+1], []byte("Done!\n")...)
+	hhr, err := Read(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hhr.Hits) != 28 {
+		t.Fatalf("Expected 28 hits but got %d.", len(hhr.Hits))
+	}
+	for i, hit := range hhr.Hits {
+		aligned := len(hit.Aligned.QSeq) > 0
+		if hit.Num != i+1 || aligned != (hit.Num <= 20) {
+			t.Fatalf("Hit %d: Unexpected number %d or alignment %v.",
+				i+1, hit.Num, aligned)
+		}
+		if aligned {
+			continue
+		}
+
+		// Hits without an alignment have no aligned rows.
+		if msa := hit.MSA("yal001c"); len(msa.Entries) != 0 {
+			t.Fatalf("Hit %d: Expected no rows but got %d.",
+				hit.Num, len(msa.Entries))
+		}
+		if a3m := hit.A3M(); a3m.Len() != 0 || len(a3m.Name) == 0 {
+			t.Fatalf("Hit %d: Expected an empty row but got %#v.",
+				hit.Num, a3m)
+		}
+	}
+}
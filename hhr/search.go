@@ -0,0 +1,52 @@
+package hhr
+
+import (
+	"github.com/TuftsBCB/io/search"
+	"github.com/TuftsBCB/seq"
+)
+
+// SearchHits returns the hits of an hhr file as search hits.
+func (hhr *HHR) SearchHits() []search.Hit {
+	hits := make([]search.Hit, len(hhr.Hits))
+	for i := range hhr.Hits {
+		hits[i] = hhr.Hits[i]
+	}
+	return hits
+}
+
+// The methods of Hit below satisfy the search.Hit interface.
+
+// TargetName returns the name of the template.
+func (hit Hit) TargetName() string {
+	return hit.Name
+}
+
+// Expect returns the E-value of the hit.
+func (hit Hit) Expect() float64 {
+	return hit.EValue
+}
+
+// BitScore returns the score of the hit, which is the score in the hit list.
+func (hit Hit) BitScore() float64 {
+	return hit.ViterbiScore
+}
+
+// Probability returns the probability of the hit.
+func (hit Hit) Probability() float64 {
+	return hit.Prob
+}
+
+// QueryRange returns the range of the query in the alignment of the hit.
+func (hit Hit) QueryRange() (start, end int) {
+	return hit.QueryStart, hit.QueryEnd
+}
+
+// TargetRange returns the range of the template in the alignment of the hit.
+func (hit Hit) TargetRange() (start, end int) {
+	return hit.TemplateStart, hit.TemplateEnd
+}
+
+// Alignment returns the aligned query and template sequences.
+func (hit Hit) Alignment() (query, target []seq.Residue) {
+	return hit.Aligned.QSeq, hit.Aligned.TSeq
+}
@@ -0,0 +1,7 @@
+/*
+Package template reads the structures of the templates of hhr hits and maps
+the aligned residues of a hit onto the alpha-carbon atoms of its template.
+Structures are read from PDB or PDBx/mmCIF files, so this package is separate
+from package hhr, which only reads and writes hhr files.
+*/
+package template
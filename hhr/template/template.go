@@ -0,0 +1,322 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/TuftsBCB/io/hhr"
+	"github.com/TuftsBCB/io/pdb"
+	"github.com/TuftsBCB/io/pdbx"
+	"github.com/TuftsBCB/seq"
+	"github.com/TuftsBCB/structure"
+)
+
+// Template is the structure of a single chain of a template. Its residues
+// are numbered in the same way as the residues of the template in a hit (i.e.,
+// by their index in the SEQRES records, starting at 1), so that residue i is
+// Seq[i-1] and its alpha-carbon is CaAtoms[i-1].
+type Template struct {
+	// The name of the structure file and the identifier of the chain.
+	Name  string
+	Chain byte
+
+	// The sequence of the chain.
+	Seq []seq.Residue
+
+	// The coordinates of the alpha-carbon atom of every residue in Seq,
+	// which are nil for residues without one. (e.g., residues that are
+	// disordered in the structure.)
+	CaAtoms []*structure.Coords
+}
+
+// AlignedCa is a pair of aligned residues of a hit along with the
+// coordinates of the alpha-carbon atom of the template residue.
+type AlignedCa struct {
+	hhr.ResiduePair
+	Ca structure.Coords
+}
+
+// Opener opens the structure file of a template, given the name of its PDB
+// entry (e.g., "1abc") or SCOP domain (e.g., "d1abca_"). The file may be in
+// the PDB or PDBx/mmCIF format, and may be compressed with gzip.
+type Opener func(name string) (io.ReadCloser, error)
+
+// Dir returns an Opener that opens structure files in a
+// directory. The names of the files are those of the PDB's archives:
+// "1abc.cif", "1abc.pdb", "pdb1abc.ent" or (for SCOP domains) "d1abca_.ent",
+// each of which may end with ".gz". They are found in the directory itself,
+// or in a subdirectory named by the middle two characters of the PDB
+// identifier (e.g., "ab/pdb1abc.ent.gz"), like a mirror of the PDB.
+func Dir(dir string) Opener {
+	return func(name string) (io.ReadCloser, error) {
+		id := name
+		if len(id) == 7 { // SCOP
+			id = id[1:5]
+		}
+		subdirs := []string{dir}
+		if len(id) == 4 {
+			subdirs = append(subdirs, path.Join(dir, id[1:3]))
+		}
+		bases := []string{
+			name + ".cif", name + ".pdb", "pdb" + name + ".ent", name + ".ent",
+		}
+		for _, subdir := range subdirs {
+			for _, base := range bases {
+				for _, ext := range []string{"", ".gz"} {
+					f, err := os.Open(path.Join(subdir, base+ext))
+					if err == nil {
+						return f, nil
+					}
+					if !os.IsNotExist(err) {
+						return nil, err
+					}
+				}
+			}
+		}
+		return nil, fmt.Errorf("Could not find a structure file for '%s' "+
+			"in '%s'.", name, dir)
+	}
+}
+
+// ParseName returns the name of the structure file of a template and
+// the identifier of its chain, given the name of a hit. The names of pdb70
+// templates are a PDB identifier and a chain, like "1abc_A" or "1abcA",
+// where the PDB identifier is returned in lowercase. The names of SCOP
+// domains (e.g., "d1abca_") are returned as is, along with their chain in
+// uppercase.
+//
+// The chain is 0 if the template doesn't name one, or if it is a SCOP domain
+// of several chains (e.g., "d1abc_1" or "d1abc.1"). In that case, the
+// structure must have a single chain.
+func ParseName(hitName string) (name string, chain byte, err error) {
+	switch {
+	case len(hitName) == 7 && strings.IndexByte("deg", hitName[0]) > -1:
+		chain = hitName[5]
+		if chain == '_' || chain == '.' {
+			chain = 0
+		} else if chain >= 'a' && chain <= 'z' {
+			chain -= 'a' - 'A'
+		}
+		return hitName, chain, nil
+	case len(hitName) == 6 && hitName[4] == '_':
+		return strings.ToLower(hitName[0:4]), hitName[5], nil
+	case len(hitName) == 5 && hitName[4] != '_':
+		return strings.ToLower(hitName[0:4]), hitName[4], nil
+	case len(hitName) == 4:
+		return strings.ToLower(hitName), 0, nil
+	}
+	return "", 0, fmt.Errorf("Could not find a PDB identifier and chain in "+
+		"the template name '%s'.", hitName)
+}
+
+// Read reads the chain of a template with the given hit name (see ParseName)
+// from the structure file opened by open. PDB files are read with pdb.Read
+// and PDBx/mmCIF files are read with pdbx.Read. Only the first model of the
+// chain is used.
+func Read(open Opener, hitName string) (*Template, error) {
+	name, chain, err := ParseName(hitName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, cif, err := sniffStructure(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the structure of '%s': %s",
+			name, err)
+	}
+	if cif {
+		entry, err := pdbx.Read(r)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the structure of '%s': %s",
+				name, err)
+		}
+		return NewPDBx(entry, name, chain)
+	}
+	entry, err := pdb.Read(r, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewPDB(entry, name, chain)
+}
+
+// NewPDB returns the chain of a PDB entry as a template. If chain is
+// 0, then the entry must have a single chain.
+//
+// If the chain has no SEQRES records (e.g., an ASTRAL file of a SCOP domain),
+// then its sequence is made of the residues in its ATOM records, which is
+// how SCOP numbers the residues of its domains.
+func NewPDB(entry *pdb.Entry, name string, chain byte) (*Template, error) {
+	var c *pdb.Chain
+	if chain == 0 {
+		if len(entry.Chains) != 1 {
+			return nil, fmt.Errorf("Expected one chain in '%s' but got %d.",
+				name, len(entry.Chains))
+		}
+		c = entry.Chains[0]
+	} else if c = entry.Chain(chain); c == nil {
+		return nil, fmt.Errorf("Could not find chain '%c' in '%s'.",
+			chain, name)
+	}
+	if len(c.Models) == 0 {
+		return nil, fmt.Errorf("Chain '%c' of '%s' has no ATOM records.",
+			c.Ident, name)
+	}
+
+	tmpl := &Template{Name: name, Chain: c.Ident}
+	if len(c.Sequence) > 0 {
+		tmpl.Seq = c.Sequence
+		tmpl.CaAtoms = c.SequenceCaAtoms()
+		return tmpl, nil
+	}
+	for _, r := range c.Models[0].Residues {
+		if len(r.Atoms) > 0 && r.Atoms[0].Het {
+			continue
+		}
+		tmpl.Seq = append(tmpl.Seq, r.Name)
+		if ca, ok := r.Ca(); ok {
+			tmpl.CaAtoms = append(tmpl.CaAtoms, &ca)
+		} else {
+			tmpl.CaAtoms = append(tmpl.CaAtoms, nil)
+		}
+	}
+	return tmpl, nil
+}
+
+// NewPDBx returns the chain of a PDBx/mmCIF entry as a template. If chain is
+// 0, then the entry must have a single polymer chain.
+//
+// Note that chains are found by their identifiers in pdbx.Chain (i.e.,
+// "label_asym_id"), which are usually, but not always, the same as the
+// chains of the PDB format that pdb70 uses.
+func NewPDBx(entry *pdbx.Entry, name string, chain byte) (*Template, error) {
+	var c *pdbx.Chain
+	var chains int
+	for _, entity := range entry.Entities {
+		if entity.Type != "polymer" {
+			continue
+		}
+		for id, ec := range entity.Chains {
+			chains++
+			if chain == 0 || id == chain {
+				c = ec
+			}
+		}
+	}
+	switch {
+	case chain == 0 && chains != 1:
+		return nil, fmt.Errorf("Expected one chain in '%s' but got %d.",
+			name, chains)
+	case c == nil:
+		return nil, fmt.Errorf("Could not find chain '%c' in '%s'.",
+			chain, name)
+	case len(c.Models) == 0:
+		return nil, fmt.Errorf("Chain '%c' of '%s' has no ATOM records.",
+			c.Id, name)
+	}
+	return &Template{
+		Name:    name,
+		Chain:   c.Id,
+		Seq:     c.Entity.Seq,
+		CaAtoms: c.Models[0].AlphaCarbonsSeq,
+	}, nil
+}
+
+// CaAtoms reads the template of a hit with Read and returns its aligned
+// residues along with their alpha-carbon atoms. See AlignedCa.
+func CaAtoms(hit hhr.Hit, open Opener) ([]AlignedCa, error) {
+	tmpl, err := Read(open, hit.Name)
+	if err != nil {
+		return nil, err
+	}
+	return Align(hit, tmpl)
+}
+
+// Align returns every pair of aligned residues of a hit (see hhr.Hit's
+// EachPair) whose template residue has an alpha-carbon atom in the given
+// template, along with the coordinates of that atom.
+//
+// An error is returned if the range of the template in the hit is not in the
+// template, or if an aligned residue of the template is not the residue of
+// the template's sequence with the same number. (Unknown residues, 'X',
+// match any residue.) This usually means that the wrong chain was read.
+func Align(hit hhr.Hit, tmpl *Template) ([]AlignedCa, error) {
+	if hit.TemplateStart < 1 || hit.TemplateEnd > len(tmpl.Seq) {
+		return nil, fmt.Errorf("The range %d-%d of '%s' is not in chain "+
+			"'%c' of '%s', which has %d residues.", hit.TemplateStart,
+			hit.TemplateEnd, hit.Name, tmpl.Chain, tmpl.Name, len(tmpl.Seq))
+	}
+
+	var err error
+	aligned := make([]AlignedCa, 0, hit.NumAlignedCols)
+	hit.EachPair(func(pair hhr.ResiduePair) bool {
+		if pair.Template > len(tmpl.Seq) {
+			err = fmt.Errorf("Template residue %d of '%s' is not in chain "+
+				"'%c' of '%s'.", pair.Template, hit.Name, tmpl.Chain,
+				tmpl.Name)
+			return false
+		}
+		hitRes := upper(pair.TemplateResidue)
+		tmplRes := upper(tmpl.Seq[pair.Template-1])
+		if hitRes != tmplRes && hitRes != 'X' && tmplRes != 'X' {
+			err = fmt.Errorf("Template residue %d of '%s' is '%c', but it "+
+				"is '%c' in chain '%c' of '%s'.", pair.Template, hit.Name,
+				hitRes, tmplRes, tmpl.Chain, tmpl.Name)
+			return false
+		}
+		if ca := tmpl.CaAtoms[pair.Template-1]; ca != nil {
+			aligned = append(aligned, AlignedCa{pair, *ca})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aligned, nil
+}
+
+func upper(r seq.Residue) seq.Residue {
+	if r >= 'a' && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
+
+// sniffStructure returns a reader of a structure file, which is decompressed
+// if it is compressed with gzip, and whether it is in the PDBx/mmCIF format.
+// A PDBx/mmCIF file starts with a "data_" line, possibly after comments.
+func sniffStructure(r io.Reader) (io.Reader, bool, error) {
+	buf := bufio.NewReader(r)
+	if magic, err := buf.Peek(2); err == nil && bytes.Equal(
+		magic, []byte{0x1f, 0x8b}) {
+
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, false, err
+		}
+		buf = bufio.NewReader(gz)
+	}
+
+	head, err := buf.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, false, err
+	}
+	for _, line := range bytes.Split(head, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		return buf, bytes.HasPrefix(line, []byte("data_")), nil
+	}
+	return buf, false, nil
+}
@@ -0,0 +1,254 @@
+package template
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/TuftsBCB/io/hhr"
+	"github.com/TuftsBCB/io/pdbx"
+	"github.com/TuftsBCB/seq"
+	"github.com/TuftsBCB/structure"
+)
+
+// templateHit is a hit of the template in 1abc.pdb, whose chain A has the
+// sequence MKTAYIAKQRGS. Residues 1 and 2 are missing from the structure and
+// residue 8 has no alpha-carbon.
+func templateHit(name, qseq, tseq string) hhr.Hit {
+	return hhr.Hit{
+		Name:          name,
+		QueryStart:    5,
+		QueryEnd:      15,
+		TemplateStart: 2,
+		TemplateEnd:   12,
+		Aligned: hhr.Alignment{
+			QSeq: []seq.Residue(qseq),
+			TSeq: []seq.Residue(tseq),
+		},
+	}
+}
+
+func ExampleCaAtoms() {
+	hit := templateHit("1ABC_A", "K-AYLAKQWRGS", "KTAYIAKQ-RGS")
+	aligned, err := CaAtoms(hit, Dir("."))
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	for _, a := range aligned {
+		fmt.Printf("%d %c %d %c %v\n", a.Query, a.QueryResidue,
+			a.Template, a.TemplateResidue, a.Ca)
+	}
+	// Output:
+	// 6 A 4 A 4.000 8.000 12.000
+	// 7 Y 5 Y 5.000 10.000 15.000
+	// 8 L 6 I 6.000 12.000 18.000
+	// 9 A 7 A 7.000 14.000 21.000
+	// 11 Q 9 Q 9.000 18.000 27.000
+	// 13 R 10 R 10.000 20.000 30.000
+	// 14 G 11 G 11.000 22.000 33.000
+	// 15 S 12 S 12.000 24.000 36.000
+}
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		hitName, name string
+		chain         byte
+	}{
+		{"1ABC_A", "1abc", 'A'},
+		{"1abc_a", "1abc", 'a'},
+		{"1p4xA", "1p4x", 'A'},
+		{"1abc", "1abc", 0},
+		{"d1abca_", "d1abca_", 'A'},
+		{"d1abc_1", "d1abc_1", 0},
+		{"e1abcB2", "e1abcB2", 'B'},
+		{"7abc_AA", "", 0},
+		{"1abc_", "", 0},
+	}
+	for _, test := range tests {
+		name, chain, err := ParseName(test.hitName)
+		if len(test.name) == 0 {
+			if err == nil {
+				t.Fatalf("Expected an error for '%s' but got '%s' and '%c'.",
+					test.hitName, name, chain)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if name != test.name || chain != test.chain {
+			t.Fatalf("Expected '%s' and '%c' for '%s' but got '%s' and '%c'.",
+				test.name, test.chain, test.hitName, name, chain)
+		}
+	}
+}
+
+func TestReadTemplate(t *testing.T) {
+	tmpl, err := Read(Dir("."), "1abcB")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if tmpl.Name != "1abc" || tmpl.Chain != 'B' ||
+		string(tmpl.Seq) != "GGG" || len(tmpl.CaAtoms) != 3 {
+		t.Fatalf("Unexpected template: %#v", tmpl)
+	}
+
+	// The structure has two chains, so one must be named.
+	if _, err := Read(Dir("."), "1abc"); err == nil {
+		t.Fatalf("Expected an error for a template without a chain.")
+	}
+	if _, err := Read(Dir("."), "1abcC"); err == nil {
+		t.Fatalf("Expected an error for a missing chain.")
+	}
+	if _, err := Read(Dir("."), "2abcA"); err == nil {
+		t.Fatalf("Expected an error for a missing structure file.")
+	}
+}
+
+func TestReadPDBx(t *testing.T) {
+	// 3abc.cif has the sequence MKTAYI in chain A, whose first residue is
+	// missing from the structure and whose fourth residue has no
+	// alpha-carbon. Chain B is water, so chain A is its only polymer chain.
+	for _, hitName := range []string{"3abc_A", "3abc"} {
+		tmpl, err := Read(Dir("."), hitName)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if tmpl.Name != "3abc" || tmpl.Chain != 'A' ||
+			string(tmpl.Seq) != "MKTAYI" || len(tmpl.CaAtoms) != 6 {
+			t.Fatalf("Unexpected template: %#v", tmpl)
+		}
+		if tmpl.CaAtoms[0] != nil || tmpl.CaAtoms[3] != nil ||
+			tmpl.CaAtoms[1] == nil || tmpl.CaAtoms[1].X != 2 {
+			t.Fatalf("Unexpected alpha-carbons: %v", tmpl.CaAtoms)
+		}
+	}
+	if _, err := Read(Dir("."), "3abcB"); err == nil {
+		t.Fatalf("Expected an error for a chain that is not a polymer.")
+	}
+}
+
+func TestNewPDBx(t *testing.T) {
+	ca := &structure.Coords{X: 1, Y: 2, Z: 3}
+	entry := &pdbx.Entry{Id: "4ABC", Entities: map[byte]*pdbx.Entity{}}
+	for _, id := range []byte{'1', '2'} {
+		ent := &pdbx.Entity{
+			Id:     id,
+			Type:   "polymer",
+			Seq:    []seq.Residue("GA"),
+			Chains: map[byte]*pdbx.Chain{},
+		}
+		chain := &pdbx.Chain{Entity: ent, Id: 'A' + id - '1'}
+		chain.Models = []*pdbx.Model{{
+			Chain:           chain,
+			Num:             1,
+			AlphaCarbonsSeq: []*structure.Coords{nil, ca},
+		}}
+		ent.Chains[chain.Id] = chain
+		entry.Entities[id] = ent
+	}
+
+	tmpl, err := NewPDBx(entry, "4abc", 'B')
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if tmpl.Name != "4abc" || tmpl.Chain != 'B' || string(tmpl.Seq) != "GA" ||
+		len(tmpl.CaAtoms) != 2 || tmpl.CaAtoms[1] != ca {
+		t.Fatalf("Unexpected template: %#v", tmpl)
+	}
+
+	// With two polymer chains, one must be named.
+	if _, err := NewPDBx(entry, "4abc", 0); err == nil {
+		t.Fatalf("Expected an error for a template without a chain.")
+	}
+	if _, err := NewPDBx(entry, "4abc", 'C'); err == nil {
+		t.Fatalf("Expected an error for a missing chain.")
+	}
+
+	// Chains that are not polymers are not templates.
+	entry.Entities['2'].Type = "water"
+	tmpl, err = NewPDBx(entry, "4abc", 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if tmpl.Chain != 'A' {
+		t.Fatalf("Expected chain 'A' but got '%c'.", tmpl.Chain)
+	}
+}
+
+func TestDirMirror(t *testing.T) {
+	// Files may be compressed in subdirectories, like a mirror of the PDB.
+	dir, err := ioutil.TempDir("", "template")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pdbText, err := ioutil.ReadFile("1abc.pdb")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := os.Mkdir(path.Join(dir, "ab"), 0777); err != nil {
+		t.Fatalf("%s", err)
+	}
+	f, err := os.Create(path.Join(dir, "ab", "pdb1abc.ent.gz"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(pdbText); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	tmpl, err := Read(Dir(dir), "1abc_A")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if string(tmpl.Seq) != "MKTAYIAKQRGS" {
+		t.Fatalf("Unexpected sequence '%s'.", tmpl.Seq)
+	}
+	if tmpl.CaAtoms[1] != nil || tmpl.CaAtoms[7] != nil ||
+		tmpl.CaAtoms[2] == nil {
+		t.Fatalf("Unexpected alpha-carbons: %v", tmpl.CaAtoms)
+	}
+}
+
+func TestAlignErrors(t *testing.T) {
+	tmpl, err := Read(Dir("."), "1abc_A")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Unknown residues match any residue.
+	hit := templateHit("1abc_A", "K-AYLAKQWRGS", "KTAXIAKQ-RGS")
+	if _, err := Align(hit, tmpl); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	tests := []struct {
+		hit      hhr.Hit
+		contains string
+	}{
+		{templateHit("1abc_A", "K-AYLAKQWRGS", "KTAWIAKQ-RGS"), "'W'"},
+		{templateHit("1abc_A", "K-AYLAKQWRGSM", "KTAYIAKQ-RGSM"), "13"},
+	}
+	tests[1].hit.TemplateEnd = 13
+	for _, test := range tests {
+		_, err := Align(test.hit, tmpl)
+		if err == nil || !strings.Contains(err.Error(), test.contains) {
+			t.Fatalf("Expected an error containing %s but got '%v'.",
+				test.contains, err)
+		}
+	}
+}
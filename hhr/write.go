@@ -0,0 +1,191 @@
+package hhr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// alignmentWidth is the number of columns in each block of an alignment,
+// which is the default used by HHsuite. (i.e., '-aliw 80'.)
+const alignmentWidth = 80
+
+// Write writes an hhr file in the format produced by hhsearch and hhblits.
+// The header, the hit list and an alignment for every hit are written, in
+// that order. Alignments are written in the blocks that they were read in.
+// Alignments without blocks are wrapped in blocks of 80 columns, and the
+// residue numbers of each block are computed from the start of the hit's
+// query and template ranges.
+//
+// The probability, E-value and score above the alignment of a hit are
+// AlignProb, AlignEValue and AlignScore if they agree with the rounded values
+// in the hit list. (i.e., Prob, EValue and ViterbiScore.) Otherwise, the
+// values of the hit list are written instead.
+//
+// Alignments only include the rows that are present in the hit's Alignment.
+// Rows (e.g., secondary structure or confidence) that are shorter than the
+// query sequence of the alignment are omitted.
+func Write(w io.Writer, hhr *HHR) error {
+	buf := bufio.NewWriter(w)
+	pf := func(format string, v ...interface{}) {
+		fmt.Fprintf(buf, format, v...)
+	}
+
+	pf("Query         %s\n", hhr.Query)
+	pf("Match_columns %d\n", hhr.MatchColumns)
+	pf("No_of_seqs    %s\n", hhr.NumSeqs)
+	pf("Neff          %-4.1f\n", float64(hhr.Neff))
+	pf("Searched_HMMs %d\n", hhr.SearchedHMMs)
+	pf("Date          %s\n", hhr.Date)
+	pf("Command       %s\n", hhr.Command)
+	pf("\n")
+
+	pf(" No Hit                             Prob E-value P-value  Score    " +
+		"SS Cols Query HMM  Template HMM\n")
+	for _, hit := range hhr.Hits {
+		pf("%3d %-30.30s %5.1f %7s %7s %6.1f %5.1f %4d %4d-%-4d %4d-%-4d(%d)\n",
+			hit.Num, hit.templateName(), hit.Prob*100, gStr(hit.EValue),
+			gStr(hit.PValue), hit.ViterbiScore, hit.SSScore,
+			hit.NumAlignedCols, hit.QueryStart, hit.QueryEnd,
+			hit.TemplateStart, hit.TemplateEnd, hit.NumTemplateCols)
+	}
+	pf("\n")
+
+	queryName := hhr.Query
+	if fields := strings.Fields(queryName); len(fields) > 0 {
+		queryName = fields[0]
+	}
+	for _, hit := range hhr.Hits {
+		pf("No %-3d\n", hit.Num)
+		if len(hit.Description) > 0 {
+			pf(">%s %s\n", hit.Name, hit.Description)
+		} else {
+			pf(">%s\n", hit.Name)
+		}
+		pf("Probab=%.2f  E-value=%.2g  Score=%.2f  Aligned_cols=%d  "+
+			"Identities=%.0f%%  Similarity=%.3f  Sum_probs=%.1f",
+			alignScore(hit.Prob, hit.AlignProb, 0.001)*100,
+			alignScore(hit.EValue, hit.AlignEValue, 0.1*hit.EValue),
+			alignScore(hit.ViterbiScore, hit.AlignScore, 0.1),
+			hit.NumAlignedCols,
+			hit.Identities*100, hit.Similarity, hit.SumProbs)
+		if hit.TemplateNeff != 0 {
+			pf("  Template_Neff=%.3f", hit.TemplateNeff)
+		}
+		pf("\n\n")
+		writeAlignment(pf, queryName, hhr.MatchColumns, hit)
+		pf("\n")
+	}
+	pf("Done!\n")
+	return buf.Flush()
+}
+
+// writeAlignment writes the alignment of a hit in blocks, each followed by an
+// empty line.
+func writeAlignment(
+	pf func(format string, v ...interface{}),
+	queryName string,
+	queryLen int,
+	hit Hit,
+) {
+	a := hit.Aligned
+	for _, b := range alignmentBlocks(hit) {
+		ss := func(row, name string, rs []seq.Residue) {
+			if len(rs) >= b.End {
+				pf("%s %-14.14s      %s\n", row, name, rs[b.Start:b.End])
+			}
+		}
+		numbered := func(
+			row, name string,
+			rs []seq.Residue,
+			first, last, n int,
+		) {
+			if len(rs) >= b.End {
+				pf("%s %-14.14s %4d %s %4d (%d)\n",
+					row, name, first, rs[b.Start:b.End], last, n)
+			}
+		}
+		tlen := hit.NumTemplateCols
+
+		ss("Q", "ss_dssp", a.QDssp)
+		ss("Q", "ss_pred", a.QPred)
+		ss("Q", "ss_conf", a.QConf)
+		numbered("Q", queryName, a.QSeq, b.QueryStart, b.QueryEnd, queryLen)
+		numbered("Q", "Consensus", a.QConsensus,
+			b.QueryStart, b.QueryEnd, queryLen)
+		if len(a.Match) >= b.End {
+			pf("%22s%s\n", "", a.Match[b.Start:b.End])
+		}
+		numbered("T", "Consensus", a.TConsensus,
+			b.TemplateStart, b.TemplateEnd, tlen)
+		numbered("T", hit.Name, a.TSeq, b.TemplateStart, b.TemplateEnd, tlen)
+		ss("T", "ss_dssp", a.TDssp)
+		ss("T", "ss_pred", a.TPred)
+		ss("T", "ss_conf", a.TConf)
+		if len(a.Confidence) >= b.End {
+			pf("%-22s%s\n", "Confidence", a.Confidence[b.Start:b.End])
+		}
+		pf("\n")
+	}
+}
+
+// alignmentBlocks returns the blocks of a hit's alignment. If the alignment
+// has no blocks, then it is divided into blocks of alignmentWidth columns,
+// and their residue numbers are computed from the start of the hit's query
+// and template ranges.
+func alignmentBlocks(hit Hit) []Block {
+	a := hit.Aligned
+	if len(a.Blocks) > 0 {
+		return a.Blocks
+	}
+	var blocks []Block
+	qi, ti := hit.QueryStart, hit.TemplateStart
+	for start := 0; start < len(a.QSeq); start += alignmentWidth {
+		end := start + alignmentWidth
+		if end > len(a.QSeq) {
+			end = len(a.QSeq)
+		}
+		b := Block{Start: start, End: end, QueryStart: qi, TemplateStart: ti}
+		b.QueryEnd = qi + residueCount(a.QSeq[start:end]) - 1
+		if len(a.TSeq) >= end {
+			b.TemplateEnd = ti + residueCount(a.TSeq[start:end]) - 1
+		}
+		qi, ti = b.QueryEnd+1, b.TemplateEnd+1
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// residueCount returns the number of residues in a row of an alignment,
+// which excludes gaps.
+func residueCount(rs []seq.Residue) int {
+	n := 0
+	for _, r := range rs {
+		if r != '-' && r != '.' {
+			n++
+		}
+	}
+	return n
+}
+
+// alignScore returns the value to write above an alignment, given the value
+// of the hit list, which was rounded to the given precision, and the value
+// that was read above the alignment. The value that was read is returned if
+// it rounds to the value of the hit list. Otherwise, the value of the hit
+// list is returned.
+func alignScore(list, read, precision float64) float64 {
+	if math.Abs(list-read) <= precision/2+1e-9 {
+		return read
+	}
+	return list
+}
+
+// gStr formats an E-value or P-value in the hit list with two significant
+// digits in the same way as HHsuite. (e.g., '0.026' or '1.1E-05'.)
+func gStr(f float64) string {
+	return fmt.Sprintf("%.2G", f)
+}
@@ -0,0 +1,589 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// AlignMode determines which parts of a profile must be aligned to a
+// sequence.
+type AlignMode int
+
+const (
+	// Local alignments may start and end at any match state of the profile.
+	// Each match state is equally likely to be the first one, and any match
+	// state may be the last one.
+	Local AlignMode = iota
+
+	// Glocal alignments must cover every node of the profile, starting with
+	// the begin state's transitions and ending at the last node.
+	Glocal
+)
+
+func (mode AlignMode) String() string {
+	switch mode {
+	case Local:
+		return "local"
+	case Glocal:
+		return "glocal"
+	}
+	return fmt.Sprintf("AlignMode(%d)", int(mode))
+}
+
+// Profile is a profile HMM that sequences can be aligned to. Profiles can be
+// made from both HHMs and HMMs.
+//
+// Scores are log-odds scores in bits, computed against the NULL emissions of
+// the HMM. In both modes, an alignment may start and end anywhere in the
+// sequence, and the residues outside of it are not scored. (i.e., there is no
+// length model like the one used by HMMER, so scores are not directly
+// comparable with HMMER's bit scores.)
+type Profile struct {
+	Name  string
+	HMM   *seq.HMM
+	Begin BeginState
+}
+
+// Profile returns a profile for aligning sequences to the HHM.
+func (hhm *HHM) Profile() *Profile {
+	return &Profile{Name: hhm.Meta.Name, HMM: hhm.HMM, Begin: hhm.Begin}
+}
+
+// Profile returns a profile for aligning sequences to the HMM.
+func (hmm *HMM) Profile() *Profile {
+	return &Profile{Name: hmm.Meta.Name, HMM: hmm.HMM, Begin: hmm.Begin}
+}
+
+// PathState is a single state in an alignment of a sequence to a profile.
+type PathState struct {
+	// One of seq.Match, seq.Insertion or seq.Deletion.
+	State seq.HMMState
+
+	// The node number of the state, starting at 1. Insertions before the
+	// first node (from the begin state) have a node number of 0.
+	Node int
+
+	// The position of the residue emitted by the state, starting at 1.
+	// Deletions have a residue position of 0.
+	Residue int
+}
+
+// Alignment is the most probable alignment of a sequence to a profile, as
+// found by the Viterbi algorithm.
+type Alignment struct {
+	// The log-odds score of the alignment in bits.
+	Score float64
+
+	// The states visited by the alignment, in order.
+	Path []PathState
+
+	// The aligned region of the sequence and the profile. Both are
+	// inclusive and start at 1.
+	SeqStart, SeqEnd   int
+	NodeStart, NodeEnd int
+
+	// The alignment as a two row MSA in A2M format. The first row is the
+	// consensus residue of each node (named after the profile) and the
+	// second row is the aligned region of the sequence.
+	MSA seq.MSA
+}
+
+// Posterior contains the results of the Forward and Backward algorithms.
+type Posterior struct {
+	// The log-odds scores in bits of the sequence summed over all
+	// alignments, computed by the Forward and Backward algorithms. They are
+	// equal up to rounding errors.
+	Forward, Backward float64
+
+	// Match[i][k] and Insert[i][k] are the posterior probabilities that
+	// residue i+1 is emitted by the match or insertion state of node k.
+	// Each row has a column for every node number from 0 to the number of
+	// nodes. (Column 0 of Match is always zero, and column 0 of Insert is
+	// the insertion state of the begin state.)
+	Match, Insert [][]float64
+}
+
+var negInf = math.Inf(-1)
+
+// scorer has everything needed by the dynamic programming algorithms in
+// log_2 form, indexed by node number. Node 0 is the begin state.
+type scorer struct {
+	mode    AlignMode
+	m       int
+	residue []seq.Residue
+	trans   []seq.TProbs
+	mat     [][]float64 // match emission log-odds of node k, residue i
+	ins     [][]float64 // insert emission log-odds of node k, residue i
+	entry   float64     // log_2 probability of a local entry into a node
+}
+
+func newScorer(p *Profile, s seq.Sequence, mode AlignMode) (*scorer, error) {
+	hmm := p.HMM
+	if hmm == nil || len(hmm.Nodes) == 0 {
+		return nil, fmt.Errorf("Cannot align to a profile without nodes.")
+	}
+	if s.Len() == 0 {
+		return nil, fmt.Errorf("Cannot align an empty sequence.")
+	}
+	if mode != Local && mode != Glocal {
+		return nil, fmt.Errorf("Unknown alignment mode %s.", mode)
+	}
+
+	var index [256]int
+	for i := range index {
+		index[i] = -1
+	}
+	for i, r := range hmm.Alphabet {
+		index[r] = i
+	}
+	residues := make([]int, s.Len())
+	for i, r := range s.Residues {
+		residues[i] = index[upper(r)]
+	}
+
+	// Log-odds of every residue in the alphabet. Residues without a NULL
+	// probability are scored against a uniform background.
+	uniform := -math.Log2(float64(len(hmm.Alphabet)))
+	odds := func(ep seq.EProbs) []float64 {
+		scores := make([]float64, len(hmm.Alphabet))
+		for i, r := range hmm.Alphabet {
+			null := uniform
+			if hmm.Null.Probs != nil && !hmm.Null.Lookup(r).IsMin() {
+				null = float64(hmm.Null.Lookup(r))
+			}
+			if ep.Probs == nil {
+				scores[i] = 0
+			} else {
+				scores[i] = logProb(ep.Lookup(r)) - null
+			}
+		}
+		return scores
+	}
+	// Residues that aren't in the alphabet (e.g., 'X') are scored as if
+	// they were emitted by the NULL model.
+	perResidue := func(scores []float64) []float64 {
+		row := make([]float64, s.Len())
+		for i, a := range residues {
+			if a >= 0 {
+				row[i] = scores[a]
+			}
+		}
+		return row
+	}
+
+	m := len(hmm.Nodes)
+	sc := &scorer{
+		mode:    mode,
+		m:       m,
+		residue: s.Residues,
+		trans:   nodeTransitions(hmm, p.Begin),
+		mat:     make([][]float64, m+1),
+		ins:     make([][]float64, m+1),
+		entry:   math.Log2(2.0 / float64(m*(m+1))),
+	}
+	sc.ins[0] = perResidue(odds(p.Begin.InsEmit))
+	for k, node := range hmm.Nodes {
+		sc.mat[k+1] = perResidue(odds(node.MatEmit))
+		sc.ins[k+1] = perResidue(odds(node.InsEmit))
+	}
+	return sc, nil
+}
+
+// nodeTransitions returns the transitions of every node indexed by node
+// number, where node 0 is the begin state.
+func nodeTransitions(hmm *seq.HMM, begin BeginState) []seq.TProbs {
+	trans := make([]seq.TProbs, len(hmm.Nodes)+1)
+	trans[0] = begin.Transitions
+	if trans[0] == (seq.TProbs{}) {
+		// An absent begin state always goes to the first match state.
+		trans[0] = seq.TProbs{
+			MM: 0, MI: seq.MinProb, MD: seq.MinProb,
+			IM: seq.MinProb, II: seq.MinProb,
+			DM: seq.MinProb, DD: seq.MinProb,
+		}
+	}
+	for k, node := range hmm.Nodes {
+		trans[k+1] = node.Transitions
+	}
+	return trans
+}
+
+// logProb converts a probability to a float with negative infinity for a
+// probability of zero.
+func logProb(p seq.Prob) float64 {
+	if p.IsMin() {
+		return negInf
+	}
+	return float64(p)
+}
+
+// table is a dynamic programming table indexed by residue (from 0 to L, where
+// 0 means no residues have been emitted) and node number.
+type table [][]float64
+
+func newTable(rows, cols int) table {
+	tab := make(table, rows)
+	for i := range tab {
+		tab[i] = make([]float64, cols)
+		for k := range tab[i] {
+			tab[i][k] = negInf
+		}
+	}
+	return tab
+}
+
+// combine is either max (for Viterbi) or a log sum (for Forward/Backward).
+type combine func(scores ...float64) float64
+
+func maxScore(scores ...float64) float64 {
+	best := negInf
+	for _, s := range scores {
+		if s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+func logSum(scores ...float64) float64 {
+	best := maxScore(scores...)
+	if math.IsInf(best, -1) {
+		return best
+	}
+	sum := 0.0
+	for _, s := range scores {
+		sum += math.Exp2(s - best)
+	}
+	return best + math.Log2(sum)
+}
+
+// forward fills in the match, insert and delete tables with either Viterbi
+// or Forward scores. The begin state has a score of 0 at every position in
+// the sequence.
+func (sc *scorer) forward(comb combine) (mat, ins, del table) {
+	L, m, tr := len(sc.residue), sc.m, sc.trans
+	mat, ins, del = newTable(L+1, m+1), newTable(L+1, m+1), newTable(L+1, m+1)
+	glocal := sc.mode == Glocal
+	for i := 0; i <= L; i++ {
+		for k := 0; k <= m; k++ {
+			if i > 0 && k > 0 {
+				begin := negInf
+				if glocal && k == 1 {
+					begin = logProb(tr[0].MM)
+				} else if !glocal {
+					begin = sc.entry
+				}
+				prev := negInf
+				if k > 1 || glocal {
+					prev = comb(
+						mat[i-1][k-1]+logProb(tr[k-1].MM),
+						ins[i-1][k-1]+logProb(tr[k-1].IM),
+						del[i-1][k-1]+logProb(tr[k-1].DM))
+				}
+				mat[i][k] = sc.mat[k][i-1] + comb(begin, prev)
+			}
+			if i > 0 && k < m && (k > 0 || glocal) {
+				from := mat[i-1][k] + logProb(tr[k].MI)
+				if k == 0 {
+					from = logProb(tr[0].MI)
+				}
+				extend := ins[i-1][k] + logProb(tr[k].II)
+				ins[i][k] = sc.ins[k][i-1] + comb(from, extend)
+			}
+			if k == 1 && glocal {
+				del[i][k] = logProb(tr[0].MD)
+			} else if k > 1 {
+				del[i][k] = comb(
+					mat[i][k-1]+logProb(tr[k-1].MD),
+					del[i][k-1]+logProb(tr[k-1].DD))
+			}
+		}
+	}
+	return
+}
+
+// end returns the score of ending an alignment in the given state and node.
+func (sc *scorer) end(state seq.HMMState, k int) float64 {
+	switch {
+	case sc.mode == Glocal && k == sc.m && state != seq.Insertion:
+		return 0
+	case sc.mode == Local && state == seq.Match:
+		return 0
+	}
+	return negInf
+}
+
+// Viterbi finds the most probable alignment of the sequence to the profile.
+// An error is returned if the profile or sequence is empty, or if there is no
+// possible alignment.
+func (p *Profile) Viterbi(s seq.Sequence, mode AlignMode) (*Alignment, error) {
+	sc, err := newScorer(p, s, mode)
+	if err != nil {
+		return nil, err
+	}
+	mat, ins, del := sc.forward(maxScore)
+
+	// Find the best end state.
+	best := PathState{}
+	score := negInf
+	for i := 0; i < len(mat); i++ {
+		for k := 1; k <= sc.m; k++ {
+			if v := mat[i][k] + sc.end(seq.Match, k); i > 0 && v > score {
+				best, score = PathState{seq.Match, k, i}, v
+			}
+			if v := del[i][k] + sc.end(seq.Deletion, k); v > score {
+				best, score = PathState{seq.Deletion, k, i}, v
+			}
+		}
+	}
+	if math.IsInf(score, -1) {
+		return nil, fmt.Errorf("There is no %s alignment of '%s' to '%s'.",
+			mode, s.Name, p.Name)
+	}
+
+	path := sc.traceback(best, mat, ins, del)
+	aln := &Alignment{Score: score, Path: path}
+	aln.NodeStart, aln.NodeEnd = sc.m, 0
+	aln.SeqStart, aln.SeqEnd = len(sc.residue), 0
+	for _, ps := range path {
+		if ps.Node > 0 && ps.State != seq.Insertion {
+			aln.NodeStart = minInt(aln.NodeStart, ps.Node)
+			aln.NodeEnd = maxInt(aln.NodeEnd, ps.Node)
+		}
+		if ps.Residue > 0 {
+			aln.SeqStart = minInt(aln.SeqStart, ps.Residue)
+			aln.SeqEnd = maxInt(aln.SeqEnd, ps.Residue)
+		}
+	}
+	aln.MSA = p.pathMSA(s, path)
+	return aln, nil
+}
+
+// traceback follows the Viterbi tables backwards from the last state of an
+// alignment. Residue in the PathState values is used as the table row.
+func (sc *scorer) traceback(last PathState, mat, ins, del table) []PathState {
+	const eps = 1e-9
+	tr, glocal := sc.trans, sc.mode == Glocal
+	is := func(a, b float64) bool {
+		return !math.IsInf(a, -1) && math.Abs(a-b) < eps
+	}
+
+	path := make([]PathState, 0, sc.m+len(sc.residue))
+	cur := last
+	for {
+		i, k := cur.Residue, cur.Node
+		ps := cur
+		if cur.State == seq.Deletion {
+			ps.Residue = 0
+		}
+		path = append(path, ps)
+
+		var v float64
+		switch cur.State {
+		case seq.Match:
+			v = mat[i][k] - sc.mat[k][i-1]
+			switch {
+			case glocal && k == 1 && is(logProb(tr[0].MM), v):
+				return reversePath(path)
+			case !glocal && is(sc.entry, v):
+				return reversePath(path)
+			case is(mat[i-1][k-1]+logProb(tr[k-1].MM), v):
+				cur = PathState{seq.Match, k - 1, i - 1}
+			case is(ins[i-1][k-1]+logProb(tr[k-1].IM), v):
+				cur = PathState{seq.Insertion, k - 1, i - 1}
+			default:
+				cur = PathState{seq.Deletion, k - 1, i - 1}
+			}
+		case seq.Insertion:
+			v = ins[i][k] - sc.ins[k][i-1]
+			switch {
+			case k == 0:
+				if is(logProb(tr[0].MI), v) {
+					return reversePath(path)
+				}
+				cur = PathState{seq.Insertion, 0, i - 1}
+			case is(mat[i-1][k]+logProb(tr[k].MI), v):
+				cur = PathState{seq.Match, k, i - 1}
+			default:
+				cur = PathState{seq.Insertion, k, i - 1}
+			}
+		case seq.Deletion:
+			v = del[i][k]
+			switch {
+			case k == 1:
+				return reversePath(path)
+			case is(mat[i][k-1]+logProb(tr[k-1].MD), v):
+				cur = PathState{seq.Match, k - 1, i}
+			default:
+				cur = PathState{seq.Deletion, k - 1, i}
+			}
+		}
+	}
+}
+
+func reversePath(path []PathState) []PathState {
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// pathMSA builds a two row A2M alignment from a path.
+func (p *Profile) pathMSA(s seq.Sequence, path []PathState) seq.MSA {
+	prow := make([]seq.Residue, len(path))
+	srow := make([]seq.Residue, len(path))
+	for i, ps := range path {
+		switch ps.State {
+		case seq.Match:
+			prow[i] = p.HMM.Nodes[ps.Node-1].Residue
+			srow[i] = upper(s.Residues[ps.Residue-1])
+		case seq.Deletion:
+			prow[i] = p.HMM.Nodes[ps.Node-1].Residue
+			srow[i] = '-'
+		case seq.Insertion:
+			prow[i] = '-'
+			srow[i] = lower(s.Residues[ps.Residue-1])
+		}
+	}
+	msa := seq.NewMSA()
+	msa.AddFasta(seq.Sequence{Name: p.Name, Residues: prow})
+	msa.AddFasta(seq.Sequence{Name: s.Name, Residues: srow})
+	return msa
+}
+
+// Posterior computes the Forward and Backward scores of the sequence and the
+// posterior probability of each residue being emitted by each match and
+// insertion state.
+func (p *Profile) Posterior(
+	s seq.Sequence,
+	mode AlignMode,
+) (*Posterior, error) {
+	sc, err := newScorer(p, s, mode)
+	if err != nil {
+		return nil, err
+	}
+	L, m := len(sc.residue), sc.m
+	fmat, fins, fdel := sc.forward(logSum)
+	bmat, bins, _, begin := sc.backward()
+
+	fwdEnds := make([]float64, 0, 2*(L+1)*m)
+	for i := 0; i <= L; i++ {
+		for k := 1; k <= m; k++ {
+			if i > 0 {
+				fwdEnds = append(fwdEnds, fmat[i][k]+sc.end(seq.Match, k))
+			}
+			fwdEnds = append(fwdEnds, fdel[i][k]+sc.end(seq.Deletion, k))
+		}
+	}
+	post := &Posterior{
+		Forward:  logSum(fwdEnds...),
+		Backward: logSum(begin...),
+		Match:    make([][]float64, L),
+		Insert:   make([][]float64, L),
+	}
+	if math.IsInf(post.Forward, -1) {
+		return nil, fmt.Errorf("There is no %s alignment of '%s' to '%s'.",
+			mode, s.Name, p.Name)
+	}
+	for i := 1; i <= L; i++ {
+		post.Match[i-1] = make([]float64, m+1)
+		post.Insert[i-1] = make([]float64, m+1)
+		for k := 0; k <= m; k++ {
+			if k > 0 {
+				post.Match[i-1][k] = math.Exp2(
+					fmat[i][k] + bmat[i][k] - post.Forward)
+			}
+			post.Insert[i-1][k] = math.Exp2(
+				fins[i][k] + bins[i][k] - post.Forward)
+		}
+	}
+	return post, nil
+}
+
+// backward fills in the Backward tables, which exclude the emission of the
+// current state. It also returns the Backward score of beginning an alignment
+// before each residue (and after the last one).
+func (sc *scorer) backward() (mat, ins, del table, begin []float64) {
+	L, m, tr := len(sc.residue), sc.m, sc.trans
+	mat, ins, del = newTable(L+1, m+1), newTable(L+1, m+1), newTable(L+1, m+1)
+	glocal := sc.mode == Glocal
+
+	// next returns the score of emitting residue i+1 in the match or
+	// insertion state of node k, and then continuing.
+	nextMatch := func(i, k int) float64 {
+		if i >= L || k > m {
+			return negInf
+		}
+		return sc.mat[k][i] + mat[i+1][k]
+	}
+	nextIns := func(i, k int) float64 {
+		if i >= L || k >= m || (k == 0 && !glocal) {
+			return negInf
+		}
+		return sc.ins[k][i] + ins[i+1][k]
+	}
+	for i := L; i >= 0; i-- {
+		for k := m; k >= 0; k-- {
+			nextDel := negInf
+			if k < m {
+				nextDel = del[i][k+1]
+			}
+			if k > 0 {
+				mat[i][k] = logSum(
+					sc.end(seq.Match, k),
+					logProb(tr[k].MM)+nextMatch(i, k+1),
+					logProb(tr[k].MI)+nextIns(i, k),
+					logProb(tr[k].MD)+nextDel)
+				del[i][k] = logSum(
+					sc.end(seq.Deletion, k),
+					logProb(tr[k].DM)+nextMatch(i, k+1),
+					logProb(tr[k].DD)+nextDel)
+			}
+			if k < m && (k > 0 || glocal) {
+				ins[i][k] = logSum(
+					logProb(tr[k].IM)+nextMatch(i, k+1),
+					logProb(tr[k].II)+nextIns(i, k))
+			}
+		}
+	}
+
+	begin = make([]float64, 0, L+1)
+	for i := 0; i <= L; i++ {
+		if glocal {
+			begin = append(begin, logSum(
+				logProb(tr[0].MM)+nextMatch(i, 1),
+				logProb(tr[0].MI)+nextIns(i, 0),
+				logProb(tr[0].MD)+del[i][1]))
+		} else {
+			scores := make([]float64, m)
+			for k := 1; k <= m; k++ {
+				scores[k-1] = sc.entry + nextMatch(i, k)
+			}
+			begin = append(begin, logSum(scores...))
+		}
+	}
+	return
+}
+
+func lower(r seq.Residue) seq.Residue {
+	if r >= 'A' && r <= 'Z' {
+		return r - 'A' + 'a'
+	}
+	return r
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,211 @@
+package hmm
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// The Viterbi score of a serine protease against the full sermam profile.
+// (seq.HMM.ViterbiScore treats probabilities as negative logs, while this
+// package stores them as log_2 probabilities, so it can't score the profiles
+// read here.)
+func ExampleProfile_Viterbi() {
+	query := "IVEGQDAEVGLSPWQVMLFRKSPQELLCGASLISDRWVLTAAHCLLYPPWDKNFTVDDLLVR" +
+		"IGKHSRTRYERKVEKISMLDKIYIHPRYNWKENLDRDIALLKLKRPIELSDYIHPVCLPDKQTAAKL" +
+		"LHAGFKGRVTGWGNRRETWTTSVAEVQPSVLQVVNLPLVERPVCKASTRIRITDNMFCAGYKPGEGK" +
+		"RGDACEGDSGGPFVMKSPYNNRWYQMGIVSWGEGCDRDGKYGFYTHVFRLKKWIQKVIDRLGS"
+	squery := seq.NewSequenceString("query", query)
+
+	hmmf, err := os.Open("sermam.hmm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hmmf.Close()
+
+	profile, err := ReadHMM(hmmf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	aln, err := profile.Profile().Viterbi(squery, Local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%.2f %d-%d %d-%d\n", aln.Score,
+		aln.SeqStart, aln.SeqEnd, aln.NodeStart, aln.NodeEnd)
+	// Output:
+	// 272.70 1-256 1-233
+}
+
+func ExampleProfile_Viterbi_glocal() {
+	hmmf, err := os.Open("sermam6.hmm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hmmf.Close()
+
+	hmm, err := ReadHMM(hmmf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := seq.NewSequenceString("query", "MKKIVGGWEAKK")
+	aln, err := hmm.Profile().Viterbi(s, Glocal)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%.2f %d-%d %d-%d\n", aln.Score,
+		aln.SeqStart, aln.SeqEnd, aln.NodeStart, aln.NodeEnd)
+	for _, row := range aln.MSA.Entries {
+		fmt.Printf("%-8s %s\n", row.Name, row.Residues)
+	}
+	// Output:
+	// 10.70 4-9 1-6
+	// sermam6  IIGGEA
+	// query    IVGGWE
+}
+
+// alignProfiles returns profiles from both an HHM and an HMMER file, with a
+// sequence to align to each.
+func alignProfiles(t *testing.T) ([]*Profile, []seq.Sequence) {
+	hmmf, err := os.Open("sermam6.hmm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer hmmf.Close()
+	hmm, err := ReadHMM(hmmf)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	hhmf, err := os.Open("yal001c.hhm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer hhmf.Close()
+	hhm, err := ReadHHM(hhmf)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	profiles := []*Profile{hmm.Profile(), hhm.Profile()}
+	seqs := []seq.Sequence{
+		seq.NewSequenceString("query", "MKKIVGGWEAKK"),
+		seq.NewSequenceString("query", "AAMVLTIYPDELVKK"),
+	}
+	return profiles, seqs
+}
+
+func TestViterbi(t *testing.T) {
+	profiles, seqs := alignProfiles(t)
+	for i, p := range profiles {
+		m := len(p.HMM.Nodes)
+		glocal, err := p.Viterbi(seqs[i], Glocal)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if glocal.NodeStart != 1 || glocal.NodeEnd != m {
+			t.Fatalf("%s: Glocal alignment covers nodes %d-%d instead of "+
+				"1-%d.", p.Name, glocal.NodeStart, glocal.NodeEnd, m)
+		}
+		if err := checkPath(glocal.Path, m); err != nil {
+			t.Fatalf("%s: %s", p.Name, err)
+		}
+
+		local, err := p.Viterbi(seqs[i], Local)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if err := checkPath(local.Path, m); err != nil {
+			t.Fatalf("%s: %s", p.Name, err)
+		}
+		if local.Path[0].State != seq.Match {
+			t.Fatalf("%s: Local alignment starts with state %d.",
+				p.Name, local.Path[0].State)
+		}
+
+		rows := local.MSA.Entries
+		if len(rows) != 2 || len(rows[0].Residues) != len(rows[1].Residues) {
+			t.Fatalf("%s: Expected a two row MSA.", p.Name)
+		}
+	}
+
+	if _, err := profiles[0].Viterbi(seq.Sequence{}, Local); err == nil {
+		t.Fatalf("Expected an error for an empty sequence.")
+	}
+}
+
+// checkPath makes sure that a path emits consecutive residues and visits
+// consecutive nodes.
+func checkPath(path []PathState, m int) error {
+	lastRes, lastNode := 0, path[0].Node-1
+	if path[0].State == seq.Insertion {
+		lastNode++
+	}
+	for _, ps := range path {
+		if ps.Node < 0 || ps.Node > m {
+			return fmt.Errorf("Node %d out of range.", ps.Node)
+		}
+		if ps.State == seq.Insertion {
+			if ps.Node != lastNode {
+				return fmt.Errorf("Insertion at node %d after node %d.",
+					ps.Node, lastNode)
+			}
+		} else {
+			if ps.Node != lastNode+1 {
+				return fmt.Errorf("Node %d after node %d.", ps.Node, lastNode)
+			}
+			lastNode = ps.Node
+		}
+		if ps.State == seq.Deletion {
+			if ps.Residue != 0 {
+				return fmt.Errorf("Deletion emitted residue %d.", ps.Residue)
+			}
+			continue
+		}
+		if lastRes > 0 && ps.Residue != lastRes+1 {
+			return fmt.Errorf("Residue %d after residue %d.",
+				ps.Residue, lastRes)
+		}
+		lastRes = ps.Residue
+	}
+	return nil
+}
+
+func TestPosterior(t *testing.T) {
+	profiles, seqs := alignProfiles(t)
+	for i, p := range profiles {
+		for _, mode := range []AlignMode{Local, Glocal} {
+			post, err := p.Posterior(seqs[i], mode)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if math.Abs(post.Forward-post.Backward) > 1e-6 {
+				t.Fatalf("%s (%s): Forward %f != Backward %f.",
+					p.Name, mode, post.Forward, post.Backward)
+			}
+			aln, err := p.Viterbi(seqs[i], mode)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if post.Forward < aln.Score-1e-6 {
+				t.Fatalf("%s (%s): Forward %f < Viterbi %f.",
+					p.Name, mode, post.Forward, aln.Score)
+			}
+			for r := range post.Match {
+				sum := 0.0
+				for k := range post.Match[r] {
+					sum += post.Match[r][k] + post.Insert[r][k]
+				}
+				if sum > 1+1e-6 {
+					t.Fatalf("%s (%s): Posteriors of residue %d sum to %f.",
+						p.Name, mode, r+1, sum)
+				}
+			}
+		}
+	}
+}
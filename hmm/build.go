@@ -0,0 +1,558 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// hhsuiteAlphabet is the order of residues used in hhm files.
+var hhsuiteAlphabet = seq.NewAlphabet(
+	'A', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'K', 'L',
+	'M', 'N', 'P', 'Q', 'R', 'S', 'T', 'V', 'W', 'Y',
+)
+
+// hhsuiteNull is the NULL line written by hhmake, in the order of
+// hhsuiteAlphabet. Each value is -1000 * log_2(p).
+var hhsuiteNull = []int{
+	3706, 5728, 4211, 4064, 4839, 3729, 4763, 4308, 4069, 3323,
+	5509, 4640, 4464, 4937, 4285, 4423, 3815, 3783, 6325, 4665,
+}
+
+// PseudocountMode determines how amino acid pseudocounts are added to the
+// match emissions of a profile built by BuildHHM.
+type PseudocountMode int
+
+const (
+	// NoPseudocounts uses the weighted residue frequencies of each column
+	// as they are.
+	NoPseudocounts PseudocountMode = iota
+
+	// SubstitutionPseudocounts mixes the frequencies of each column with
+	// the residues that are likely substitutions of them according to
+	// BLOSUM62. (This is the substitution matrix mode of HHsuite.)
+	SubstitutionPseudocounts
+
+	// BackgroundPseudocounts mixes the frequencies of each column with the
+	// background frequencies (i.e., the NULL emissions). This mode is
+	// context-free: every column gets the same pseudocounts.
+	BackgroundPseudocounts
+)
+
+// BuildOptions control how BuildHHM estimates a profile.
+type BuildOptions struct {
+	// The NAME and COM of the HHM. If Name is empty, the name of the first
+	// sequence in the alignment is used.
+	Name, Com string
+
+	// Sequences that have a greater percent identity than MaxIdentity with
+	// a sequence earlier in the alignment are removed before the profile
+	// is estimated. The first sequence is never removed. Filtering is
+	// disabled when MaxIdentity is zero or at least 100.
+	MaxIdentity float64
+
+	// The kind of pseudocounts added to the match emissions.
+	Pseudocounts PseudocountMode
+
+	// The admixture of pseudocounts in a column with diversity Neff is
+	// PCA / (1 + (Neff / PCB)^PCC), as in HHsuite.
+	PCA, PCB, PCC float64
+
+	// The weight (in effective sequences) of the prior transition
+	// probabilities.
+	TransitionPseudocount float64
+}
+
+// DefaultBuildOptions are the options used by hhmake when it is not using
+// context-specific pseudocounts.
+var DefaultBuildOptions = BuildOptions{
+	MaxIdentity:           90,
+	Pseudocounts:          SubstitutionPseudocounts,
+	PCA:                   1.0,
+	PCB:                   1.5,
+	PCC:                   1.0,
+	TransitionPseudocount: 1.0,
+}
+
+// priorTransitions are the transition probabilities that are mixed into
+// the observed transitions of every node.
+var priorTransitions = struct{ MM, MI, MD, IM, II, DM, DD float64 }{
+	MM: 0.9, MI: 0.05, MD: 0.05,
+	IM: 0.25, II: 0.75,
+	DM: 0.25, DD: 0.75,
+}
+
+// BuildHHM estimates an HHM from a multiple sequence alignment in A2M format.
+// (i.e., the match columns are the columns with upper case residues and '-'
+// gaps, and the insert columns are the columns with lower case residues and
+// '.' gaps.) Only the 20 standard amino acids are counted.
+//
+// Entries named "ss_dssp", "sa_dssp", "ss_pred" or "ss_conf" are not
+// treated as sequences. Instead, their match columns become the secondary
+// structure of the HHM. An entry named "Consensus" is ignored, and a new
+// consensus sequence is computed.
+//
+// Sequences are weighted with position-based (Henikoff) weights. The NeffM of
+// each node is the exponential of the entropy of its weighted match
+// frequencies, and the Neff of the HHM is the average NeffM. NeffI and NeffD
+// are the effective number of sequences in the insertion and deletion state
+// of each node, computed from their weights. Transitions are estimated from
+// the weighted counts of sequences moving between states, mixed with a
+// fixed prior. Gaps at the start and end of a sequence are not counted as
+// deletions. Like all HHMs, the insertion emissions are the NULL emissions.
+func BuildHHM(msa seq.MSA, opts BuildOptions) (*HHM, error) {
+	secondary := HHMSecondary{}
+	entries := make([]seq.Sequence, 0, len(msa.Entries))
+	for _, s := range msa.Entries {
+		switch {
+		case strings.HasPrefix(s.Name, "ss_dssp"):
+			secondary.SSdssp = matchColumns(s)
+		case strings.HasPrefix(s.Name, "sa_dssp"):
+			secondary.SAdssp = matchColumns(s)
+		case strings.HasPrefix(s.Name, "ss_pred"):
+			secondary.SSpred = matchColumns(s)
+		case strings.HasPrefix(s.Name, "ss_conf"):
+			secondary.SSconf = matchColumns(s)
+		case strings.HasPrefix(s.Name, "Consensus"):
+		default:
+			entries = append(entries, s)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("Cannot build an HHM without sequences.")
+	}
+
+	// Split each sequence into its match columns and the number of
+	// residues inserted after each match column. (Index 0 of the inserts
+	// is before the first match column.)
+	isMatch := func(r seq.Residue) bool {
+		return r == '-' || (r >= 'A' && r <= 'Z')
+	}
+	ncols := 0
+	for _, r := range entries[0].Residues {
+		if isMatch(r) {
+			ncols++
+		}
+	}
+	if ncols == 0 {
+		return nil, fmt.Errorf("Cannot build an HHM without match columns.")
+	}
+	matches := make([][]seq.Residue, len(entries))
+	inserts := make([][]int, len(entries))
+	for i, s := range entries {
+		matches[i] = make([]seq.Residue, 0, ncols)
+		inserts[i] = make([]int, ncols+1)
+		for _, r := range s.Residues {
+			switch {
+			case isMatch(r):
+				matches[i] = append(matches[i], r)
+			case r != '.':
+				inserts[i][len(matches[i])]++
+			}
+		}
+		if len(matches[i]) != ncols {
+			return nil, fmt.Errorf("Sequence '%s' has %d match columns, but "+
+				"the first sequence has %d.", s.Name, len(matches[i]), ncols)
+		}
+	}
+
+	kept := filterIdentity(matches, opts.MaxIdentity)
+	weights := henikoffWeights(matches, kept)
+	index := hhsuiteAlphabet.Index()
+	inAlphabet := func(r seq.Residue) bool {
+		return index[r] > 0 || r == hhsuiteAlphabet[0]
+	}
+	background := make([]float64, len(hhsuiteAlphabet))
+	null := seq.NewEProbs(hhsuiteAlphabet)
+	for a, r := range hhsuiteAlphabet {
+		background[a] = math.Exp2(-float64(hhsuiteNull[a]) / hmmScale)
+		null.Set(r, seq.Prob(-float64(hhsuiteNull[a])/hmmScale))
+	}
+
+	nodes := make([]seq.HMMNode, ncols)
+	consensus := make([]seq.Residue, ncols)
+	var begin BeginState
+	neffSum := 0.0
+	for k := 0; k <= ncols; k++ {
+		// Count the transitions out of node k of every sequence that is
+		// aligned past it. (Node 0 is the begin state, which only counts
+		// sequences that start at the first match column.)
+		var wMM, wMI, wMD, wIM, wII, wDM, wDD float64
+		var subsetI, subsetD []float64
+		for _, i := range kept {
+			first, last := alignedRange(matches[i])
+			if k >= last || (k < first && !(k == 0 && first == 1)) {
+				continue
+			}
+			w := weights[i]
+			next := matches[i][k] != '-'
+			if k > 0 && matches[i][k-1] == '-' {
+				// Insertions after a deletion have no transition.
+				subsetD = append(subsetD, w)
+				if next {
+					wDM += w
+				} else {
+					wDD += w
+				}
+				continue
+			}
+			if ins := inserts[i][k]; ins > 0 {
+				subsetI = append(subsetI, w)
+				wMI += w
+				wII += w * float64(ins-1)
+				if next {
+					wIM += w
+				}
+				continue
+			}
+			if next {
+				wMM += w
+			} else {
+				wMD += w
+			}
+		}
+
+		var neffM seq.Prob
+		var emit seq.EProbs
+		if k > 0 {
+			freqs := make([]float64, len(hhsuiteAlphabet))
+			total := 0.0
+			for _, i := range kept {
+				if r := matches[i][k-1]; inAlphabet(r) {
+					freqs[index[r]] += weights[i]
+					total += weights[i]
+				}
+			}
+			if total == 0 {
+				copy(freqs, background)
+			} else {
+				for a := range freqs {
+					freqs[a] /= total
+				}
+			}
+			neff := 0.0
+			for _, f := range freqs {
+				if f > 0 {
+					neff -= f * math.Log(f)
+				}
+			}
+			neff = math.Exp(neff)
+			neffSum += neff
+			neffM = seq.Prob(neff)
+
+			probs := addPseudocounts(freqs, background, neff, opts)
+			emit = seq.NewEProbs(hhsuiteAlphabet)
+			best := 0
+			for a, r := range hhsuiteAlphabet {
+				emit.Set(r, log2Prob(probs[a]))
+				if probs[a] > probs[best] {
+					best = a
+				}
+			}
+			consensus[k-1] = consensusResidue(
+				hhsuiteAlphabet[best], freqs[best])
+		}
+
+		mix := func(n, count, total, prior float64) seq.Prob {
+			pc := opts.TransitionPseudocount
+			if total == 0 || n == 0 {
+				if pc == 0 {
+					return log2Prob(0)
+				}
+				return log2Prob(prior)
+			}
+			return log2Prob((n*count/total + pc*prior) / (n + pc))
+		}
+		p := priorTransitions
+		nM, nI, nD := float64(neffM), effectiveNumber(subsetI),
+			effectiveNumber(subsetD)
+		if k == 0 {
+			nM = effectiveNumber(weightsOf(kept, weights))
+		}
+		tp := seq.TProbs{
+			MM: mix(nM, wMM, wMM+wMI+wMD, p.MM),
+			MI: mix(nM, wMI, wMM+wMI+wMD, p.MI),
+			MD: mix(nM, wMD, wMM+wMI+wMD, p.MD),
+			IM: mix(nI, wIM, wIM+wII, p.IM),
+			II: mix(nI, wII, wIM+wII, p.II),
+			DM: mix(nD, wDM, wDM+wDD, p.DM),
+			DD: mix(nD, wDD, wDM+wDD, p.DD),
+		}
+		if k == ncols {
+			// The last node can only go to the end state.
+			tp.MM, tp.MI, tp.MD = 0, seq.MinProb, seq.MinProb
+			tp.DM, tp.DD = 0, seq.MinProb
+		}
+		if k == 0 {
+			begin = BeginState{
+				InsEmit:     null,
+				Transitions: tp,
+				NeffM:       seq.MinProb,
+				NeffI:       seq.MinProb,
+				NeffD:       seq.MinProb,
+			}
+			continue
+		}
+		nodes[k-1] = seq.HMMNode{
+			Residue:     nodeResidue(matches[0][k-1], consensus[k-1]),
+			NodeNum:     k,
+			InsEmit:     null,
+			MatEmit:     emit,
+			Transitions: tp,
+			NeffM:       neffM,
+			NeffI:       seq.Prob(nI),
+			NeffD:       seq.Prob(nD),
+		}
+	}
+
+	name := opts.Name
+	if len(name) == 0 {
+		name = entries[0].Name
+	}
+	secondary.Consensus = &seq.Sequence{Name: "Consensus", Residues: consensus}
+	aligned := seq.NewMSA()
+	aligned.AddSlice(entries)
+	created := time.Now().Truncate(time.Second)
+	hhm := &HHM{
+		Meta: Meta{
+			FormatVersion: "HHsearch 1.5",
+			Name:          name,
+			Com:           opts.Com,
+			Leng: fmt.Sprintf("%d match states, %d columns in multiple "+
+				"alignment", ncols, ncols),
+			MatchStates: ncols,
+			Columns:     ncols,
+			Filt: fmt.Sprintf("%d out of %d sequences passed filter "+
+				"(-id %g)", len(kept), len(entries), opts.MaxIdentity),
+			Filter: Filter{
+				Passed:      len(kept),
+				Total:       len(entries),
+				MaxIdentity: opts.MaxIdentity,
+			},
+			Neff:    seq.Prob(neffSum / float64(ncols)),
+			Pct:     opts.Pseudocounts != NoPseudocounts,
+			Date:    created.Format(time.ANSIC),
+			Created: created,
+		},
+		Secondary: secondary,
+		MSA:       aligned,
+		HMM:       seq.NewHMM(nodes, hhsuiteAlphabet, null),
+		Begin:     begin,
+	}
+	return hhm, nil
+}
+
+// matchColumns returns a sequence with only the match columns of an A2M
+// sequence.
+func matchColumns(s seq.Sequence) *seq.Sequence {
+	residues := make([]seq.Residue, 0, len(s.Residues))
+	for _, r := range s.Residues {
+		if r == '.' || (r >= 'a' && r <= 'z') {
+			continue
+		}
+		residues = append(residues, r)
+	}
+	return &seq.Sequence{Name: s.Name, Residues: residues}
+}
+
+// alignedRange returns the first and last match columns (starting at 1) of a
+// sequence that aren't gaps. If every column is a gap, then first is -1.
+func alignedRange(matches []seq.Residue) (first, last int) {
+	first, last = -1, -1
+	for c, r := range matches {
+		if r == '-' {
+			continue
+		}
+		if first < 0 {
+			first = c + 1
+		}
+		last = c + 1
+	}
+	return
+}
+
+// filterIdentity returns the indices of the sequences that aren't too similar
+// to a sequence earlier in the alignment. Identity is computed over the match
+// columns where both sequences have a residue.
+func filterIdentity(matches [][]seq.Residue, maxIdentity float64) []int {
+	kept := []int{0}
+	if maxIdentity <= 0 || maxIdentity >= 100 {
+		for i := 1; i < len(matches); i++ {
+			kept = append(kept, i)
+		}
+		return kept
+	}
+	for i := 1; i < len(matches); i++ {
+		similar := false
+		for _, j := range kept {
+			same, both := 0, 0
+			for c, r := range matches[i] {
+				if r == '-' || matches[j][c] == '-' {
+					continue
+				}
+				both++
+				if r == matches[j][c] {
+					same++
+				}
+			}
+			if both > 0 && 100*float64(same)/float64(both) > maxIdentity {
+				similar = true
+				break
+			}
+		}
+		if !similar {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// henikoffWeights computes position-based sequence weights for the kept
+// sequences, normalized so that they sum to 1. In each column, each distinct
+// residue gets an equal share of the weight, which is divided equally among
+// the sequences with that residue. Gaps are ignored.
+func henikoffWeights(matches [][]seq.Residue, kept []int) []float64 {
+	weights := make([]float64, len(matches))
+	ncols := len(matches[0])
+	for c := 0; c < ncols; c++ {
+		counts := make(map[seq.Residue]int, 20)
+		for _, i := range kept {
+			if r := matches[i][c]; r != '-' {
+				counts[r]++
+			}
+		}
+		for _, i := range kept {
+			if r := matches[i][c]; r != '-' {
+				weights[i] += 1 / float64(len(counts)*counts[r])
+			}
+		}
+	}
+	total := 0.0
+	for _, i := range kept {
+		total += weights[i]
+	}
+	for _, i := range kept {
+		if total == 0 {
+			weights[i] = 1 / float64(len(kept))
+		} else {
+			weights[i] /= total
+		}
+	}
+	return weights
+}
+
+func weightsOf(kept []int, weights []float64) []float64 {
+	ws := make([]float64, len(kept))
+	for j, i := range kept {
+		ws[j] = weights[i]
+	}
+	return ws
+}
+
+// effectiveNumber returns the effective number of sequences with the given
+// weights, 1 / sum(p^2) where p are the normalized weights. It is zero if
+// there are no sequences.
+func effectiveNumber(weights []float64) float64 {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, w := range weights {
+		sum += (w / total) * (w / total)
+	}
+	return 1 / sum
+}
+
+// addPseudocounts mixes pseudocounts into the frequencies of a column with
+// diversity neff.
+func addPseudocounts(
+	freqs, background []float64,
+	neff float64,
+	opts BuildOptions,
+) []float64 {
+	if opts.Pseudocounts == NoPseudocounts || opts.PCA == 0 {
+		return freqs
+	}
+	tau := opts.PCA
+	if opts.PCB > 0 {
+		tau = opts.PCA / (1 + math.Pow(neff/opts.PCB, opts.PCC))
+	}
+
+	pseudo := background
+	if opts.Pseudocounts == SubstitutionPseudocounts {
+		cond := blosumConditionals(background)
+		pseudo = make([]float64, len(freqs))
+		for a := range pseudo {
+			for b, f := range freqs {
+				pseudo[a] += f * cond[b][a]
+			}
+		}
+	}
+	probs := make([]float64, len(freqs))
+	for a := range probs {
+		probs[a] = (1-tau)*freqs[a] + tau*pseudo[a]
+	}
+	return probs
+}
+
+// blosumConditionals returns P(a | b) for every pair of residues in the hhm
+// alphabet, where cond[b][a] is derived from the BLOSUM62 half-bit scores:
+// P(a | b) is proportional to f(a) * 2^(S(a, b) / 2).
+func blosumConditionals(background []float64) [][]float64 {
+	index := seq.SubstBlosum62.Alphabet.Index()
+	scores := seq.SubstBlosum62.Scores
+	cond := make([][]float64, len(hhsuiteAlphabet))
+	for b, rb := range hhsuiteAlphabet {
+		cond[b] = make([]float64, len(hhsuiteAlphabet))
+		total := 0.0
+		for a, ra := range hhsuiteAlphabet {
+			s := float64(scores[index[rb]][index[ra]])
+			cond[b][a] = background[a] * math.Exp2(s/2)
+			total += cond[b][a]
+		}
+		for a := range cond[b] {
+			cond[b][a] /= total
+		}
+	}
+	return cond
+}
+
+// consensusResidue returns the consensus residue of a column in the style of
+// hhmake: upper case if the most frequent residue has a frequency greater
+// than 0.6, lower case if greater than 0.4 and 'x' otherwise.
+func consensusResidue(r seq.Residue, freq float64) seq.Residue {
+	switch {
+	case freq > 0.6:
+		return r
+	case freq > 0.4:
+		return lower(r)
+	}
+	return 'x'
+}
+
+// nodeResidue returns the residue of the first sequence in a match column,
+// or the consensus residue if it is a gap.
+func nodeResidue(first, consensus seq.Residue) seq.Residue {
+	if first != '-' {
+		return first
+	}
+	if consensus == 'x' {
+		return 'X'
+	}
+	return upper(consensus)
+}
+
+// log2Prob converts a probability to a log_2 probability.
+func log2Prob(p float64) seq.Prob {
+	if p <= 0 {
+		return seq.MinProb
+	}
+	return seq.Prob(math.Log2(p))
+}
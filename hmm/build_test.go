@@ -0,0 +1,121 @@
+package hmm
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/TuftsBCB/io/msa"
+	"github.com/TuftsBCB/seq"
+)
+
+func ExampleBuildHHM() {
+	aligned, err := msa.Read(strings.NewReader(`>query
+MVLTIYPDELV
+>s1
+MLFSCTPYELV
+>s2
+------YDELL
+>s3
+-------DELI
+`))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hhm, err := BuildHHM(aligned, DefaultBuildOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(hhm.Meta.Name, len(hhm.HMM.Nodes))
+	fmt.Println(hhm.Meta.Filt)
+	fmt.Printf("%s\n", hhm.Secondary.Consensus.Residues)
+	// Output:
+	// query 11
+	// 4 out of 4 sequences passed filter (-id 90)
+	// MlltctPdELV
+}
+
+func TestBuildHHM(t *testing.T) {
+	hhm := readHHMFile(t, "yal001c.hhm")
+	opts := DefaultBuildOptions
+	opts.Name = "yal001c"
+	built, err := BuildHHM(hhm.MSA, opts)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(built.HMM.Nodes) != len(hhm.HMM.Nodes) {
+		t.Fatalf("Expected %d nodes but got %d.",
+			len(hhm.HMM.Nodes), len(built.HMM.Nodes))
+	}
+	for k, node := range built.HMM.Nodes {
+		if node.Residue != hhm.HMM.Nodes[k].Residue {
+			t.Fatalf("Node %d has residue %c but expected %c.",
+				k+1, node.Residue, hhm.HMM.Nodes[k].Residue)
+		}
+		sum := 0.0
+		for _, r := range built.HMM.Alphabet {
+			sum += math.Exp2(float64(node.MatEmit.Lookup(r)))
+		}
+		if math.Abs(sum-1) > 1e-6 {
+			t.Fatalf("Match emissions of node %d sum to %f.", k+1, sum)
+		}
+		tp := node.Transitions
+		sum = math.Exp2(float64(tp.MM)) + math.Exp2(float64(tp.MI))
+		if tp.MD != seq.MinProb {
+			sum += math.Exp2(float64(tp.MD))
+		}
+		if k < len(built.HMM.Nodes)-1 && math.Abs(sum-1) > 1e-6 {
+			t.Fatalf("Match transitions of node %d sum to %f.", k+1, sum)
+		}
+	}
+	if built.Meta.Neff < 1 || built.Meta.Neff > 20 {
+		t.Fatalf("Unexpected Neff %f.", built.Meta.Neff)
+	}
+
+	// The profile must survive a round trip through an hhm file.
+	buf := new(bytes.Buffer)
+	if err := WriteHHM(buf, built); err != nil {
+		t.Fatalf("%s", err)
+	}
+	read, err := ReadHHM(buf)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if read.Meta.Name != "yal001c" || len(read.HMM.Nodes) != 240 {
+		t.Fatalf("Round trip produced a different HHM.")
+	}
+	if len(read.MSA.Entries) != len(hhm.MSA.Entries) {
+		t.Fatalf("Expected %d sequences but got %d.",
+			len(hhm.MSA.Entries), len(read.MSA.Entries))
+	}
+}
+
+func TestBuildHHMSecondary(t *testing.T) {
+	aligned, err := msa.Read(strings.NewReader(`>ss_pred
+CCHhhHHEEC
+>query
+MVLtiYPDEL
+>s1
+MLFsc-PYEL
+`))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhm, err := BuildHHM(aligned, DefaultBuildOptions)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if hhm.Meta.Name != "query" || len(hhm.MSA.Entries) != 2 {
+		t.Fatalf("The ss_pred entry was treated as a sequence.")
+	}
+	if got := string(hhm.Secondary.SSpred.Residues); got != "CCHHHEEC" {
+		t.Fatalf("Expected ss_pred 'CCHHHEEC' but got '%s'.", got)
+	}
+	if len(hhm.HMM.Nodes) != 8 || hhm.HMM.Nodes[3].NeffD == 0 {
+		t.Fatalf("Expected a deletion in node 4.")
+	}
+}
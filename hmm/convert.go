@@ -0,0 +1,146 @@
+package hmm
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// HHMToHMM converts an HHM to an HMM that can be written as an HMMER3 file
+// with WriteHMM. Probabilities need no rescaling, since they are stored as
+// log_2 probabilities regardless of the file format. The HHM is not modified.
+//
+// NAME, DESC, COM and DATE are copied. FAM becomes ACC, the total number of
+// sequences on the FILT line becomes NSEQ and NEFF becomes EFFN. (The SEQ
+// section only holds a few display sequences, so it says nothing about the
+// size of the alignment. Without a FILT line, NSEQ is omitted. NEFF is the
+// diversity of the alignment while EFFN is the effective number of
+// sequences, so they are only roughly comparable.) Every node's residue is
+// used as its consensus residue.
+//
+// The following cannot be represented in an HMMER file and are lost: the
+// secondary structure and multiple sequence alignment, FILE, FILT, EVD, PCT,
+// the NULL emissions (HMMER uses a fixed background) and the diversity
+// values of every node and the begin state. Since hhm files have no insertion
+// emissions, the insertion emissions of the HMM are the NULL emissions. The
+// HMM has no E-value parameters (STATS lines), so HMMER's hmmsearch will
+// refuse it until it is recalibrated. (e.g., with hmmbuild.)
+func HHMToHMM(hhm *HHM) *HMM {
+	meta := Meta{
+		FormatVersion: defaultHMMERVersion,
+		Name:          hhm.Meta.Name,
+		Acc:           hhm.Meta.Fam,
+		Desc:          hhm.Meta.Desc,
+		Com:           hhm.Meta.Com,
+		Date:          hhm.Meta.Date,
+		Created:       hhm.Meta.Created,
+		Leng:          strconv.Itoa(len(hhm.HMM.Nodes)),
+		Alph:          "amino",
+		Cons:          true,
+		NSeq:          hhm.Meta.Filter.Total,
+		EffN:          float64(hhm.Meta.Neff),
+	}
+	null := hhm.HMM.Null
+	nodes := make([]seq.HMMNode, len(hhm.HMM.Nodes))
+	for i, node := range hhm.HMM.Nodes {
+		nodes[i] = seq.HMMNode{
+			Residue:     node.Residue,
+			NodeNum:     node.NodeNum,
+			InsEmit:     copyEProbs(null),
+			MatEmit:     copyEProbs(node.MatEmit),
+			Transitions: node.Transitions,
+		}
+	}
+	return &HMM{
+		Meta: meta,
+		HMM:  seq.NewHMM(nodes, hhm.HMM.Alphabet, copyEProbs(null)),
+		Begin: BeginState{
+			InsEmit:     copyEProbs(null),
+			Transitions: hhm.Begin.Transitions,
+		},
+	}
+}
+
+// HMMToHHM converts an HMM read from an HMMER file to an HHM that can be
+// written as an hhm file with WriteHHM. The HMM is not modified.
+//
+// NAME, DESC, COM and DATE are copied, ACC becomes FAM and EFFN becomes NEFF.
+// (See HHMToHMM.) Since HMMER files have no per node diversity values, the
+// NeffM of every node is NEFF and NeffI and NeffD are zero. The MSA of the HHM
+// has one sequence made of the residue of every node, and the consensus
+// annotations (if any) become the consensus sequence. PCT is set, since
+// HMMER's emissions include its priors.
+//
+// The following cannot be represented in an hhm file and are lost: the
+// insertion emissions (hhm files use the NULL emissions instead), the node
+// annotations other than the consensus residue, the COMPO line, the E-value
+// parameters and all other HMMER specific header fields (e.g., MAXL, CKSUM
+// and the Pfam cutoffs).
+func HMMToHHM(hmm *HMM) *HHM {
+	neff := seq.Prob(hmm.Meta.EffN)
+	meta := Meta{
+		FormatVersion: "HHsearch 1.5",
+		Name:          hmm.Meta.Name,
+		Fam:           hmm.Meta.Acc,
+		Desc:          hmm.Meta.Desc,
+		Com:           hmm.Meta.Com,
+		Date:          hmm.Meta.Date,
+		Created:       hmm.Meta.Created,
+		Leng: fmt.Sprintf("%d match states, %d columns in multiple "+
+			"alignment", len(hmm.HMM.Nodes), len(hmm.HMM.Nodes)),
+		MatchStates: len(hmm.HMM.Nodes),
+		Columns:     len(hmm.HMM.Nodes),
+		Neff:        neff,
+		Pct:         true,
+	}
+	null := hmm.HMM.Null
+	nodes := make([]seq.HMMNode, len(hmm.HMM.Nodes))
+	residues := make([]seq.Residue, len(hmm.HMM.Nodes))
+	for i, node := range hmm.HMM.Nodes {
+		nodes[i] = seq.HMMNode{
+			Residue:     node.Residue,
+			NodeNum:     node.NodeNum,
+			InsEmit:     copyEProbs(null),
+			MatEmit:     copyEProbs(node.MatEmit),
+			Transitions: node.Transitions,
+			NeffM:       neff,
+		}
+		residues[i] = node.Residue
+	}
+
+	var secondary HHMSecondary
+	if hmm.Meta.Cons && len(hmm.Annotations) == len(nodes) {
+		cons := make([]seq.Residue, len(nodes))
+		for i, annotation := range hmm.Annotations {
+			cons[i] = annotation.Cons
+		}
+		secondary.Consensus = &seq.Sequence{
+			Name:     "Consensus",
+			Residues: cons,
+		}
+	}
+	msa := seq.NewMSA()
+	msa.AddFasta(seq.Sequence{Name: meta.Name, Residues: residues})
+	return &HHM{
+		Meta:      meta,
+		Secondary: secondary,
+		MSA:       msa,
+		HMM:       seq.NewHMM(nodes, hmm.HMM.Alphabet, copyEProbs(null)),
+		Begin: BeginState{
+			InsEmit:     copyEProbs(null),
+			Transitions: hmm.Begin.Transitions,
+			NeffM:       seq.MinProb,
+			NeffI:       seq.MinProb,
+			NeffD:       seq.MinProb,
+		},
+	}
+}
+
+// copyEProbs returns a copy of the given emissions, so that the HMMs returned
+// by the conversions share no emissions with their input or among their nodes.
+func copyEProbs(ep seq.EProbs) seq.EProbs {
+	probs := make([]seq.Prob, len(ep.Probs))
+	copy(probs, ep.Probs)
+	return seq.EProbs{Offset: ep.Offset, Probs: probs}
+}
@@ -0,0 +1,147 @@
+package hmm
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// sameProb returns true if two log_2 probabilities are within the precision
+// of an hhm file.
+func sameProb(p1, p2 seq.Prob) bool {
+	if p1.IsMin() || p2.IsMin() {
+		return p1.IsMin() && p2.IsMin()
+	}
+	return math.Abs(float64(p1-p2)) <= 0.001
+}
+
+// sameNodes reports the first node whose match emissions or transitions
+// differ between two HMMs, or 0 if they are the same.
+func sameNodes(hmm1, hmm2 *seq.HMM) int {
+	if len(hmm1.Nodes) != len(hmm2.Nodes) {
+		return -1
+	}
+	for i := range hmm1.Nodes {
+		n1, n2 := hmm1.Nodes[i], hmm2.Nodes[i]
+		for _, r := range hmm1.Alphabet {
+			if !sameProb(n1.MatEmit.Lookup(r), n2.MatEmit.Lookup(r)) {
+				return i + 1
+			}
+		}
+		t1, t2 := n1.Transitions, n2.Transitions
+		for _, p := range [][2]seq.Prob{
+			{t1.MM, t2.MM}, {t1.MI, t2.MI}, {t1.MD, t2.MD},
+			{t1.IM, t2.IM}, {t1.II, t2.II}, {t1.DM, t2.DM}, {t1.DD, t2.DD},
+		} {
+			if !sameProb(p[0], p[1]) {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+func TestHHMToHMM(t *testing.T) {
+	hhm := readHHMFile(t, "yal001c.hhm")
+	buf := new(bytes.Buffer)
+	if err := WriteHMM(buf, HHMToHMM(hhm)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	hmm, err := ReadHMM(buf)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if hmm.Meta.Name != hhm.Meta.Name {
+		t.Fatalf("Expected name '%s' but got '%s'.",
+			hhm.Meta.Name, hmm.Meta.Name)
+	}
+	if math.Abs(hmm.Meta.EffN-float64(hhm.Meta.Neff)) > 1e-5 {
+		t.Fatalf("Expected EFFN %f but got %f.", hhm.Meta.Neff, hmm.Meta.EffN)
+	}
+	if hmm.Meta.NSeq != 78 {
+		t.Fatalf("Expected NSEQ 78 but got %d.", hmm.Meta.NSeq)
+	}
+	hhm.Meta.Filter = Filter{}
+	if nseq := HHMToHMM(hhm).Meta.NSeq; nseq != 0 {
+		t.Fatalf("Expected NSEQ 0 without a FILT line but got %d.", nseq)
+	}
+	if node := sameNodes(hhm.HMM, hmm.HMM); node != 0 {
+		t.Fatalf("Node %d changed after conversion to HMMER.", node)
+	}
+}
+
+func TestHMMToHHM(t *testing.T) {
+	f, err := os.Open("sermam6.hmm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer f.Close()
+	hmm, err := ReadHMM(f)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteHHM(buf, HMMToHHM(hmm)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhm, err := ReadHHM(buf)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if hhm.Meta.Name != hmm.Meta.Name || hhm.Meta.Fam != hmm.Meta.Acc {
+		t.Fatalf("Name or accession was not kept: %#v", hhm.Meta)
+	}
+	if node := sameNodes(hmm.HMM, hhm.HMM); node != 0 {
+		t.Fatalf("Node %d changed after conversion to HHM.", node)
+	}
+	cons := hhm.Secondary.Consensus
+	if cons == nil || cons.Len() != len(hmm.HMM.Nodes) {
+		t.Fatalf("Consensus annotations were not kept.")
+	}
+
+	// Converting back to HMMER keeps the accession.
+	back := HHMToHMM(hhm)
+	if back.Meta.Acc != hmm.Meta.Acc {
+		t.Fatalf("Expected ACC '%s' but got '%s'.", hmm.Meta.Acc, back.Meta.Acc)
+	}
+}
+
+func TestConvertCopiesEmissions(t *testing.T) {
+	hhm := readHHMFile(t, "yal001c.hhm")
+	null := hhm.HMM.Null.Lookup('A')
+	match0 := hhm.HMM.Nodes[0].MatEmit.Lookup('A')
+	match1 := hhm.HMM.Nodes[1].MatEmit.Lookup('A')
+
+	// Changing the emissions of a conversion must change nothing else.
+	hmm := HHMToHMM(hhm)
+	hmm.HMM.Nodes[0].MatEmit.Set('A', 1)
+	hmm.HMM.Nodes[0].InsEmit.Set('A', 1)
+	hmm.Begin.InsEmit.Set('A', 1)
+	if hhm.HMM.Nodes[0].MatEmit.Lookup('A') != match0 ||
+		hhm.HMM.Null.Lookup('A') != null {
+		t.Fatalf("Changing the HMM changed the emissions of the HHM.")
+	}
+	if hmm.HMM.Null.Lookup('A') != null ||
+		hmm.HMM.Nodes[1].InsEmit.Lookup('A') != null {
+		t.Fatalf("Changing the insertion emissions of the HMM changed its " +
+			"other emissions.")
+	}
+
+	back := HMMToHHM(hmm)
+	back.HMM.Nodes[1].MatEmit.Set('A', 1)
+	back.HMM.Nodes[1].InsEmit.Set('A', 1)
+	back.Begin.InsEmit.Set('A', 1)
+	if hmm.HMM.Nodes[1].MatEmit.Lookup('A') != match1 ||
+		hmm.HMM.Null.Lookup('A') != null {
+		t.Fatalf("Changing the HHM changed the emissions of the HMM.")
+	}
+	if back.HMM.Null.Lookup('A') != null ||
+		back.HMM.Nodes[0].InsEmit.Lookup('A') != null {
+		t.Fatalf("Changing the insertion emissions of the HHM changed its " +
+			"other emissions.")
+	}
+}
@@ -1,11 +1,29 @@
 /*
 Package hhm parses hhm files generated by the HHsuite programs. (i.e., hhmake,
-hhsearch, hhblits, etc.)
+hhsearch, hhblits, etc.) It also parses hmm files generated by HMMER.
 
 Each HHM file can be thought of as contain four logical sections: 1) The header
 with meta information about the HMM. 2) Optional secondary structure
 information from DSSP and/or PSIPED. 3) A multiple sequence alignment in A3M
 format. 4) The HMM formatted similarly to HMMER's hmm files, but without pseudo
 counts.
+
+Databases of concatenated profiles (e.g., Pfam-A.hmm or an hhsuite
+"_hhm.ffdata" file) can be read one profile at a time with an HHMReader or an
+HMMReader, or accessed randomly by name or accession with an Index.
+
+Sequences can be aligned to either kind of profile with a Profile, which
+computes local or glocal Viterbi alignments and Forward/Backward posterior
+probabilities. Two HHMs can be aligned to each other with AlignHHM, which scores
+columns in the same way as HHsearch. New HHMs can be estimated from multiple
+sequence alignments with BuildHHM, and HHMs and HMMs can be converted to each
+other with HHMToHMM and HMMToHHM. The information content, relative entropy
+and consensus of each node can be computed, and sequence logos can be drawn as
+SVG images with WriteLogo. Synthetic sequences and alignments can be sampled
+from a Profile with Emit and EmitMSA.
+
+Regardless of the file format, all transition and emission probabilities are
+stored as log_2 probabilities, where seq.MinProb corresponds to a probability
+of zero.
 */
 package hmm
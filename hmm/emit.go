@@ -0,0 +1,161 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// maxInsertLen limits the number of residues emitted by a single insertion
+// state, in case an insertion state can never be left.
+const maxInsertLen = 10000
+
+// Emit samples a sequence from the profile, in the same way as HMMER's
+// hmmemit. Starting at the begin state, transitions are chosen according to
+// their probabilities until the last node is left, and every match and
+// insertion state visited emits a residue according to its emission
+// probabilities. (Insertion states of the begin state use the begin state's
+// insertion emissions, or the NULL emissions if there are none.)
+//
+// The sampled sequence is returned along with the states that generated it.
+// The sequence has the name of the profile followed by "-sample". The same
+// sequence of random numbers always produces the same sample.
+func (p *Profile) Emit(rng *rand.Rand) (seq.Sequence, []PathState) {
+	hmm := p.HMM
+	trans := nodeTransitions(hmm, p.Begin)
+	begin := p.Begin.InsEmit
+	if begin.Probs == nil {
+		begin = hmm.Null
+	}
+
+	var residues []seq.Residue
+	var path []PathState
+	emit := func(state seq.HMMState, k int, ep seq.EProbs) {
+		ps := PathState{State: state, Node: k}
+		if state != seq.Deletion {
+			residues = append(residues, sampleResidue(rng, hmm.Alphabet, ep))
+			ps.Residue = len(residues)
+		}
+		path = append(path, ps)
+	}
+
+	// Node 0 is the begin state, which behaves like a match state.
+	state := seq.Match
+	for k := 0; k < len(hmm.Nodes); k++ {
+		tp := trans[k]
+		var next seq.HMMState
+		if state == seq.Deletion {
+			next = sampleState(rng, tp.DM, seq.MinProb, tp.DD)
+		} else {
+			next = sampleState(rng, tp.MM, tp.MI, tp.MD)
+		}
+		if next == seq.Insertion {
+			ins := begin
+			if k > 0 {
+				ins = hmm.Nodes[k-1].InsEmit
+			}
+			for n := 0; n < maxInsertLen; n++ {
+				emit(seq.Insertion, k, ins)
+				again := sampleState(rng, tp.IM, tp.II, seq.MinProb)
+				if again != seq.Insertion {
+					break
+				}
+			}
+			next = seq.Match
+		}
+
+		state = next
+		if state == seq.Match {
+			emit(seq.Match, k+1, hmm.Nodes[k].MatEmit)
+		} else {
+			emit(seq.Deletion, k+1, seq.EProbs{})
+		}
+	}
+	name := fmt.Sprintf("%s-sample", p.Name)
+	return seq.Sequence{Name: name, Residues: residues}, path
+}
+
+// EmitMSA samples n sequences from the profile with Emit and returns them
+// as an alignment in A2M format, where the match columns of the alignment
+// correspond to the nodes of the profile. The sequences are named after the
+// profile and numbered from 1 (e.g., "sermam-sample1"). The state path of
+// every sequence is also returned.
+func (p *Profile) EmitMSA(rng *rand.Rand, n int) (seq.MSA, [][]PathState) {
+	msa := seq.NewMSA()
+	paths := make([][]PathState, n)
+	for i := 0; i < n; i++ {
+		s, path := p.Emit(rng)
+		a3m := make([]seq.Residue, len(path))
+		for j, ps := range path {
+			switch ps.State {
+			case seq.Match:
+				a3m[j] = upper(s.Residues[ps.Residue-1])
+			case seq.Insertion:
+				a3m[j] = lower(s.Residues[ps.Residue-1])
+			case seq.Deletion:
+				a3m[j] = '-'
+			}
+		}
+		msa.Add(seq.Sequence{
+			Name:     fmt.Sprintf("%s%d", s.Name, i+1),
+			Residues: a3m,
+		})
+		paths[i] = path
+	}
+	return msa, paths
+}
+
+// sampleState chooses a match, insertion or deletion state according to the
+// given log_2 transition probabilities, which are normalized.
+func sampleState(rng *rand.Rand, m, i, d seq.Prob) seq.HMMState {
+	states := []seq.HMMState{seq.Match, seq.Insertion, seq.Deletion}
+	weights := []float64{ratio(m), ratio(i), ratio(d)}
+	return states[sample(rng, weights)]
+}
+
+// sampleResidue chooses a residue according to the given log_2 emission
+// probabilities, which are normalized.
+func sampleResidue(
+	rng *rand.Rand,
+	alphabet seq.Alphabet,
+	ep seq.EProbs,
+) seq.Residue {
+	weights := make([]float64, len(alphabet))
+	for i, r := range alphabet {
+		weights[i] = ratio(ep.Lookup(r))
+	}
+	return alphabet[sample(rng, weights)]
+}
+
+// ratio converts a log_2 probability to a probability.
+func ratio(p seq.Prob) float64 {
+	if p.IsMin() {
+		return 0
+	}
+	return math.Exp2(float64(p))
+}
+
+// sample chooses an index with probability proportional to its weight. If
+// every weight is zero, the first index is chosen.
+func sample(rng *rand.Rand, weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	x := rng.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	// Only reachable because of rounding errors or if every weight is zero.
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package hmm
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+func ExampleProfile_EmitMSA() {
+	f, err := os.Open("sermam6.hmm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	hmm, err := ReadHMM(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	msa, _ := hmm.Profile().EmitMSA(rng, 5)
+	for _, s := range msa.Entries {
+		fmt.Printf("%-16s %s\n", s.Name, s.Residues)
+	}
+	// Output:
+	// sermam6-sample1  VLKGIR
+	// sermam6-sample2  IMGGKS
+	// sermam6-sample3  IIKAQD
+	// sermam6-sample4  CIGGNE
+	// sermam6-sample5  IIDFRE
+}
+
+func TestEmit(t *testing.T) {
+	profiles, _ := alignProfiles(t)
+	for _, p := range profiles {
+		m := len(p.HMM.Nodes)
+		s1, path1 := p.Emit(rand.New(rand.NewSource(42)))
+		s2, _ := p.Emit(rand.New(rand.NewSource(42)))
+		if string(s1.Residues) != string(s2.Residues) {
+			t.Fatalf("%s: The same seed produced different sequences.", p.Name)
+		}
+		if err := checkPath(path1, m); err != nil {
+			t.Fatalf("%s: %s", p.Name, err)
+		}
+		last := path1[len(path1)-1]
+		if last.Node != m || last.State == seq.Insertion {
+			t.Fatalf("%s: Path does not end at the last node.", p.Name)
+		}
+
+		msa, paths := p.EmitMSA(rand.New(rand.NewSource(7)), 20)
+		if len(msa.Entries) != 20 || len(paths) != 20 {
+			t.Fatalf("%s: Expected 20 sequences.", p.Name)
+		}
+		matches := 0
+		for _, r := range msa.Entries[0].Residues {
+			if r == '-' || (r >= 'A' && r <= 'Z') {
+				matches++
+			}
+		}
+		if matches != m {
+			t.Fatalf("%s: Expected %d match columns but got %d.",
+				p.Name, m, matches)
+		}
+	}
+}
+
+func TestEmitFrequencies(t *testing.T) {
+	f, err := os.Open("sermam6.hmm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer f.Close()
+	hmm, err := ReadHMM(f)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// The glycine in node 4 should be emitted about as often as its
+	// emission probability says.
+	p := hmm.Profile()
+	rng := rand.New(rand.NewSource(1))
+	const n = 2000
+	matched, glycines := 0, 0
+	for i := 0; i < n; i++ {
+		s, path := p.Emit(rng)
+		for _, ps := range path {
+			if ps.Node == 4 && ps.State == seq.Match {
+				matched++
+				if s.Residues[ps.Residue-1] == 'G' {
+					glycines++
+				}
+			}
+		}
+	}
+	want := math.Exp2(float64(hmm.HMM.Nodes[3].MatEmit.Lookup('G')))
+	got := float64(glycines) / float64(matched)
+	if math.Abs(got-want) > 0.05 {
+		t.Fatalf("Expected glycine frequency %f but got %f.", want, got)
+	}
+}
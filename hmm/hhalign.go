@@ -0,0 +1,392 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/TuftsBCB/io/hhr"
+	"github.com/TuftsBCB/seq"
+)
+
+// ColumnShift is the score offset in bits that HHsearch adds to every pair of
+// aligned match columns. It keeps unrelated columns from being aligned just
+// because their score is slightly positive.
+const ColumnShift = -0.03
+
+// DefaultSSWeight is a reasonable weight for secondary structure scores when
+// aligning profiles with AlignHHM.
+const DefaultSSWeight = 0.11
+
+// ProfileAlignment is an alignment of two HHMs found by AlignHHM.
+type ProfileAlignment struct {
+	// The total score of the alignment in bits, including the secondary
+	// structure score.
+	Score float64
+
+	// The part of Score contributed by secondary structure.
+	SSScore float64
+
+	// The pairs of aligned match columns, in order.
+	Columns []ColumnPair
+
+	// The alignment as a hit in an hhr file. Only the name, scores, ranges
+	// and aligned rows are set. (There are no probabilities or E-values,
+	// since they require a calibrated score distribution.)
+	Hit hhr.Hit
+}
+
+// ColumnPair is a pair of aligned match columns. Both start at 1.
+type ColumnPair struct {
+	Query, Template int
+}
+
+// The pair states used to align two profiles. The first letter is the state
+// of the query and the second is the state of the template, where 'G' means
+// that the profile is in a gap (it has no column at that position).
+const (
+	pairMM = iota
+	pairMI // query match, template insert
+	pairIM // query insert, template match
+	pairDG // query delete
+	pairGD // template delete
+	pairNone
+)
+
+// AlignHHM finds the best alignment of a query and template HHM using the
+// Viterbi algorithm, in the same way as HHsearch. Two match columns are
+// scored by the log-odds of their emission distributions being produced by
+// the same source relative to the query's NULL emissions, plus ColumnShift.
+// The transitions of both profiles are used to score insertions and
+// deletions.
+//
+// In Local mode, an alignment may start and end at any pair of match columns.
+// In Glocal mode, an alignment must start at the first column of one of the
+// profiles and end at the last column of one of the profiles. (This
+// corresponds to the global mode of HHsearch.)
+//
+// If ssWeight is positive, secondary structure is also scored. The query's
+// predicted secondary structure (or its DSSP states if there is no
+// prediction) is compared with the template's DSSP states (or its predicted
+// states if there are no DSSP states). After reducing each to helix, strand
+// or coil, every aligned pair scores ssWeight if the states are the same and
+// -ssWeight otherwise, scaled by the confidence of any predicted states. This
+// is a simplification of the substitution tables used by HHsearch.
+func AlignHHM(
+	query, template *HHM,
+	mode AlignMode,
+	ssWeight float64,
+) (*ProfileAlignment, error) {
+	if len(query.HMM.Nodes) == 0 || len(template.HMM.Nodes) == 0 {
+		return nil, fmt.Errorf("Cannot align profiles without nodes.")
+	}
+	if mode != Local && mode != Glocal {
+		return nil, fmt.Errorf("Unknown alignment mode %s.", mode)
+	}
+
+	qn, tn := len(query.HMM.Nodes), len(template.HMM.Nodes)
+	qtr := nodeTransitions(query.HMM, query.Begin)
+	ttr := nodeTransitions(template.HMM, template.Begin)
+	ss := newSSScorer(query, template, ssWeight)
+	cols := newTable(qn+1, tn+1)
+	sscols := newTable(qn+1, tn+1)
+	for i := 1; i <= qn; i++ {
+		for j := 1; j <= tn; j++ {
+			sscols[i][j] = ss.score(i, j)
+			cols[i][j] = columnScore(query.HMM, i, template.HMM, j) +
+				ColumnShift + sscols[i][j]
+		}
+	}
+
+	// Each table has a companion table of back pointers to the previous
+	// pair state.
+	var tabs [pairNone]table
+	var back [pairNone][][]byte
+	for s := range tabs {
+		tabs[s] = newTable(qn+1, tn+1)
+		back[s] = make([][]byte, qn+1)
+		for i := range back[s] {
+			back[s][i] = make([]byte, tn+1)
+		}
+	}
+	best := func(cands [pairNone]float64) (float64, byte) {
+		score, from := negInf, byte(pairNone)
+		for s, v := range cands {
+			if v > score {
+				score, from = v, byte(s)
+			}
+		}
+		return score, from
+	}
+	mm, mi, im, dg, gd := tabs[pairMM], tabs[pairMI], tabs[pairIM],
+		tabs[pairDG], tabs[pairGD]
+	for i := 1; i <= qn; i++ {
+		for j := 1; j <= tn; j++ {
+			q0, q1, t0, t1 := qtr[i-1], qtr[i], ttr[j-1], ttr[j]
+
+			var c [pairNone]float64
+			c[pairMM] = mm[i-1][j-1] + logProb(q0.MM) + logProb(t0.MM)
+			c[pairMI] = mi[i-1][j-1] + logProb(q0.MM) + logProb(t0.IM)
+			c[pairIM] = im[i-1][j-1] + logProb(q0.IM) + logProb(t0.MM)
+			c[pairDG] = dg[i-1][j-1] + logProb(q0.DM) + logProb(t0.MM)
+			c[pairGD] = gd[i-1][j-1] + logProb(q0.MM) + logProb(t0.DM)
+			// The start of an alignment is stored as pairNone.
+			start := mode == Local || i == 1 || j == 1
+			v, from := best(c)
+			if start && v < 0 {
+				v, from = 0, pairNone
+			}
+			mm[i][j], back[pairMM][i][j] = v+cols[i][j], from
+
+			c = [pairNone]float64{negInf, negInf, negInf, negInf, negInf}
+			c[pairMM] = mm[i-1][j] + logProb(q0.MM) + logProb(t1.MI)
+			c[pairMI] = mi[i-1][j] + logProb(q0.MM) + logProb(t1.II)
+			mi[i][j], back[pairMI][i][j] = best(c)
+
+			c = [pairNone]float64{negInf, negInf, negInf, negInf, negInf}
+			c[pairMM] = mm[i][j-1] + logProb(q1.MI) + logProb(t0.MM)
+			c[pairIM] = im[i][j-1] + logProb(q1.II) + logProb(t0.MM)
+			im[i][j], back[pairIM][i][j] = best(c)
+
+			c = [pairNone]float64{negInf, negInf, negInf, negInf, negInf}
+			c[pairMM] = mm[i-1][j] + logProb(q0.MD)
+			c[pairDG] = dg[i-1][j] + logProb(q0.DD)
+			dg[i][j], back[pairDG][i][j] = best(c)
+
+			c = [pairNone]float64{negInf, negInf, negInf, negInf, negInf}
+			c[pairMM] = mm[i][j-1] + logProb(t0.MD)
+			c[pairGD] = gd[i][j-1] + logProb(t0.DD)
+			gd[i][j], back[pairGD][i][j] = best(c)
+		}
+	}
+
+	// Alignments always end with a pair of match columns.
+	score, bi, bj := negInf, 0, 0
+	for i := 1; i <= qn; i++ {
+		for j := 1; j <= tn; j++ {
+			if mode == Glocal && i != qn && j != tn {
+				continue
+			}
+			if mm[i][j] > score {
+				score, bi, bj = mm[i][j], i, j
+			}
+		}
+	}
+	if math.IsInf(score, -1) {
+		return nil, fmt.Errorf("There is no %s alignment of '%s' and '%s'.",
+			mode, query.Meta.Name, template.Meta.Name)
+	}
+
+	// Follow the back pointers to recover the pair states of the alignment.
+	type step struct {
+		state byte
+		i, j  int
+	}
+	var steps []step
+	state, i, j := byte(pairMM), bi, bj
+	for state != pairNone {
+		steps = append(steps, step{state, i, j})
+		from := back[state][i][j]
+		switch state {
+		case pairMM:
+			i, j = i-1, j-1
+		case pairMI, pairDG:
+			i--
+		case pairIM, pairGD:
+			j--
+		}
+		state = from
+	}
+
+	aln := &ProfileAlignment{Score: score}
+	rows := newHitRows(query, template)
+	for k := len(steps) - 1; k >= 0; k-- {
+		st := steps[k]
+		qi, tj := 0, 0
+		switch st.state {
+		case pairMM:
+			qi, tj = st.i, st.j
+			aln.SSScore += sscols[st.i][st.j]
+			aln.Columns = append(aln.Columns, ColumnPair{st.i, st.j})
+		case pairMI, pairDG:
+			qi = st.i
+		case pairIM, pairGD:
+			tj = st.j
+		}
+		rows.add(qi, tj)
+	}
+
+	first, last := aln.Columns[0], aln.Columns[len(aln.Columns)-1]
+	aln.Hit = hhr.Hit{
+		Num:             1,
+		Name:            template.Meta.Name,
+		ViterbiScore:    score,
+		SSScore:         aln.SSScore,
+		NumAlignedCols:  len(aln.Columns),
+		QueryStart:      first.Query,
+		QueryEnd:        last.Query,
+		TemplateStart:   first.Template,
+		TemplateEnd:     last.Template,
+		NumTemplateCols: tn,
+		Aligned:         rows.Alignment,
+	}
+	return aln, nil
+}
+
+// columnScore returns the log-odds score of aligning match column i of the
+// query with match column j of the template.
+func columnScore(query *seq.HMM, i int, template *seq.HMM, j int) float64 {
+	qemit, temit := query.Nodes[i-1].MatEmit, template.Nodes[j-1].MatEmit
+	uniform := -math.Log2(float64(len(query.Alphabet)))
+	sum := 0.0
+	for _, r := range query.Alphabet {
+		q, t := qemit.Lookup(r), temit.Lookup(r)
+		if q.IsMin() || t.IsMin() {
+			continue
+		}
+		null := uniform
+		if query.Null.Probs != nil && !query.Null.Lookup(r).IsMin() {
+			null = float64(query.Null.Lookup(r))
+		}
+		sum += math.Exp2(float64(q) + float64(t) - null)
+	}
+	if sum == 0 {
+		return negInf
+	}
+	return math.Log2(sum)
+}
+
+// ssScorer scores pairs of secondary structure states from two HHMs.
+type ssScorer struct {
+	weight       float64
+	query, templ []seq.Residue
+	qconf, tconf []seq.Residue
+}
+
+func newSSScorer(query, template *HHM, weight float64) ssScorer {
+	ss := ssScorer{weight: weight}
+	if weight <= 0 {
+		return ss
+	}
+	qn, tn := len(query.HMM.Nodes), len(template.HMM.Nodes)
+	qs, ts := query.Secondary, template.Secondary
+	if r := ssResidues(qs.SSpred, qn); r != nil {
+		ss.query, ss.qconf = r, ssResidues(qs.SSconf, qn)
+	} else {
+		ss.query = ssResidues(qs.SSdssp, qn)
+	}
+	if r := ssResidues(ts.SSdssp, tn); r != nil {
+		ss.templ = r
+	} else {
+		ss.templ = ssResidues(ts.SSpred, tn)
+		ss.tconf = ssResidues(ts.SSconf, tn)
+	}
+	return ss
+}
+
+// ssResidues returns the residues of a secondary structure sequence if it has
+// one residue for every node.
+func ssResidues(s *seq.Sequence, nodes int) []seq.Residue {
+	if s == nil || s.Len() != nodes {
+		return nil
+	}
+	return s.Residues
+}
+
+func (ss ssScorer) score(i, j int) float64 {
+	if ss.query == nil || ss.templ == nil {
+		return 0
+	}
+	q, t := reduceSS(ss.query[i-1]), reduceSS(ss.templ[j-1])
+	if q == 0 || t == 0 {
+		return 0
+	}
+	score := ss.weight
+	if q != t {
+		score = -score
+	}
+	return score * ssConfidence(ss.qconf, i) * ssConfidence(ss.tconf, j)
+}
+
+// reduceSS reduces a DSSP or PSIPRED state to 'H' (helix), 'E' (strand) or
+// 'C' (coil). Zero is returned for unknown states.
+func reduceSS(r seq.Residue) seq.Residue {
+	switch r {
+	case 'H', 'G', 'I':
+		return 'H'
+	case 'E', 'B':
+		return 'E'
+	case 'C', 'T', 'S', '-', '~':
+		return 'C'
+	}
+	return 0
+}
+
+// ssConfidence returns the confidence (between 0.1 and 1) of a predicted
+// state at column i, or 1 if there are no confidence values.
+func ssConfidence(conf []seq.Residue, i int) float64 {
+	if conf == nil || conf[i-1] < '0' || conf[i-1] > '9' {
+		return 1
+	}
+	return float64(conf[i-1]-'0'+1) / 10
+}
+
+// hitRows builds the aligned rows of an hhr hit from a pair of HHMs.
+type hitRows struct {
+	hhr.Alignment
+	query, template hitSources
+}
+
+// hitSources are the per column residues of an HHM that are shown in an
+// alignment in an hhr file. Any of them may be nil.
+type hitSources struct {
+	seq, consensus, dssp, pred, conf []seq.Residue
+}
+
+func newHitRows(query, template *HHM) *hitRows {
+	return &hitRows{
+		query:    newHitSources(query),
+		template: newHitSources(template),
+	}
+}
+
+func newHitSources(hhm *HHM) hitSources {
+	n := len(hhm.HMM.Nodes)
+	residues := make([]seq.Residue, n)
+	for i, node := range hhm.HMM.Nodes {
+		residues[i] = node.Residue
+	}
+	return hitSources{
+		seq:       residues,
+		consensus: ssResidues(hhm.Secondary.Consensus, n),
+		dssp:      ssResidues(hhm.Secondary.SSdssp, n),
+		pred:      ssResidues(hhm.Secondary.SSpred, n),
+		conf:      ssResidues(hhm.Secondary.SSconf, n),
+	}
+}
+
+// add adds a column to the alignment with query column qi and template
+// column tj. A column of zero is a gap.
+func (rows *hitRows) add(qi, tj int) {
+	q, t := rows.query, rows.template
+	a := &rows.Alignment
+	a.QSeq = addHitResidue(a.QSeq, q.seq, qi)
+	a.QConsensus = addHitResidue(a.QConsensus, q.consensus, qi)
+	a.QDssp = addHitResidue(a.QDssp, q.dssp, qi)
+	a.QPred = addHitResidue(a.QPred, q.pred, qi)
+	a.QConf = addHitResidue(a.QConf, q.conf, qi)
+	a.TSeq = addHitResidue(a.TSeq, t.seq, tj)
+	a.TConsensus = addHitResidue(a.TConsensus, t.consensus, tj)
+	a.TDssp = addHitResidue(a.TDssp, t.dssp, tj)
+	a.TPred = addHitResidue(a.TPred, t.pred, tj)
+	a.TConf = addHitResidue(a.TConf, t.conf, tj)
+}
+
+func addHitResidue(row, source []seq.Residue, col int) []seq.Residue {
+	switch {
+	case source == nil:
+		return nil
+	case col == 0:
+		return append(row, '-')
+	}
+	return append(row, source[col-1])
+}
@@ -0,0 +1,108 @@
+package hmm
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+func readHHMFile(t *testing.T, fname string) *HHM {
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer f.Close()
+	hhm, err := ReadHHM(f)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return hhm
+}
+
+func ExampleAlignHHM() {
+	read := func(fname string) *HHM {
+		f, err := os.Open(fname)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		hhm, err := ReadHHM(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return hhm
+	}
+	query, template := read("yal001c_1-11.hhm"), read("yal001c_2-12.hhm")
+
+	aln, err := AlignHHM(query, template, Local, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hit := aln.Hit
+	fmt.Printf("%.2f %d %d-%d %d-%d\n", hit.ViterbiScore, hit.NumAlignedCols,
+		hit.QueryStart, hit.QueryEnd, hit.TemplateStart, hit.TemplateEnd)
+	fmt.Printf("Q %s\nT %s\n", hit.Aligned.QSeq, hit.Aligned.TSeq)
+	// Output:
+	// 19.73 10 2-11 1-10
+	// Q VLTIYPDELV
+	// T VLTIYPDELV
+}
+
+func TestAlignHHM(t *testing.T) {
+	full := readHHMFile(t, "yal001c.hhm")
+	for _, mode := range []AlignMode{Local, Glocal} {
+		aln, err := AlignHHM(full, full.Slice(50, 100), mode, 0)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if len(aln.Columns) != 50 {
+			t.Fatalf("%s: Expected 50 aligned columns but got %d.",
+				mode, len(aln.Columns))
+		}
+		for i, pair := range aln.Columns {
+			if pair.Query != 51+i || pair.Template != 1+i {
+				t.Fatalf("%s: Column %d aligned to %d.",
+					mode, pair.Query, pair.Template)
+			}
+		}
+		if aln.Hit.NumTemplateCols != 50 || aln.Hit.QueryStart != 51 {
+			t.Fatalf("%s: Unexpected hit: %#v", mode, aln.Hit)
+		}
+	}
+}
+
+func TestAlignHHMSecondary(t *testing.T) {
+	query := readHHMFile(t, "yal001c_1-11.hhm")
+	template := readHHMFile(t, "yal001c_2-12.hhm")
+	ss := func(name, residues string) *seq.Sequence {
+		s := seq.NewSequenceString(name, residues)
+		return &s
+	}
+	query.Secondary.SSpred = ss("ss_pred", "CCHHHHHHEEC")
+	template.Secondary.SSdssp = ss("ss_dssp", "CHHHHHHEECC")
+
+	plain, err := AlignHHM(query, template, Local, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	withSS, err := AlignHHM(query, template, Local, DefaultSSWeight)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if withSS.SSScore <= 0 || plain.SSScore != 0 {
+		t.Fatalf("Unexpected secondary structure scores %f and %f.",
+			plain.SSScore, withSS.SSScore)
+	}
+	if withSS.Score <= plain.Score {
+		t.Fatalf("Agreeing secondary structure did not increase the score.")
+	}
+	if len(withSS.Hit.Aligned.TDssp) != len(withSS.Hit.Aligned.TSeq) {
+		t.Fatalf("Template DSSP row has the wrong length.")
+	}
+	if withSS.Hit.Aligned.QDssp != nil {
+		t.Fatalf("Query DSSP row should be absent.")
+	}
+}
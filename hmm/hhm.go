@@ -1,23 +1,39 @@
 package hmm
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/TuftsBCB/seq"
 )
 
 var hmmScale = 1000.0
 
-// HMM corresponds to an hmm file produced by HMMER.
-type HMM struct {
-	Meta Meta
-	HMM  *seq.HMM
+// hhmTransitionOrder is the order of the transition and diversity columns
+// written by HHsuite.
+var hhmTransitionOrder = []string{
+	"M->M", "M->I", "M->D", "I->M", "I->I", "D->M", "D->D",
+	"Neff", "Neff_I", "Neff_D",
 }
 
 // HHM corresponds to an hhm file produce by HHsuite (i.e., hhblits or hhmake).
+//
+// hhm files do not have insertion emissions, so the insertion emissions of
+// every node in HMM are the NULL emissions.
 type HHM struct {
 	Meta      Meta
 	Secondary HHMSecondary
 	MSA       seq.MSA
 	HMM       *seq.HMM
+
+	// The transitions and diversity values of the begin state.
+	Begin BeginState
+
+	// The names of the transition and diversity columns in the order that
+	// they appear in the file. (e.g., "M->M", "M->I", ..., "Neff_D".) When
+	// it is empty, the order used by HHsuite is assumed.
+	TransitionOrder []string
 }
 
 type Meta struct {
@@ -38,28 +54,107 @@ type Meta struct {
 	// entropy averaged over all columns of the alignment.
 	Neff seq.Prob
 
-	// ???
+	// The name of the alignment file the HHM was built from, without its
+	// extension. (e.g., "yal001c")
 	File string
 
-	// Number of match states and number of columns. Doesn't appear to be
-	// in machine readable format.
+	// The LENG line of an hhm file as it was read. e.g., '240 match states,
+	// 240 columns in multiple alignment'. In HMMER files, it is the number
+	// of nodes.
 	Leng string
 
-	// Pre-filter details? Not machine readable.
+	// The number of match states and the number of columns in the alignment
+	// that the HHM was built from, as read from LENG. They are zero if LENG
+	// is not in the format above.
+	MatchStates, Columns int
+
+	// The FILT line of an hhm file as it was read. e.g., '78 out of 78
+	// sequences passed filter (-id 90 -cov 0 -qid 0 -qsc -20.00 -diff 100)'
 	Filt string
 
+	// The filter that was applied to the alignment, as read from FILT. It is
+	// zero if FILT is not in the format above.
+	Filter Filter
+
 	// EVD parameters. (Not used in HHsuite 2+, I think.)
 	EvdLambda, EvdMu float64
 
 	// Whether the HMM has pseudo count correction.
 	Pct bool
 
-	// Date file was generated.
+	// Date file was generated as it was read.
 	// e.g., 'Sat Nov 10 21:31:12 2012'
 	Date string
 
-	// ???
+	// The date the file was generated, as read from DATE. It is the zero
+	// time if DATE is absent or not in the format written by HHsuite and
+	// HMMER.
+	Created time.Time
+
+	// A free text description of the HMM.
 	Desc string
+
+	// The remaining fields only appear in HMMER files.
+
+	// Accession number. (e.g., "PF00001.19")
+	Acc string
+
+	// Maximum length of an instance of the model. Zero if absent.
+	MaxL int
+
+	// The type of alphabet. (e.g., "amino")
+	Alph string
+
+	// Whether each node is annotated with a reference residue, a model mask
+	// character, a consensus residue, a consensus structure character and a
+	// column in the training alignment, respectively.
+	RF, MM, Cons, CS, Map bool
+
+	// The number of sequences used to build the HMM and the effective number
+	// of sequences after weighting.
+	NSeq int
+	EffN float64
+
+	// Checksum of the training alignment.
+	Cksum uint32
+
+	// Pfam gathering, trusted and noise cutoffs. Each is either nil or has
+	// two scores: per-sequence and per-domain.
+	GA, TC, NC []float64
+
+	// E-value parameters for MSV, Viterbi and Forward scores in local
+	// alignment mode.
+	StatsMSV, StatsViterbi, StatsForward Stats
+
+	// Header lines that aren't recognized, in the order they appear.
+	// (e.g., the "BM" and "SM" lines in Pfam.)
+	Extra []string
+}
+
+// Filter corresponds to the FILT line of an hhm file, which describes how
+// the sequences of the alignment were filtered by hhmake or hhblits before
+// the HHM was built. Options that are absent from FILT are zero.
+type Filter struct {
+	// The number of sequences that passed the filter and the number of
+	// sequences in the alignment.
+	Passed, Total int
+
+	// Maximum pairwise sequence identity (-id), minimum coverage with the
+	// query (-cov), minimum sequence identity with the query (-qid) and
+	// minimum score per column with the query (-qsc).
+	MaxIdentity, MinCoverage, MinQueryIdentity, MinQueryScore float64
+
+	// The number of most diverse sequences kept in every block of the
+	// alignment (-diff).
+	Diff int
+}
+
+// Stats corresponds to the parameters of a score distribution in an HMMER
+// file. Loc is the location parameter (mu for MSV and Viterbi, tau for
+// Forward) and Lambda is the slope. A zero Lambda means that the parameters
+// are absent.
+type Stats struct {
+	Loc, Lambda float64
 }
 
 // An HHMSecondary represents secondary structure information that *may* be
@@ -122,10 +217,66 @@ func (hhm *HHM) Slice(start, end int) *HHM {
 	}
 	meta.Neff /= seq.Prob(len(hmm.Nodes))
 
+	msa := hhm.MSA.Slice(start, end)
+	if len(meta.Leng) > 0 {
+		meta.MatchStates, meta.Columns = len(hmm.Nodes), msa.Len()
+		meta.Leng = fmt.Sprintf("%d match states, %d columns in multiple "+
+			"alignment", meta.MatchStates, meta.Columns)
+	}
+
 	return &HHM{
-		Meta:      meta,
-		Secondary: hhm.Secondary.Slice(start, end),
-		MSA:       hhm.MSA.Slice(start, end),
-		HMM:       hmm,
+		Meta:            meta,
+		Secondary:       hhm.Secondary.Slice(start, end),
+		MSA:             msa,
+		HMM:             hmm,
+		Begin:           hhm.Begin,
+		TransitionOrder: hhm.TransitionOrder,
+	}
+}
+
+// transitionColumns returns pointers to the transition and diversity values
+// of a node (or the begin state) in the given column order. If the order is
+// empty, then the order used by HHsuite is used.
+func transitionColumns(
+	order []string,
+	tp *seq.TProbs,
+	neffM, neffI, neffD *seq.Prob,
+) ([]*seq.Prob, error) {
+	if len(order) == 0 {
+		order = hhmTransitionOrder
 	}
+	cols := make([]*seq.Prob, len(order))
+	for i, name := range order {
+		switch name {
+		case "M->M":
+			cols[i] = &tp.MM
+		case "M->I":
+			cols[i] = &tp.MI
+		case "M->D":
+			cols[i] = &tp.MD
+		case "I->M":
+			cols[i] = &tp.IM
+		case "I->I":
+			cols[i] = &tp.II
+		case "D->M":
+			cols[i] = &tp.DM
+		case "D->D":
+			cols[i] = &tp.DD
+		case "Neff":
+			cols[i] = neffM
+		case "Neff_I":
+			cols[i] = neffI
+		case "Neff_D":
+			cols[i] = neffD
+		default:
+			return nil, fmt.Errorf("Unknown transition column '%s'.", name)
+		}
+	}
+	return cols, nil
+}
+
+// isNeffColumn returns true if the named transition column has diversity
+// values rather than probabilities.
+func isNeffColumn(name string) bool {
+	return strings.HasPrefix(name, "Neff")
 }
@@ -1,36 +1,93 @@
 package hmm
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/TuftsBCB/io/fasta"
 	"github.com/TuftsBCB/seq"
 )
 
+// Names of the sections of an hhm file, as reported in a ParseError.
+const (
+	SectionMeta     = "meta"
+	SectionSequence = "sequence"
+	SectionHMM      = "HMM"
+)
+
+// ParseError is returned when an hhm file is malformed. It records the
+// section of the file, the line number (counted from the start of the input)
+// and the text of the offending line.
+//
+// Errors in the sequence section are reported at the first line of the
+// section, since the sequences are read by a FASTA reader. The line number in
+// Err is then relative to the start of the section.
+type ParseError struct {
+	Section string
+	Line    int
+	Text    string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error on line %d in the %s section of hhm: %s "+
+		"(line: '%s')", e.Line, e.Section, e.Err, e.Text)
+}
+
+// hhmLine is a single line of an hhm file along with its line number.
+type hhmLine struct {
+	num  int
+	text []byte
+}
+
+func (l hhmLine) errorf(section, format string, v ...interface{}) error {
+	return &ParseError{
+		Section: section,
+		Line:    l.num,
+		Text:    string(l.text),
+		Err:     fmt.Errorf(format, v...),
+	}
+}
+
+// ReadHHM reads an hhm file produced by HHsuite. Only the first HHM in the
+// input is read. (Use an HHMReader to read all of them.) If the input has no
+// HHM, then io.EOF is returned.
+//
+// If the file is malformed, then a *ParseError is returned.
 func ReadHHM(r io.Reader) (*HHM, error) {
+	return readHHM(newLineReader(r))
+}
+
+func readHHM(lr *lineReader) (*HHM, error) {
 	// An hhm file as four logical sections: 1) Meta data, 2) secondary
 	// structure info (optional), 3) A2M formatted MSA and 4) the HMM.
-	// We group 2+3 together, and store each of the three portions in their
-	// own buffer. We then parse each separately.
-	bmeta, bseq, bhmm := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	// We group 2+3 together, and store each of the three portions
+	// separately. We then parse each separately. Lines in the meta and HMM
+	// sections keep their line numbers for error reporting.
+	var lmeta, lhmm []hhmLine
+	bseq := new(bytes.Buffer)
+	seqStart := hhmLine{}
 	mode := 1 // 1 for meta, 2 for sequence and 3 for hmm
+	empty, done := true, false
 
-	buf := bufio.NewReader(r)
 MAIN:
 	for {
-		line, err := buf.ReadBytes('\n')
-		if err == io.EOF && len(line) == 0 {
+		line, err := lr.next()
+		if err == io.EOF {
 			break
 		}
-		if err != nil && err != io.EOF {
+		if err != nil {
 			return nil, fmt.Errorf("Error reading hhm: %s", err)
 		}
 		line = trim(line)
+		if empty && len(line) == 0 {
+			continue
+		}
+		empty = false
 
 		// First check if we should do a mode change.
 		// i.e., a line starting with 'SEQ' means mode 1 -> 2, and
@@ -39,65 +96,67 @@ MAIN:
 		switch {
 		case hasPrefix(line, "SEQ"):
 			mode = 2
+			seqStart = hhmLine{lr.lineno, line}
 			continue MAIN
 		case hasPrefix(line, "#"):
 			mode = 3
 			continue MAIN
 		case hasPrefix(line, "//"):
+			done = true
 			break MAIN
 		}
 
-		// Now add the bytes to the appropriate buffer based on the mode.
+		// Now add the line to the appropriate section based on the mode.
+		l := hhmLine{lr.lineno, line}
 		switch mode {
 		case 1: // meta data
-			_, err = bmeta.Write(append(line, '\n'))
+			lmeta = append(lmeta, l)
 		case 2: // sequences
-			_, err = bseq.Write(append(line, '\n'))
+			bseq.Write(append(line, '\n'))
 		case 3: // hmm
-			_, err = bhmm.Write(append(line, '\n'))
+			lhmm = append(lhmm, l)
 		default:
-			panic(fmt.Sprintf("BUG: Unknown mode: %d", mode))
-		}
-		if err != nil {
-			return nil, fmt.Errorf("Error updating buffer for hhm: %s", err)
+			return nil, l.errorf(SectionMeta, "Unknown mode: %d", mode)
 		}
 	}
 
-	meta, err := readMeta(bmeta)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading meta data from hhm: %s", err)
+	if empty {
+		return nil, io.EOF
+	}
+	if !done {
+		section := []string{SectionMeta, SectionSequence, SectionHMM}[mode-1]
+		return nil, hhmLine{lr.lineno, nil}.errorf(section,
+			"Unexpected EOF (expected '//').")
 	}
 
-	ss, msa, err := readSeqs(bseq)
+	meta, err := readMeta(lmeta)
 	if err != nil {
-		return nil, fmt.Errorf("Error reading sequence data from hhm: %s", err)
+		return nil, err
 	}
 
-	hmm, err := readHMM(bhmm)
+	ss, msa, err := readSeqs(bseq)
 	if err != nil {
-		return nil, fmt.Errorf("Error reading HMM data from hhm: %s", err)
+		return nil, seqStart.errorf(SectionSequence, "%s", err)
 	}
 
-	return &HHM{
+	hhm := &HHM{
 		Meta:      meta,
 		Secondary: ss,
 		MSA:       msa,
-		HMM:       hmm,
-	}, nil
+	}
+	if err := readHMM(lhmm, hhm); err != nil {
+		return nil, err
+	}
+	if err := checkHHMLeng(lmeta, hhm); err != nil {
+		return nil, err
+	}
+	return hhm, nil
 }
 
-func readMeta(buf *bytes.Buffer) (Meta, error) {
+func readMeta(lines []hhmLine) (Meta, error) {
 	meta := Meta{}
-	for {
-		line, err := buf.ReadBytes('\n')
-		if err == io.EOF && len(line) == 0 {
-			break
-		}
-		if err != nil && err != io.EOF {
-			return Meta{}, err
-		}
-
-		line = trim(line)
+	for _, l := range lines {
+		line := l.text
 		switch {
 		case hasPrefix(line, "HH"):
 			meta.FormatVersion = str(line)
@@ -108,34 +167,42 @@ func readMeta(buf *bytes.Buffer) (Meta, error) {
 		case hasPrefix(line, "FILE"):
 			meta.File = str(line[4:])
 		case hasPrefix(line, "LENG"):
+			// LENG and FILT are free text to HHsuite, so they are kept as is
+			// when they are not in the usual format.
 			meta.Leng = str(line[4:])
+			if m, cols, err := readLeng(meta.Leng); err == nil {
+				meta.MatchStates, meta.Columns = m, cols
+			}
 		case hasPrefix(line, "FILT"):
 			meta.Filt = str(line[4:])
+			if filter, err := readFilter(meta.Filt); err == nil {
+				meta.Filter = filter
+			}
 		case hasPrefix(line, "NEFF"):
 			// You'd think we could use readNeff here, but does the HHM
 			// format store all Neff values equally? NOOOOOOOOOOOOOOOOOOOO.
 			f, err := strconv.ParseFloat(str(line[4:]), 64)
 			if err != nil {
-				return Meta{}, err
+				return Meta{}, l.errorf(SectionMeta, "Invalid NEFF: %s", err)
 			}
 			meta.Neff = seq.Prob(f)
 		case hasPrefix(line, "EVD"):
 			fields := bytes.Fields(bytes.TrimSpace(line[3:]))
 			if len(fields) != 2 {
-				return Meta{}, fmt.Errorf("Invalid EVD format: '%s'", line)
+				return Meta{}, l.errorf(SectionMeta, "Invalid EVD format.")
 			}
 
 			lambda, err := strconv.ParseFloat(string(fields[0]), 64)
 			if err != nil {
-				return Meta{}, fmt.Errorf("Error EVD lambda '%s': %s",
-					string(fields[0]), err)
+				return Meta{}, l.errorf(SectionMeta,
+					"Error EVD lambda '%s': %s", string(fields[0]), err)
 			}
 			meta.EvdLambda = lambda
 
 			mu, err := strconv.ParseFloat(string(fields[1]), 64)
 			if err != nil {
-				return Meta{}, fmt.Errorf("Error EVD mu '%s': %s",
-					string(fields[1]), err)
+				return Meta{}, l.errorf(SectionMeta,
+					"Error EVD mu '%s': %s", string(fields[1]), err)
 			}
 			meta.EvdMu = mu
 		case hasPrefix(line, "PCT"):
@@ -146,11 +213,100 @@ func readMeta(buf *bytes.Buffer) (Meta, error) {
 			meta.Com = str(line[3:])
 		case hasPrefix(line, "DATE"):
 			meta.Date = str(line[4:])
+			meta.Created = readDate(meta.Date)
 		}
 	}
 	return meta, nil
 }
 
+// checkHHMLeng returns an error if the number of match states in LENG doesn't
+// match the number of nodes of the HHM. The error is reported at the LENG
+// line. A LENG line that can't be read is not checked.
+func checkHHMLeng(lines []hhmLine, hhm *HHM) error {
+	for _, l := range lines {
+		if !hasPrefix(l.text, "LENG") {
+			continue
+		}
+		m, _, err := readLeng(str(l.text[4:]))
+		if err == nil && m != len(hhm.HMM.Nodes) {
+			return l.errorf(SectionMeta,
+				"LENG has %d match states but there are %d nodes.",
+				m, len(hhm.HMM.Nodes))
+		}
+	}
+	return nil
+}
+
+// readLeng reads the number of match states and alignment columns from the
+// LENG line of an hhm file. e.g., '240 match states, 240 columns in multiple
+// alignment'.
+func readLeng(leng string) (matchStates, columns int, err error) {
+	_, err = fmt.Sscanf(leng, "%d match states, %d columns",
+		&matchStates, &columns)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Expected 'N match states, M columns "+
+			"in multiple alignment' but got '%s'.", leng)
+	}
+	return matchStates, columns, nil
+}
+
+// readFilter reads a FILT line of an hhm file. e.g., '78 out of 78 sequences
+// passed filter (-id 90 -cov 0 -qid 0 -qsc -20.00 -diff 100)'. Options that
+// are not recognized are ignored.
+func readFilter(filt string) (Filter, error) {
+	var f Filter
+	_, err := fmt.Sscanf(filt, "%d out of %d", &f.Passed, &f.Total)
+	if err != nil {
+		return Filter{}, fmt.Errorf("Expected 'N out of M sequences "+
+			"passed filter' but got '%s'.", filt)
+	}
+
+	start, end := strings.Index(filt, "("), strings.LastIndex(filt, ")")
+	if start == -1 || end < start {
+		return f, nil
+	}
+	options := strings.Fields(filt[start+1 : end])
+	for i := 0; i+1 < len(options); i += 2 {
+		name, val := options[i], options[i+1]
+		if name == "-diff" {
+			if f.Diff, err = strconv.Atoi(val); err != nil {
+				return Filter{}, fmt.Errorf("Invalid -diff '%s': %s",
+					val, err)
+			}
+			continue
+		}
+
+		var dest *float64
+		switch name {
+		case "-id":
+			dest = &f.MaxIdentity
+		case "-cov":
+			dest = &f.MinCoverage
+		case "-qid":
+			dest = &f.MinQueryIdentity
+		case "-qsc":
+			dest = &f.MinQueryScore
+		default:
+			continue
+		}
+		if *dest, err = strconv.ParseFloat(val, 64); err != nil {
+			return Filter{}, fmt.Errorf("Invalid %s '%s': %s", name, val, err)
+		}
+	}
+	return f, nil
+}
+
+// readDate reads a DATE line in the format written by HHsuite and HMMER.
+// (e.g., 'Tue Oct 30 22:22:21 2012'.) The zero time is returned if the date
+// is in another format.
+func readDate(date string) time.Time {
+	t, err := time.Parse(time.ANSIC, date)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
 func readSeqs(buf *bytes.Buffer) (HHMSecondary, seq.MSA, error) {
 	// Remember, the sequence portion of an HHM file actually has two parts.
 	// The first part is optional and contains secondary structure information.
@@ -195,19 +351,20 @@ func readSeqs(buf *bytes.Buffer) (HHMSecondary, seq.MSA, error) {
 	return ss, msa, nil
 }
 
-func readHMM(buf *bytes.Buffer) (hmm *seq.HMM, err error) {
+// readHMM reads the HMM section of an hhm file into hhm.HMM, along with the
+// begin state and the order of the transition columns.
+func readHMM(lines []hhmLine, hhm *HHM) error {
+	var nullLine hhmLine
 	var nullFields []string
-	hmm = new(seq.HMM)
-	for {
-		line, err := buf.ReadBytes('\n')
-		if err == io.EOF && len(line) == 0 {
-			break
-		}
-		if err != nil && err != io.EOF {
-			panic(err)
-		}
-		line = trim(line)
+	hmm := new(seq.HMM)
+	hhm.HMM = hmm
 
+	errorf := func(l hhmLine, format string, v ...interface{}) error {
+		return l.errorf(SectionHMM, format, v...)
+	}
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		line := l.text
 		if len(line) == 0 {
 			continue
 		}
@@ -217,31 +374,55 @@ func readHMM(buf *bytes.Buffer) (hmm *seq.HMM, err error) {
 			// an alphabet. (Which we'll get on the next line.)
 			// We'll slurp this into a seq.EProbs value in a little bit, after
 			// we get an alphabet.
+			nullLine = l
 			nullFields = strings.Fields(str(line[4:]))
 		case hasPrefix(line, "HMM"):
 			// We slurp up three lines here. The first is the alphabet
 			// (the current line). The second is the ordering of transition
 			// probabilities. And the third are transition probabilities for
-			// the begin state. We ignore the second two.
-			if _, err := demandLine(buf); err != nil {
-				return nil, fmt.Errorf("%s (expected transition ordering)", err)
+			// the begin state (in the same order).
+			if i+2 >= len(lines) {
+				return errorf(l, "Expected the transition ordering and "+
+					"start transitions after the alphabet.")
 			}
-			if _, err := demandLine(buf); err != nil {
-				return nil, fmt.Errorf("%s (expected start transitions)", err)
+			orderLine, beginLine := lines[i+1], lines[i+2]
+			i += 2
+
+			hhm.TransitionOrder = strings.Fields(string(orderLine.text))
+			_, err := transitionColumns(hhm.TransitionOrder,
+				new(seq.TProbs), new(seq.Prob), new(seq.Prob), new(seq.Prob))
+			if err != nil {
+				return errorf(orderLine, "%s", err)
+			}
+			begin := &hhm.Begin
+			err = readTransitionColumns(hhm.TransitionOrder,
+				strings.Fields(string(beginLine.text)), &begin.Transitions,
+				&begin.NeffM, &begin.NeffI, &begin.NeffD)
+			if err != nil {
+				return errorf(beginLine,
+					"Could not read start transitions: %s", err)
 			}
 
 			// Get the ordering of the alphabet.
 			hmm.Alphabet = make([]seq.Residue, 0, 20)
 			residues := bytes.Split(trim(line[3:]), []byte{'\t'})
 			for _, residue := range residues {
+				residue = trim(residue)
+				if len(residue) != 1 {
+					return errorf(l, "Invalid residue '%s' in alphabet.",
+						residue)
+				}
 				hmm.Alphabet = append(hmm.Alphabet, seq.Residue(residue[0]))
 			}
 
 			// Remember those null probabilities? Well, we have an alphabet now.
+			if nullFields == nil {
+				return errorf(l, "No NULL emissions before the alphabet.")
+			}
 			ep, err := readEmissions(hmm.Alphabet, nullFields)
 			if err != nil {
-				return nil, fmt.Errorf("Could not read NULL emissions '%s': %s",
-					strings.Join(nullFields, " "), err)
+				return errorf(nullLine,
+					"Could not read NULL emissions: %s", err)
 			}
 			hmm.Null = *ep
 		default: // finally, reading a node in the HMM
@@ -256,26 +437,36 @@ func readHMM(buf *bytes.Buffer) (hmm *seq.HMM, err error) {
 			// followed by 3 diversity (the 'neff' stuff) scores.
 			//
 			// Also, each field is separated by spaces OR tabs. Lovely, eh?
-			line2, err := demandLine(buf)
-			if err != nil {
-				return nil, fmt.Errorf("%s (expected transition probs)", err)
+			if hmm.Alphabet == nil {
+				return errorf(l, "Expected the alphabet before any nodes.")
 			}
+			if i+1 >= len(lines) {
+				return errorf(l, "Expected transition probabilities after "+
+					"the match emissions.")
+			}
+			l2 := lines[i+1]
+			i++
+
 			fields1 := strings.Fields(string(line))
-			fields2 := strings.Fields(string(line2))
+			fields2 := strings.Fields(string(l2.text))
+			if len(fields1) < 2+len(hmm.Alphabet) {
+				return errorf(l, "Expected a residue, a node number and %d "+
+					"match emissions.", len(hmm.Alphabet))
+			}
 			node := seq.HMMNode{
 				Residue: seq.Residue(fields1[0][0]),
 			}
 
+			var err error
 			node.NodeNum, err = strconv.Atoi(fields1[1])
 			if err != nil {
-				return nil, fmt.Errorf("Could not parse node number '%s': %s",
+				return errorf(l, "Could not parse node number '%s': %s",
 					fields1[1], err)
 			}
 
 			ep, err := readEmissions(hmm.Alphabet, fields1[2:])
 			if err != nil {
-				return nil, fmt.Errorf("Could not read emissions '%s': %s",
-					strings.Join(fields1[2:], " "), err)
+				return errorf(l, "Could not read emissions: %s", err)
 			}
 			node.MatEmit = *ep
 
@@ -284,28 +475,26 @@ func readHMM(buf *bytes.Buffer) (hmm *seq.HMM, err error) {
 				node.InsEmit.Set(residue, hmm.Null.Lookup(residue))
 			}
 
-			node.Transitions, err = readTransitions(fields2)
+			err = readTransitionColumns(hhm.TransitionOrder, fields2,
+				&node.Transitions, &node.NeffM, &node.NeffI, &node.NeffD)
 			if err != nil {
-				return nil, fmt.Errorf("Could not read transitions '%s': %s",
-					strings.Join(fields2, " "), err)
-			}
-
-			node.NeffM, node.NeffI, node.NeffD, err = readDiversity(fields2[7:])
-			if err != nil {
-				return nil, fmt.Errorf("Could not read diversity '%s': %s",
-					strings.Join(fields2[7:], " "), err)
+				return errorf(l2, "Could not read transitions: %s", err)
 			}
 
 			hmm.Nodes = append(hmm.Nodes, node)
 		}
 	}
-	return hmm, nil
+	return nil
 }
 
 func readEmissions(alphabet []seq.Residue, flds []string) (*seq.EProbs, error) {
 	var p seq.Prob
 	var err error
 
+	if len(flds) < len(alphabet) {
+		return nil, fmt.Errorf("Expected %d probabilities but got %d.",
+			len(alphabet), len(flds))
+	}
 	ep := seq.NewEProbs(alphabet)
 	for i := 0; i < len(alphabet); i++ {
 		if p, err = readProb(flds[i]); err != nil {
@@ -316,53 +505,35 @@ func readEmissions(alphabet []seq.Residue, flds []string) (*seq.EProbs, error) {
 	return &ep, nil
 }
 
-func readTransitions(fields []string) (tp seq.TProbs, err error) {
-	if tp.MM, err = readProb(fields[0]); err != nil {
-		return
-	}
-	if tp.MI, err = readProb(fields[1]); err != nil {
-		return
-	}
-	if tp.MD, err = readProb(fields[2]); err != nil {
-		return
-	}
-	if tp.IM, err = readProb(fields[3]); err != nil {
-		return
-	}
-	if tp.II, err = readProb(fields[4]); err != nil {
-		return
-	}
-	if tp.DM, err = readProb(fields[5]); err != nil {
-		return
-	}
-	if tp.DD, err = readProb(fields[6]); err != nil {
-		return
-	}
-	return
-}
-
-func readDiversity(fields []string) (m, i, d seq.Prob, err error) {
-	if m, err = readNeff(fields[0]); err != nil {
-		return
-	}
-	if i, err = readNeff(fields[1]); err != nil {
-		return
+// readTransitionColumns reads transition probabilities and diversity values
+// in the given column order.
+func readTransitionColumns(
+	order, fields []string,
+	tp *seq.TProbs,
+	neffM, neffI, neffD *seq.Prob,
+) error {
+	cols, err := transitionColumns(order, tp, neffM, neffI, neffD)
+	if err != nil {
+		return err
 	}
-	if d, err = readNeff(fields[2]); err != nil {
-		return
+	if len(fields) < len(cols) {
+		return fmt.Errorf("Expected %d columns but got %d.",
+			len(cols), len(fields))
 	}
-	return
-}
-
-func demandLine(buf *bytes.Buffer) ([]byte, error) {
-	line, err := buf.ReadBytes('\n')
-	if err == io.EOF {
-		return nil, fmt.Errorf("Unexpected EOF when reading HMM in hhm.")
+	if len(order) == 0 {
+		order = hhmTransitionOrder
 	}
-	if err != nil {
-		return nil, err
+	for i, p := range cols {
+		if isNeffColumn(order[i]) {
+			*p, err = readNeff(fields[i])
+		} else {
+			*p, err = readProb(fields[i])
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return trim(line), nil
+	return nil
 }
 
 // readProb reads a probability (transition or emissions) from an hhm file and
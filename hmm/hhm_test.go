@@ -1,12 +1,15 @@
 package hmm
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -62,6 +65,224 @@ func TestReadWrite(t *testing.T) {
 	}
 }
 
+func TestReadWriteHMMSection(t *testing.T) {
+	original, err := ioutil.ReadFile("yal001c.hhm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhm, err := ReadHHM(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !hhm.Begin.Transitions.MD.IsMin() ||
+		hhm.Begin.Transitions.IM != -0.011 {
+		t.Fatalf("Begin transitions were not read: %#v",
+			hhm.Begin.Transitions)
+	}
+
+	written := new(bytes.Buffer)
+	if err := WriteHHM(written, hhm); err != nil {
+		t.Fatalf("%s", err)
+	}
+	hmmSection := func(bs []byte) []byte {
+		return bs[bytes.Index(bs, []byte("\nNULL"))+1:]
+	}
+	if !bytes.Equal(hmmSection(original), hmmSection(written.Bytes())) {
+		t.Fatalf("Writing the HMM did not reproduce the original. %s",
+			firstDiff(hmmSection(original), hmmSection(written.Bytes())))
+	}
+}
+
+func TestTransitionOrder(t *testing.T) {
+	original, err := ioutil.ReadFile("yal001c.hhm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhm, err := ReadHHM(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Writing with a different column order and reading it back should
+	// produce the same values.
+	hhm.TransitionOrder = []string{
+		"Neff_D", "D->D", "D->M", "I->I", "I->M", "M->D", "M->I", "M->M",
+		"Neff_I", "Neff",
+	}
+	written := new(bytes.Buffer)
+	if err := WriteHHM(written, hhm); err != nil {
+		t.Fatalf("%s", err)
+	}
+	reordered, err := ReadHHM(written)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if reordered.TransitionOrder[0] != "Neff_D" {
+		t.Fatalf("Expected 'Neff_D' first but got %q.",
+			reordered.TransitionOrder)
+	}
+	begin, expected := reordered.Begin, hhm.Begin
+	if begin.Transitions != expected.Transitions ||
+		begin.NeffM != expected.NeffM || begin.NeffD != expected.NeffD {
+		t.Fatalf("Expected begin state %#v but got %#v.", expected, begin)
+	}
+	for i, node := range reordered.HMM.Nodes {
+		expected := hhm.HMM.Nodes[i]
+		if node.Transitions != expected.Transitions ||
+			node.NeffM != expected.NeffM || node.NeffD != expected.NeffD {
+			t.Fatalf("Node %d: Expected %#v but got %#v.",
+				i+1, expected, node)
+		}
+	}
+}
+
+func TestReadHHMErrors(t *testing.T) {
+	original, err := ioutil.ReadFile("yal001c_1-11.hhm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	lines := bytes.SplitAfter(original, []byte{'\n'})
+
+	// Every truncation of the file before the "//" line must be reported as
+	// an error.
+	for i := 1; !bytes.HasPrefix(lines[i], []byte("//")); i++ {
+		truncated := bytes.Join(lines[:i], nil)
+		_, err := ReadHHM(bytes.NewReader(truncated))
+		if _, ok := err.(*ParseError); !ok {
+			t.Fatalf("Truncating after line %d: Expected a *ParseError "+
+				"but got '%v'.", i, err)
+		}
+	}
+
+	// Remove the last half of the first node's match emissions.
+	corrupt := make([][]byte, len(lines))
+	copy(corrupt, lines)
+	half := lines[35][:len(lines[35])/2]
+	corrupt[35] = append(append([]byte(nil), half...), '\n')
+	_, err = ReadHHM(bytes.NewReader(bytes.Join(corrupt, nil)))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected a *ParseError but got '%v'.", err)
+	}
+	if perr.Section != SectionHMM || perr.Line != 36 ||
+		!strings.HasPrefix(perr.Text, "M 1") {
+		t.Fatalf("Unexpected error: %s", perr)
+	}
+
+	// A corrupt HHM in a database shouldn't stop the HHMs after it from
+	// being read.
+	db := append(bytes.Join(corrupt, nil), original...)
+	r := NewHHMReader(bytes.NewReader(db))
+	if _, err := r.Read(); err == nil {
+		t.Fatalf("Expected an error for the corrupt HHM.")
+	}
+	if _, err := r.Read(); err != nil {
+		t.Fatalf("%s", err)
+	}
+}
+
+func TestReadHHMMeta(t *testing.T) {
+	original, err := ioutil.ReadFile("yal001c.hhm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhm, err := ReadHHM(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	meta := hhm.Meta
+	if meta.MatchStates != 240 || meta.Columns != 240 {
+		t.Fatalf("Expected 240 match states and 240 columns but got %d "+
+			"and %d.", meta.MatchStates, meta.Columns)
+	}
+	filter := Filter{
+		Passed:        78,
+		Total:         78,
+		MaxIdentity:   90,
+		MinQueryScore: -20,
+		Diff:          100,
+	}
+	if meta.Filter != filter {
+		t.Fatalf("Expected filter %#v but got %#v.", filter, meta.Filter)
+	}
+	created := time.Date(2012, time.October, 30, 22, 22, 21, 0, time.UTC)
+	if !meta.Created.Equal(created) {
+		t.Fatalf("Expected date %s but got %s.", created, meta.Created)
+	}
+
+	// The lines that were read are written unchanged.
+	metaLines := func(hhm *HHM) []string {
+		buf := new(bytes.Buffer)
+		if err := WriteHHM(buf, hhm); err != nil {
+			t.Fatalf("%s", err)
+		}
+		var lines []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			for _, tag := range []string{"DATE", "LENG", "FILT"} {
+				if strings.HasPrefix(line, tag) {
+					lines = append(lines, line)
+				}
+			}
+		}
+		return lines
+	}
+	expected := []string{
+		"DATE  Tue Oct 30 22:22:21 2012",
+		"LENG  240 match states, 240 columns in multiple alignment",
+		"FILT  78 out of 78 sequences passed filter " +
+			"(-id 90 -cov 0 -qid 0 -qsc -20.00 -diff 100)",
+	}
+	if got := metaLines(hhm); strings.Join(got, "\n") !=
+		strings.Join(expected, "\n") {
+		t.Fatalf("Expected %q but got %q.", expected, got)
+	}
+
+	// Changed fields are written instead.
+	hhm.Meta.Filter.MaxIdentity = 80
+	hhm.Meta.Created = created.AddDate(1, 0, 0)
+	expected = []string{
+		"DATE  Wed Oct 30 22:22:21 2013",
+		"LENG  11 match states, 11 columns in multiple alignment",
+		"FILT  78 out of 78 sequences passed filter " +
+			"(-id 80 -cov 0 -qid 0 -qsc -20.00 -diff 100)",
+	}
+	if got := metaLines(hhm.Slice(1, 12)); strings.Join(got, "\n") !=
+		strings.Join(expected, "\n") {
+		t.Fatalf("Expected %q but got %q.", expected, got)
+	}
+
+	// LENG must agree with the number of nodes.
+	wrong := bytes.Replace(original,
+		[]byte("LENG  240 match"), []byte("LENG  241 match"), 1)
+	_, err = ReadHHM(bytes.NewReader(wrong))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected a *ParseError but got '%v'.", err)
+	}
+	if perr.Section != SectionMeta || perr.Line != 7 {
+		t.Fatalf("Unexpected error: %s", perr)
+	}
+
+	// LENG and FILT lines in other formats are kept as they are.
+	other := bytes.Replace(original,
+		[]byte("78 out of 78"), []byte("all"), 1)
+	other = bytes.Replace(other,
+		[]byte("LENG  240 match"), []byte("LENG  many match"), 1)
+	hhm, err = ReadHHM(bytes.NewReader(other))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !strings.HasPrefix(hhm.Meta.Leng, "many match states") ||
+		!strings.HasPrefix(hhm.Meta.Filt, "all sequences") {
+		t.Fatalf("Expected the LENG and FILT lines but got '%s' and '%s'.",
+			hhm.Meta.Leng, hhm.Meta.Filt)
+	}
+	if hhm.Meta.MatchStates != 0 || hhm.Meta.Columns != 0 ||
+		hhm.Meta.Filter != (Filter{}) {
+		t.Fatalf("Unexpected LENG and FILT values: %#v", hhm.Meta)
+	}
+}
+
 func BenchmarkReadWrite(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		r, w := getFiles()
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/TuftsBCB/io/fasta"
 	"github.com/TuftsBCB/io/msa"
@@ -30,7 +32,7 @@ func WriteHHM(w io.Writer, hhm *HHM) error {
 	if _, err := buf.WriteString("#\n"); err != nil {
 		return err
 	}
-	if err := writeHMM(buf, hhm.HMM); err != nil {
+	if err := writeHMM(buf, hhm); err != nil {
 		return err
 	}
 	if _, err := buf.WriteString("//\n"); err != nil {
@@ -71,16 +73,14 @@ func writeMeta(buf *bufio.Writer, meta Meta, hmm *seq.HMM) (err error) {
 	if len(meta.Com) > 0 {
 		w("COM   %s", meta.Com)
 	}
-	if len(meta.Date) > 0 {
-		w("DATE  %s", meta.Date)
+	if date := dateStr(meta); len(date) > 0 {
+		w("DATE  %s", date)
 	}
-	if len(meta.Leng) > 0 {
-		// Not sure if this is right. ???
-		m := len(hmm.Nodes)
-		w("LENG  %d match states, %d columns in multiple alignment", m, m)
+	if leng := lengStr(meta, hmm); len(leng) > 0 {
+		w("LENG  %s", leng)
 	}
-	if len(meta.Filt) > 0 {
-		w("FILT  %s", meta.Filt)
+	if filt := filtStr(meta); len(filt) > 0 {
+		w("FILT  %s", filt)
 	}
 	w("NEFF  %f", meta.Neff)
 	if meta.EvdLambda != 0 || meta.EvdMu != 0 {
@@ -97,6 +97,54 @@ func writeMeta(buf *bufio.Writer, meta Meta, hmm *seq.HMM) (err error) {
 	return nil
 }
 
+// dateStr returns the DATE of an hhm file. The DATE that was read is kept
+// if it agrees with Created.
+func dateStr(meta Meta) string {
+	if meta.Created.IsZero() || readDate(meta.Date).Equal(meta.Created) {
+		return meta.Date
+	}
+	return meta.Created.Format(time.ANSIC)
+}
+
+// lengStr returns the LENG of an hhm file. The LENG that was read is kept if
+// it agrees with the number of nodes and alignment columns. Otherwise, it is
+// generated from them. (When the number of columns is unknown, it is the
+// number of nodes.) If there is neither a LENG nor a number of columns, an
+// empty string is returned.
+func lengStr(meta Meta, hmm *seq.HMM) string {
+	if len(meta.Leng) == 0 && meta.Columns == 0 {
+		return ""
+	}
+	m, cols := len(hmm.Nodes), meta.Columns
+	if cols == 0 {
+		cols = m
+	}
+	if rm, rcols, err := readLeng(meta.Leng); err == nil {
+		if rm == m && rcols == cols {
+			return meta.Leng
+		}
+	}
+	return fmt.Sprintf("%d match states, %d columns in multiple alignment",
+		m, cols)
+}
+
+// filtStr returns the FILT of an hhm file. The FILT that was read is kept if
+// it agrees with Filter. Otherwise, it is generated from Filter with every
+// option.
+func filtStr(meta Meta) string {
+	if meta.Filter == (Filter{}) {
+		return meta.Filt
+	}
+	if f, err := readFilter(meta.Filt); err == nil && f == meta.Filter {
+		return meta.Filt
+	}
+	f := meta.Filter
+	return fmt.Sprintf("%d out of %d sequences passed filter "+
+		"(-id %g -cov %g -qid %g -qsc %0.2f -diff %d)",
+		f.Passed, f.Total, f.MaxIdentity, f.MinCoverage, f.MinQueryIdentity,
+		f.MinQueryScore, f.Diff)
+}
+
 func writeSecondary(buf *bufio.Writer, hhm *HHM) error {
 	ss := hhm.Secondary
 	towrite := make([]seq.Sequence, 0, 5)
@@ -125,7 +173,9 @@ func writeMSA(buf *bufio.Writer, hhm *HHM) error {
 	return msa.WriteA3M(buf, hhm.MSA)
 }
 
-func writeHMM(buf *bufio.Writer, hmm *seq.HMM) (err error) {
+// writeHMM writes the HMM section of an hhm file in the same layout used by
+// hhmake.
+func writeHMM(buf *bufio.Writer, hhm *HHM) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			var ok bool
@@ -141,6 +191,11 @@ func writeHMM(buf *bufio.Writer, hmm *seq.HMM) (err error) {
 			panic(err)
 		}
 	}
+	hmm := hhm.HMM
+	order := hhm.TransitionOrder
+	if len(order) == 0 {
+		order = hhmTransitionOrder
+	}
 
 	w("NULL   ")
 	must(writeEmissions(buf, hmm.Alphabet, hmm.Null))
@@ -149,17 +204,21 @@ func writeHMM(buf *bufio.Writer, hmm *seq.HMM) (err error) {
 	w("HMM    ")
 	must(writeAlphabet(buf, hmm.Alphabet))
 	w("\n")
-	w("       M->M\tM->I\tM->D\tI->M\tI->I\tD->M\tD->D\tNeff\tNeff_I\tNeff_D\n")
-	w("       0\t*\t0\t*\t*\t*\t*\t*\t*\t*\n")
+	w("       %s\n", strings.Join(order, "\t"))
+
+	begin := hhm.Begin
+	w("       ")
+	must(writeTransitions(buf, order, begin.Transitions,
+		begin.NeffM, begin.NeffI, begin.NeffD))
+	w("\n")
 
 	for _, node := range hmm.Nodes {
-		w("%c %d  ", node.Residue, node.NodeNum)
+		w("%c %-4d ", node.Residue, node.NodeNum)
 		must(writeEmissions(buf, hmm.Alphabet, node.MatEmit))
-		w("  %d\n", node.NodeNum)
-		w("   ")
-		must(writeTransitions(buf, node.Transitions))
-		w("\t")
-		must(writeDiversity(buf, node.NeffM, node.NeffI, node.NeffD))
+		w("%d\n", node.NodeNum)
+		w("       ")
+		must(writeTransitions(buf, order, node.Transitions,
+			node.NeffM, node.NeffI, node.NeffD))
 		w("\n\n")
 	}
 
@@ -167,59 +226,67 @@ func writeHMM(buf *bufio.Writer, hmm *seq.HMM) (err error) {
 }
 
 func writeAlphabet(buf *bufio.Writer, alphabet []seq.Residue) error {
-	alpha := make([]string, len(alphabet))
-	for i, residue := range alphabet {
-		alpha[i] = fmt.Sprintf("%c", residue)
+	for _, residue := range alphabet {
+		if _, err := fmt.Fprintf(buf, "%c\t", residue); err != nil {
+			return err
+		}
 	}
-	_, err := buf.WriteString(strings.Join(alpha, "\t"))
-	return err
+	return nil
 }
 
 func writeEmissions(
 	buf *bufio.Writer, alphabet []seq.Residue, ep seq.EProbs) error {
 
-	probs := make([]string, len(alphabet))
-	for i, residue := range alphabet {
-		probs[i] = probStr(ep.Lookup(residue))
+	for _, residue := range alphabet {
+		if _, err := buf.WriteString(probStr(ep.Lookup(residue))); err != nil {
+			return err
+		}
+		if err := buf.WriteByte('\t'); err != nil {
+			return err
+		}
 	}
-	_, err := buf.WriteString(strings.Join(probs, "\t"))
-	return err
-}
-
-func writeTransitions(buf *bufio.Writer, tp seq.TProbs) error {
-	towrite := []string{
-		probStr(tp.MM),
-		probStr(tp.MI),
-		probStr(tp.MD),
-		probStr(tp.IM),
-		probStr(tp.II),
-		probStr(tp.DM),
-		probStr(tp.DD),
-	}
-	_, err := buf.WriteString(strings.Join(towrite, "\t"))
-	return err
+	return nil
 }
 
-func writeDiversity(buf *bufio.Writer, m, i, d seq.Prob) error {
-	towrite := []string{
-		neffStr(m),
-		neffStr(i),
-		neffStr(d),
+// writeTransitions writes transition probabilities and diversity values in
+// the given column order.
+func writeTransitions(
+	buf *bufio.Writer,
+	order []string,
+	tp seq.TProbs,
+	neffM, neffI, neffD seq.Prob,
+) error {
+	cols, err := transitionColumns(order, &tp, &neffM, &neffI, &neffD)
+	if err != nil {
+		return err
 	}
-	_, err := buf.WriteString(strings.Join(towrite, "\t"))
-	return err
+	for i, p := range cols {
+		var s string
+		if isNeffColumn(order[i]) {
+			s = neffStr(*p)
+		} else {
+			s = probStr(*p)
+		}
+		if _, err := buf.WriteString(s + "\t"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func probStr(p seq.Prob) string {
 	if p.IsMin() {
 		return "*"
 	}
-	scaled := int(-seq.Prob(hmmScale) * p)
+	scaled := int(math.Floor(-hmmScale*float64(p) + 0.5))
 	return fmt.Sprintf("%d", scaled)
 }
 
 func neffStr(p seq.Prob) string {
-	scaled := int(seq.Prob(hmmScale) * p)
+	if p.IsMin() {
+		return "*"
+	}
+	scaled := int(math.Floor(hmmScale*float64(p) + 0.5))
 	return fmt.Sprintf("%d", scaled)
 }
 
@@ -1,80 +1,48 @@
 package hmm
 
 import (
-	"bufio"
-	"bytes"
-	"fmt"
-	"io"
+	"github.com/TuftsBCB/seq"
 )
 
-// WriteHMM writes an hmm file that can be read by HMMER.
-//
-// Currently, this function is broken. Do not use.
-func WriteHMM(w io.Writer, hmm *HMM) error {
-	buf := bufio.NewWriter(w)
-	if err := writeMeta(buf, hmm.Meta, hmm.HMM); err != nil {
-		return err
-	}
-	if err := writeHMM(buf, hmm.HMM); err != nil {
-		return err
-	}
-	if _, err := buf.WriteString("//\n"); err != nil {
-		return err
-	}
-	return buf.Flush()
-}
-
-// ReadHMM reads an hmm file produced by HMMER.
-//
-// Currently, this function is broken. Do not use.
-func ReadHMM(r io.Reader) (*HMM, error) {
-	// An hmm file as two logical sections: 1) Meta data and 2) the HMM.
-	bmeta, bhmm := new(bytes.Buffer), new(bytes.Buffer)
+// HMM corresponds to an hmm file produced by HMMER.
+type HMM struct {
+	Meta Meta
+	HMM  *seq.HMM
 
-	scanner := bufio.NewScanner(r)
-	parsingMeta := true
-MAIN:
-	for scanner.Scan() {
-		line := trim(scanner.Bytes())
+	// The insertion emissions and transitions of the begin state (which
+	// HMMER calls node 0).
+	Begin BeginState
 
-		// First check if we should do a mode change.
-		// i.e., a line starting with 'HMM' means switching from parsing meta
-		// data to parsing the actual HMM.
-		// Finally, a line starting with '\\' means STOP.
-		switch {
-		case hasPrefix(line, "HMM"):
-			parsingMeta = false
-		case hasPrefix(line, "//"):
-			break MAIN
-		}
+	// The overall match emission composition of the model (from the COMPO
+	// line). It has no probabilities if the file has no COMPO line.
+	Compo seq.EProbs
 
-		// Now add the bytes to the appropriate buffer based on the mode.
-		var err error
-		if parsingMeta {
-			_, err = bmeta.Write(append(line, '\n'))
-		} else {
-			_, err = bhmm.Write(append(line, '\n'))
-		}
-		if err != nil {
-			return nil, fmt.Errorf("Error updating buffer for hmm: %s", err)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("Error reading hmm: %s", err)
-	}
-
-	meta, err := readMeta(bmeta)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading meta data from hmm: %s", err)
-	}
+	// Per node annotations, in correspondence with HMM.Nodes.
+	Annotations []NodeAnnotation
+}
 
-	hmm, err := readHMM(bhmm)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading HMM data from hmm: %s", err)
-	}
+// BeginState corresponds to the begin state of a profile HMM, which isn't
+// represented in a seq.HMM. Transitions from the begin state are stored in
+// the MM (B->M1), MI (B->I0) and MD (B->D1) fields.
+//
+// hhm files have no insertion emissions, but they have a full set of
+// transitions and diversity values for the begin state, which are all kept.
+type BeginState struct {
+	InsEmit      seq.EProbs
+	Transitions  seq.TProbs
+	NeffM, NeffI seq.Prob
+	NeffD        seq.Prob
+}
 
-	return &HMM{
-		Meta: meta,
-		HMM:  hmm,
-	}, nil
+// NodeAnnotation corresponds to the annotations at the end of the match
+// emission line of each node in an HMMER file. Absent annotations are stored
+// as '-' (which is also how HMMER writes them).
+type NodeAnnotation struct {
+	// The column in the training alignment that this node maps to, or 0
+	// if the alignment map is absent.
+	Map int
+
+	// Consensus residue, reference annotation, model mask and consensus
+	// structure annotation.
+	Cons, RF, MM, CS seq.Residue
 }
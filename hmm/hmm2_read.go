@@ -0,0 +1,237 @@
+package hmm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// readHMMER2 reads the part of a HMMER2 file following the header (which has
+// already been read by readHMMERMeta).
+//
+// HMMER2 files store each probability as an integer score: 1000 times the
+// log_2 of the probability divided by a null probability. The null
+// probability is the NULE emission of a residue for match and insert
+// emissions, 1/|alphabet| for NULE itself and 1 for transitions. So the log_2
+// probability is simply score/1000 plus the log_2 null probability.
+//
+// HMMER2 files have a few things that have no place in an HMM value: the
+// special state transitions (XT), the null model transitions (NULT), the EVD
+// parameters (EVD) and the local entry (b->m) and exit (m->e) transitions of
+// each node. The XT, NULT and EVD lines are kept in Meta.Extra. B->M1 is read
+// from the begin transitions that precede the first node, and the m->e
+// transition of the last node is used for its M->M transition (which is how
+// HMMER3 files store the transition to the end state). All local entries
+// (b->m) and all other local exits are dropped.
+func readHMMER2(lr *lineReader, hmm *HMM) error {
+	alphabet := hmm.HMM.Alphabet
+	meta := &hmm.Meta
+
+	// HMMER2 capitalizes the alphabet type, but HMMER3 doesn't.
+	meta.Alph = strings.ToLower(meta.Alph)
+
+	// The null emissions are in the header, so find them and take them out
+	// of the extra header lines.
+	uniform := seq.Prob(-math.Log2(float64(len(alphabet))))
+	extra := meta.Extra[:0]
+	for _, line := range meta.Extra {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "NULE" {
+			extra = append(extra, line)
+			continue
+		}
+		hmm.HMM.Null = seq.NewEProbs(alphabet)
+		if len(fields)-1 != len(alphabet) {
+			return lr.errorf("Expected %d NULE scores but got %d.",
+				len(alphabet), len(fields)-1)
+		}
+		for i, residue := range alphabet {
+			p, err := readBitScore(fields[1+i], uniform)
+			if err != nil {
+				return lr.errorf("Could not read NULE: %s", err)
+			}
+			hmm.HMM.Null.Set(residue, p)
+		}
+	}
+	meta.Extra = extra
+	if hmm.HMM.Null.Probs == nil {
+		return lr.errorf("No NULE line found in the HMMER2 header.")
+	}
+
+	// The line after the alphabet contains the names of each transition.
+	line, err := lr.demand("transition names")
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(line, []byte("m->m")) {
+		return lr.errorf("Expected transition names but got '%s'.", line)
+	}
+
+	// The begin state has transitions to the core model (B->M), B->I (which
+	// is always '*') and B->D1.
+	if line, err = lr.demand("begin transitions"); err != nil {
+		return err
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) != 3 {
+		return lr.errorf("Expected 3 begin transitions but got '%s'.", line)
+	}
+	begin := &hmm.Begin.Transitions
+	for i, p := range []*seq.Prob{&begin.MM, &begin.MI, &begin.MD} {
+		if *p, err = readBitScore(fields[i], 0); err != nil {
+			return lr.errorf("Could not read begin transitions: %s", err)
+		}
+	}
+
+	var lastExit seq.Prob
+	for {
+		if line, err = lr.demand("a node or '//'"); err != nil {
+			return err
+		}
+		if hasPrefix(trim(line), "//") {
+			break
+		}
+		if len(trim(line)) == 0 {
+			continue
+		}
+		node, annotation, exit, err := readHMMER2Node(lr, hmm, line)
+		if err != nil {
+			return err
+		}
+		hmm.HMM.Nodes = append(hmm.HMM.Nodes, node)
+		hmm.Annotations = append(hmm.Annotations, annotation)
+		lastExit = exit
+	}
+	if n := len(hmm.HMM.Nodes); n > 0 {
+		hmm.HMM.Nodes[n-1].Transitions.MM = lastExit
+	}
+	return nil
+}
+
+// readHMMER2Node reads the three lines of a node in a HMMER2 file. The first
+// line (which has already been read) has the node number, match emissions and
+// an optional MAP annotation. The second has the RF annotation and insert
+// emissions. The third has the CS annotation and transitions (including the
+// local entry and exit transitions). The local exit (m->e) is returned.
+func readHMMER2Node(
+	lr *lineReader,
+	hmm *HMM,
+	line []byte,
+) (seq.HMMNode, NodeAnnotation, seq.Prob, error) {
+	node := seq.HMMNode{}
+	annotation := NodeAnnotation{Cons: '-', RF: '-', MM: '-', CS: '-'}
+	alphabet := hmm.HMM.Alphabet
+	null := hmm.HMM.Null
+	var err error
+
+	fields := strings.Fields(string(line))
+	if len(fields) != 1+len(alphabet) && len(fields) != 2+len(alphabet) {
+		return node, annotation, 0,
+			lr.errorf("Expected %d match emissions in '%s'.",
+				len(alphabet), line)
+	}
+	if node.NodeNum, err = strconv.Atoi(fields[0]); err != nil {
+		return node, annotation, 0,
+			lr.errorf("Could not parse node number '%s': %s", fields[0], err)
+	}
+	if node.NodeNum != len(hmm.HMM.Nodes)+1 {
+		return node, annotation, 0, lr.errorf("Expected node %d but got %d.",
+			len(hmm.HMM.Nodes)+1, node.NodeNum)
+	}
+	ep, err := readBitEmissions(alphabet, null, fields[1:1+len(alphabet)])
+	if err != nil {
+		return node, annotation, 0,
+			lr.errorf("Could not read match emissions: %s", err)
+	}
+	node.MatEmit = *ep
+	node.Residue = consensus(alphabet, node.MatEmit)
+	if len(fields) == 2+len(alphabet) && hmm.Meta.Map {
+		m, err := strconv.Atoi(fields[1+len(alphabet)])
+		if err != nil {
+			return node, annotation, 0,
+				lr.errorf("Invalid MAP annotation '%s': %s",
+					fields[1+len(alphabet)], err)
+		}
+		annotation.Map = m
+	}
+
+	if line, err = lr.demand("insert emissions"); err != nil {
+		return node, annotation, 0, err
+	}
+	fields = strings.Fields(string(line))
+	if len(fields) != 1+len(alphabet) || len(fields[0]) != 1 {
+		return node, annotation, 0,
+			lr.errorf("Expected an RF annotation and %d insert emissions "+
+				"in '%s'.", len(alphabet), line)
+	}
+	annotation.RF = seq.Residue(fields[0][0])
+	ep, err = readBitEmissions(alphabet, null, fields[1:])
+	if err != nil {
+		return node, annotation, 0,
+			lr.errorf("Could not read insert emissions: %s", err)
+	}
+	node.InsEmit = *ep
+
+	if line, err = lr.demand("transitions"); err != nil {
+		return node, annotation, 0, err
+	}
+	fields = strings.Fields(string(line))
+	if len(fields) != 10 || len(fields[0]) != 1 {
+		return node, annotation, 0,
+			lr.errorf("Expected a CS annotation and 9 transitions in '%s'.",
+				line)
+	}
+	annotation.CS = seq.Residue(fields[0][0])
+	tp := &node.Transitions
+	probs := []*seq.Prob{&tp.MM, &tp.MI, &tp.MD, &tp.IM, &tp.II, &tp.DM, &tp.DD}
+	for i, p := range probs {
+		if *p, err = readBitScore(fields[1+i], 0); err != nil {
+			return node, annotation, 0,
+				lr.errorf("Could not read transitions: %s", err)
+		}
+	}
+	exit, err := readBitScore(fields[9], 0)
+	if err != nil {
+		return node, annotation, 0,
+			lr.errorf("Could not read transitions: %s", err)
+	}
+	return node, annotation, exit, nil
+}
+
+func readBitEmissions(
+	alphabet seq.Alphabet,
+	null seq.EProbs,
+	fields []string,
+) (*seq.EProbs, error) {
+	if len(fields) != len(alphabet) {
+		return nil, fmt.Errorf("Expected %d scores but got %d.",
+			len(alphabet), len(fields))
+	}
+	ep := seq.NewEProbs(alphabet)
+	for i, residue := range alphabet {
+		p, err := readBitScore(fields[i], null.Lookup(residue))
+		if err != nil {
+			return nil, err
+		}
+		ep.Set(residue, p)
+	}
+	return &ep, nil
+}
+
+// readBitScore reads an integer score from a HMMER2 file and returns the log_2
+// probability it corresponds to, given the log_2 null probability. A score of
+// '*' corresponds to a probability of zero.
+func readBitScore(fstr string, null seq.Prob) (seq.Prob, error) {
+	if fstr == "*" {
+		return seq.MinProb, nil
+	}
+	score, err := strconv.Atoi(fstr)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading score '%s': %s", fstr, err)
+	}
+	return seq.Prob(float64(score)/1000) + null, nil
+}
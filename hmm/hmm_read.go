@@ -0,0 +1,525 @@
+package hmm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// hmmerAminoNull corresponds to the background amino acid frequencies that
+// HMMER uses for its null model. (They are the BLOSUM62 background
+// frequencies, in the order "ACDEFGHIKLMNPQRSTVWY".)
+var hmmerAminoNull = map[seq.Residue]float64{
+	'A': 0.0787945, 'C': 0.0151600, 'D': 0.0535222, 'E': 0.0668298,
+	'F': 0.0397062, 'G': 0.0695071, 'H': 0.0229198, 'I': 0.0590092,
+	'K': 0.0594422, 'L': 0.0963728, 'M': 0.0237718, 'N': 0.0414386,
+	'P': 0.0482904, 'Q': 0.0395639, 'R': 0.0540978, 'S': 0.0683364,
+	'T': 0.0540687, 'V': 0.0673417, 'W': 0.0114135, 'Y': 0.0304133,
+}
+
+// ReadHMM reads an hmm file produced by HMMER. Only the first HMM in the input
+// is read. (Use an HMMReader to read all of them.) If the input has no HMM,
+// then io.EOF is returned.
+//
+// The HMMER3 formats (i.e., "HMMER3/b" through "HMMER3/f") and the HMMER2
+// format (i.e., "HMMER2.0") are supported. Older formats (HMMER 1.x and SAM
+// models) are not.
+//
+// HMMER files store probabilities as negative natural logarithms. They are
+// converted to log_2 probabilities, which is how probabilities are stored in
+// HMMs read from hhm files.
+//
+// HMMER3 files do not contain a NULL model, so the NULL emissions are set to
+// the background frequencies that HMMER uses: the BLOSUM62 background for
+// amino acid alphabets and a uniform distribution otherwise.
+//
+// HMMER2 files store integer scores relative to the NULL model in the file
+// (the NULE line), which are converted to log_2 probabilities. HMMER2 has no
+// insertion emissions for the begin state, so Begin.InsEmit is empty. The
+// per node local entry and exit transitions, the special state transitions
+// and the EVD parameters are not part of the HMM, but the XT, NULT and EVD
+// header lines are kept in Meta.Extra.
+func ReadHMM(r io.Reader) (*HMM, error) {
+	return readHMMER(newLineReader(r))
+}
+
+// lineReader reads lines while keeping track of line numbers, so that errors
+// can report where they happened.
+type lineReader struct {
+	buf    *bufio.Reader
+	lineno int
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{buf: bufio.NewReader(r)}
+}
+
+// next returns the next line without any trailing whitespace. io.EOF is
+// returned only when there are no more lines.
+func (lr *lineReader) next() ([]byte, error) {
+	line, err := lr.buf.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	lr.lineno++
+
+	// Entries in an ffindex data file are terminated by a NUL byte.
+	line = bytes.TrimLeft(line, "\x00")
+	return bytes.TrimRight(line, " \t\r\n"), nil
+}
+
+// demand is like next, except io.EOF is reported as an unexpected error that
+// mentions what was expected.
+func (lr *lineReader) demand(expected string) ([]byte, error) {
+	line, err := lr.next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Unexpected EOF after line %d (expected %s).",
+			lr.lineno, expected)
+	}
+	return line, err
+}
+
+func (lr *lineReader) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("Error on line %d: %s",
+		lr.lineno, fmt.Sprintf(format, v...))
+}
+
+func readHMMER(lr *lineReader) (*HMM, error) {
+	var line []byte
+	var err error
+	for len(line) == 0 {
+		if line, err = lr.next(); err != nil {
+			return nil, err
+		}
+	}
+	hmmer2 := hasPrefix(line, "HMMER2.0")
+	if !hmmer2 && !hasPrefix(line, "HMMER3") {
+		return nil, lr.errorf("Unrecognized HMMER format '%s'.", line)
+	}
+
+	hmm := &HMM{HMM: new(seq.HMM)}
+	hmm.Meta.FormatVersion = string(line)
+	if err := readHMMERMeta(lr, hmm); err != nil {
+		return nil, err
+	}
+	if hmmer2 {
+		if err := readHMMER2(lr, hmm); err != nil {
+			return nil, err
+		}
+		if err := checkLeng(lr, hmm); err != nil {
+			return nil, err
+		}
+		return hmm, nil
+	}
+
+	// The line after the alphabet contains the names of each transition.
+	if line, err = lr.demand("transition names"); err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(line, []byte("m->m")) {
+		return nil, lr.errorf("Expected transition names but got '%s'.", line)
+	}
+
+	// The COMPO line is optional.
+	if line, err = lr.demand("COMPO or insert emissions"); err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) > 0 && fields[0] == "COMPO" {
+		ep, err := readLogEmissions(hmm.HMM.Alphabet, fields[1:])
+		if err != nil {
+			return nil, lr.errorf("Could not read COMPO: %s", err)
+		}
+		hmm.Compo = *ep
+
+		if line, err = lr.demand("insert emissions"); err != nil {
+			return nil, err
+		}
+		fields = strings.Fields(string(line))
+	}
+
+	// Now the begin state: insert emissions followed by transitions.
+	ep, err := readLogEmissions(hmm.HMM.Alphabet, fields)
+	if err != nil {
+		return nil, lr.errorf("Could not read begin insert emissions: %s", err)
+	}
+	hmm.Begin.InsEmit = *ep
+	if line, err = lr.demand("begin transitions"); err != nil {
+		return nil, err
+	}
+	fields = strings.Fields(string(line))
+	if hmm.Begin.Transitions, err = readLogTransitions(fields); err != nil {
+		return nil, lr.errorf("Could not read begin transitions: %s", err)
+	}
+
+	for {
+		if line, err = lr.demand("a node or '//'"); err != nil {
+			return nil, err
+		}
+		if hasPrefix(trim(line), "//") {
+			break
+		}
+		if len(trim(line)) == 0 {
+			continue
+		}
+		node, annotation, err := readHMMERNode(lr, hmm, line)
+		if err != nil {
+			return nil, err
+		}
+		hmm.HMM.Nodes = append(hmm.HMM.Nodes, node)
+		hmm.Annotations = append(hmm.Annotations, annotation)
+	}
+
+	if err := checkLeng(lr, hmm); err != nil {
+		return nil, err
+	}
+	hmm.HMM.Null = hmmerNull(hmm.HMM.Alphabet)
+	return hmm, nil
+}
+
+// checkLeng returns an error if the LENG of the HMM doesn't match its number
+// of nodes.
+func checkLeng(lr *lineReader, hmm *HMM) error {
+	if leng, err := strconv.Atoi(hmm.Meta.Leng); err == nil {
+		if leng != len(hmm.HMM.Nodes) {
+			return lr.errorf("LENG is %d but there are %d nodes.",
+				leng, len(hmm.HMM.Nodes))
+		}
+	}
+	return nil
+}
+
+// readHMMERMeta reads all header lines up to and including the line starting
+// with "HMM", which contains the alphabet.
+func readHMMERMeta(lr *lineReader, hmm *HMM) error {
+	meta := &hmm.Meta
+	for {
+		line, err := lr.demand("header or 'HMM' line")
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			continue
+		}
+		tag, val := fields[0], str(line[len(fields[0]):])
+
+		switch tag {
+		case "NAME":
+			meta.Name = val
+		case "ACC":
+			meta.Acc = val
+		case "DESC":
+			meta.Desc = val
+		case "LENG":
+			meta.Leng = val
+		case "MAXL":
+			if meta.MaxL, err = strconv.Atoi(val); err != nil {
+				return lr.errorf("Invalid MAXL '%s': %s", val, err)
+			}
+		case "ALPH":
+			meta.Alph = val
+		case "RF":
+			meta.RF = val == "yes"
+		case "MM":
+			meta.MM = val == "yes"
+		case "CONS":
+			meta.Cons = val == "yes"
+		case "CS":
+			meta.CS = val == "yes"
+		case "MAP":
+			meta.Map = val == "yes"
+		case "DATE":
+			meta.Date = val
+			meta.Created = readDate(val)
+		case "COM":
+			if len(meta.Com) > 0 {
+				meta.Com += "\n"
+			}
+			meta.Com += val
+		case "NSEQ":
+			if meta.NSeq, err = strconv.Atoi(val); err != nil {
+				return lr.errorf("Invalid NSEQ '%s': %s", val, err)
+			}
+		case "EFFN":
+			if meta.EffN, err = strconv.ParseFloat(val, 64); err != nil {
+				return lr.errorf("Invalid EFFN '%s': %s", val, err)
+			}
+		case "CKSUM":
+			cksum, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return lr.errorf("Invalid CKSUM '%s': %s", val, err)
+			}
+			meta.Cksum = uint32(cksum)
+		case "GA", "TC", "NC":
+			cutoffs, err := readCutoffs(fields[1:])
+			if err != nil {
+				return lr.errorf("Invalid %s '%s': %s", tag, val, err)
+			}
+			switch tag {
+			case "GA":
+				meta.GA = cutoffs
+			case "TC":
+				meta.TC = cutoffs
+			case "NC":
+				meta.NC = cutoffs
+			}
+		case "STATS":
+			if len(fields) != 5 || fields[1] != "LOCAL" {
+				meta.Extra = append(meta.Extra, string(line))
+				continue
+			}
+			var stats *Stats
+			switch fields[2] {
+			case "MSV":
+				stats = &meta.StatsMSV
+			case "VITERBI":
+				stats = &meta.StatsViterbi
+			case "FORWARD":
+				stats = &meta.StatsForward
+			default:
+				meta.Extra = append(meta.Extra, string(line))
+				continue
+			}
+			stats.Loc, err = strconv.ParseFloat(fields[3], 64)
+			if err != nil {
+				return lr.errorf("Invalid STATS '%s': %s", val, err)
+			}
+			stats.Lambda, err = strconv.ParseFloat(fields[4], 64)
+			if err != nil {
+				return lr.errorf("Invalid STATS '%s': %s", val, err)
+			}
+		case "HMM":
+			if len(fields) < 2 {
+				return lr.errorf("No alphabet in '%s'.", line)
+			}
+			hmm.HMM.Alphabet = make(seq.Alphabet, 0, 20)
+			for _, residue := range fields[1:] {
+				if len(residue) != 1 {
+					return lr.errorf("Invalid residue '%s' in alphabet.",
+						residue)
+				}
+				hmm.HMM.Alphabet = append(hmm.HMM.Alphabet,
+					seq.Residue(residue[0]))
+			}
+			return nil
+		default:
+			meta.Extra = append(meta.Extra, string(line))
+		}
+	}
+}
+
+// readHMMERNode reads the three lines of a node. The first line (which has
+// already been read) has the node number, match emissions and annotations.
+// The second has insertion emissions and the third has transitions.
+func readHMMERNode(
+	lr *lineReader,
+	hmm *HMM,
+	line []byte,
+) (seq.HMMNode, NodeAnnotation, error) {
+	var node seq.HMMNode
+	var annotation NodeAnnotation
+	var err error
+	alphabet := hmm.HMM.Alphabet
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 1+len(alphabet) {
+		return node, annotation,
+			lr.errorf("Expected %d match emissions in '%s'.",
+				len(alphabet), line)
+	}
+	if node.NodeNum, err = strconv.Atoi(fields[0]); err != nil {
+		return node, annotation,
+			lr.errorf("Could not parse node number '%s': %s", fields[0], err)
+	}
+	if node.NodeNum != len(hmm.HMM.Nodes)+1 {
+		return node, annotation, lr.errorf("Expected node %d but got %d.",
+			len(hmm.HMM.Nodes)+1, node.NodeNum)
+	}
+
+	ep, err := readLogEmissions(alphabet, fields[1:1+len(alphabet)])
+	if err != nil {
+		return node, annotation,
+			lr.errorf("Could not read match emissions: %s", err)
+	}
+	node.MatEmit = *ep
+
+	annotation, err = readAnnotation(fields[1+len(alphabet):])
+	if err != nil {
+		return node, annotation, lr.errorf("%s", err)
+	}
+	if hmm.Meta.Cons && annotation.Cons != '-' {
+		node.Residue = upper(annotation.Cons)
+	} else {
+		node.Residue = consensus(alphabet, node.MatEmit)
+	}
+
+	if line, err = lr.demand("insert emissions"); err != nil {
+		return node, annotation, err
+	}
+	ep, err = readLogEmissions(alphabet, strings.Fields(string(line)))
+	if err != nil {
+		return node, annotation,
+			lr.errorf("Could not read insert emissions: %s", err)
+	}
+	node.InsEmit = *ep
+
+	if line, err = lr.demand("transitions"); err != nil {
+		return node, annotation, err
+	}
+	node.Transitions, err = readLogTransitions(strings.Fields(string(line)))
+	if err != nil {
+		return node, annotation,
+			lr.errorf("Could not read transitions: %s", err)
+	}
+	return node, annotation, nil
+}
+
+// readAnnotation reads the annotation columns at the end of a match emission
+// line. The number of columns depends on the format version: "HMMER3/b" has
+// MAP, RF and CS, "HMMER3/c" through "HMMER3/e" add CONS and "HMMER3/f" adds
+// MM.
+func readAnnotation(fields []string) (NodeAnnotation, error) {
+	annotation := NodeAnnotation{Cons: '-', RF: '-', MM: '-', CS: '-'}
+	if len(fields) < 3 || len(fields) > 5 {
+		return annotation, fmt.Errorf("Expected 3, 4 or 5 annotations but "+
+			"got '%s'.", strings.Join(fields, " "))
+	}
+	for _, f := range fields[1:] {
+		if len(f) != 1 {
+			return annotation, fmt.Errorf("Invalid annotation '%s'.",
+				strings.Join(fields, " "))
+		}
+	}
+	switch len(fields) {
+	case 3:
+		annotation.RF = seq.Residue(fields[1][0])
+		annotation.CS = seq.Residue(fields[2][0])
+	case 4:
+		annotation.Cons = seq.Residue(fields[1][0])
+		annotation.RF = seq.Residue(fields[2][0])
+		annotation.CS = seq.Residue(fields[3][0])
+	case 5:
+		annotation.Cons = seq.Residue(fields[1][0])
+		annotation.RF = seq.Residue(fields[2][0])
+		annotation.MM = seq.Residue(fields[3][0])
+		annotation.CS = seq.Residue(fields[4][0])
+	}
+	if fields[0] != "-" {
+		m, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return annotation, fmt.Errorf("Invalid MAP annotation '%s': %s",
+				fields[0], err)
+		}
+		annotation.Map = m
+	}
+	return annotation, nil
+}
+
+func readCutoffs(fields []string) ([]float64, error) {
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("Expected two scores.")
+	}
+	cutoffs := make([]float64, 2)
+	for i, f := range fields {
+		c, err := strconv.ParseFloat(strings.TrimRight(f, ";"), 64)
+		if err != nil {
+			return nil, err
+		}
+		cutoffs[i] = c
+	}
+	return cutoffs, nil
+}
+
+func readLogEmissions(
+	alphabet seq.Alphabet,
+	fields []string,
+) (*seq.EProbs, error) {
+	if len(fields) != len(alphabet) {
+		return nil, fmt.Errorf("Expected %d probabilities but got %d.",
+			len(alphabet), len(fields))
+	}
+	ep := seq.NewEProbs(alphabet)
+	for i, residue := range alphabet {
+		p, err := readLogProb(fields[i])
+		if err != nil {
+			return nil, err
+		}
+		ep.Set(residue, p)
+	}
+	return &ep, nil
+}
+
+func readLogTransitions(fields []string) (tp seq.TProbs, err error) {
+	if len(fields) != 7 {
+		return tp, fmt.Errorf("Expected 7 transitions but got %d.", len(fields))
+	}
+	probs := []*seq.Prob{&tp.MM, &tp.MI, &tp.MD, &tp.IM, &tp.II, &tp.DM, &tp.DD}
+	for i, p := range probs {
+		if *p, err = readLogProb(fields[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readLogProb reads a probability stored as a negative natural logarithm (as
+// in HMMER files) and returns a Prob value in log_2 form.
+func readLogProb(fstr string) (seq.Prob, error) {
+	f, err := seq.NewProb(fstr)
+	if err != nil {
+		return f, fmt.Errorf("Error reading probability '%s': %s", fstr, err)
+	}
+	if f.IsMin() {
+		return f, nil
+	}
+	return -f / seq.Prob(math.Ln2), nil
+}
+
+// hmmerNull returns the background emissions used by HMMER for the given
+// alphabet.
+func hmmerNull(alphabet seq.Alphabet) seq.EProbs {
+	null := seq.NewEProbs(alphabet)
+	amino := len(alphabet) == len(hmmerAminoNull)
+	for _, residue := range alphabet {
+		if _, ok := hmmerAminoNull[residue]; !ok {
+			amino = false
+		}
+	}
+	for _, residue := range alphabet {
+		if amino {
+			null.Set(residue, seq.Prob(math.Log2(hmmerAminoNull[residue])))
+		} else {
+			null.Set(residue, seq.Prob(-math.Log2(float64(len(alphabet)))))
+		}
+	}
+	return null
+}
+
+// consensus returns the residue with the highest emission probability.
+func consensus(alphabet seq.Alphabet, ep seq.EProbs) seq.Residue {
+	best := alphabet[0]
+	for _, residue := range alphabet[1:] {
+		p := ep.Lookup(residue)
+		if !p.IsMin() && (ep.Lookup(best).IsMin() || p > ep.Lookup(best)) {
+			best = residue
+		}
+	}
+	return best
+}
+
+func upper(r seq.Residue) seq.Residue {
+	if r >= 'a' && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
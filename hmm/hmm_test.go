@@ -0,0 +1,190 @@
+package hmm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+func ExampleReadHMM() {
+	hmmf, err := os.Open("sermam.hmm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hmmf.Close()
+
+	profile, err := ReadHMM(hmmf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	meta := profile.Meta
+	node := profile.HMM.Nodes[3]
+	ratio := func(p seq.Prob) float64 { return math.Pow(2, float64(p)) }
+	fmt.Println(meta.Name, meta.Leng, len(profile.HMM.Nodes))
+	fmt.Println(meta.NSeq, meta.EffN, meta.Cksum)
+	fmt.Println(meta.StatsViterbi.Loc, meta.StatsViterbi.Lambda)
+	fmt.Printf("%s\n", profile.HMM.Alphabet)
+	fmt.Printf("%c %d %d\n", node.Residue, node.NodeNum,
+		profile.Annotations[3].Map)
+	fmt.Printf("%0.5f\n", -math.Log(ratio(node.MatEmit.Lookup('G'))))
+	fmt.Printf("%0.5f\n", -math.Log(ratio(node.Transitions.IM)))
+	fmt.Printf("%0.5f\n", -math.Log(ratio(profile.Begin.Transitions.MD)))
+	fmt.Println(profile.HMM.Nodes[233].Transitions.DD.IsMin())
+	// Output:
+	// sermam 234 234
+	// 27 1.380981 4089147503
+	// -11.6713 0.70357
+	// ACDEFGHIKLMNPQRSTVWY
+	// G 4 17
+	// 0.25127
+	// 0.61958
+	// 5.10085
+	// true
+}
+
+func TestReadWriteHMM(t *testing.T) {
+	for _, fname := range []string{"sermam.hmm", "sermam6.hmm"} {
+		original, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		profile, err := ReadHMM(bytes.NewReader(original))
+		if err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+
+		written := new(bytes.Buffer)
+		if err := WriteHMM(written, profile); err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+		if !bytes.Equal(original, written.Bytes()) {
+			t.Fatalf("%s: Writing the HMM did not reproduce the original. "+
+				"%s", fname, firstDiff(original, written.Bytes()))
+		}
+
+		again, err := ReadHMM(bytes.NewReader(written.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+		rewritten := new(bytes.Buffer)
+		if err := WriteHMM(rewritten, again); err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+		if !bytes.Equal(written.Bytes(), rewritten.Bytes()) {
+			t.Fatalf("%s: Round trip through ReadHMM is not stable.", fname)
+		}
+	}
+}
+
+func TestReadHMMER2(t *testing.T) {
+	read := func(fname string) *HMM {
+		f, err := os.Open(fname)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		defer f.Close()
+		profile, err := ReadHMM(f)
+		if err != nil {
+			t.Fatalf("%s: %s", fname, err)
+		}
+		return profile
+	}
+	// sermam6.hmm2 was made from sermam6.hmm, so their probabilities should
+	// only differ by the rounding of HMMER2 scores.
+	hmmer2, hmmer3 := read("sermam6.hmm2"), read("sermam6.hmm")
+	near := func(what string, p1, p2 seq.Prob) {
+		if p1.IsMin() != p2.IsMin() {
+			t.Fatalf("%s: Expected %s but got %s.", what, p2, p1)
+		}
+		if !p1.IsMin() && math.Abs(float64(p1-p2)) > 0.001 {
+			t.Fatalf("%s: Expected %s but got %s.", what, p2, p1)
+		}
+	}
+
+	meta := hmmer2.Meta
+	if meta.Name != "sermam6" || meta.Alph != "amino" || meta.NSeq != 27 {
+		t.Fatalf("Unexpected meta data: %#v", meta)
+	}
+	if len(meta.Extra) != 3 {
+		t.Fatalf("Expected XT, NULT and EVD in Extra but got %q.", meta.Extra)
+	}
+	if len(hmmer2.HMM.Nodes) != len(hmmer3.HMM.Nodes) {
+		t.Fatalf("Expected %d nodes but got %d.",
+			len(hmmer3.HMM.Nodes), len(hmmer2.HMM.Nodes))
+	}
+	for _, r := range hmmer2.HMM.Alphabet {
+		near(fmt.Sprintf("NULL %c", r),
+			hmmer2.HMM.Null.Lookup(r), hmmer3.HMM.Null.Lookup(r))
+	}
+	near("B->D1", hmmer2.Begin.Transitions.MD, hmmer3.Begin.Transitions.MD)
+	for i, node := range hmmer2.HMM.Nodes {
+		node3 := hmmer3.HMM.Nodes[i]
+		if hmmer2.Annotations[i].Map != hmmer3.Annotations[i].Map {
+			t.Fatalf("Node %d: Expected map %d but got %d.",
+				i+1, hmmer3.Annotations[i].Map, hmmer2.Annotations[i].Map)
+		}
+		for _, r := range hmmer2.HMM.Alphabet {
+			near(fmt.Sprintf("Node %d, match %c", i+1, r),
+				node.MatEmit.Lookup(r), node3.MatEmit.Lookup(r))
+		}
+		if i == len(hmmer2.HMM.Nodes)-1 {
+			if node.Transitions.MM != 0 {
+				t.Fatalf("Expected M->E of 0 but got %s.",
+					node.Transitions.MM)
+			}
+			continue
+		}
+		for _, r := range hmmer2.HMM.Alphabet {
+			near(fmt.Sprintf("Node %d, insert %c", i+1, r),
+				node.InsEmit.Lookup(r), node3.InsEmit.Lookup(r))
+		}
+		near(fmt.Sprintf("Node %d, M->M", i+1),
+			node.Transitions.MM, node3.Transitions.MM)
+		near(fmt.Sprintf("Node %d, I->I", i+1),
+			node.Transitions.II, node3.Transitions.II)
+		near(fmt.Sprintf("Node %d, D->D", i+1),
+			node.Transitions.DD, node3.Transitions.DD)
+	}
+}
+
+func TestReadHMMER2WithoutLeng(t *testing.T) {
+	// The exit of the last node doesn't depend on the LENG line.
+	text, err := ioutil.ReadFile("sermam6.hmm2")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	text = bytes.Replace(text, []byte("LENG  6\n"), []byte("LENG  six\n"), 1)
+	profile, err := ReadHMM(bytes.NewReader(text))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if profile.Meta.Leng != "six" {
+		t.Fatalf("Expected LENG 'six' but got '%s'.", profile.Meta.Leng)
+	}
+	last := profile.HMM.Nodes[len(profile.HMM.Nodes)-1]
+	if last.Transitions.MM != 0 {
+		t.Fatalf("Expected M->E of 0 but got %s.", last.Transitions.MM)
+	}
+}
+
+// firstDiff returns a description of the first line that differs between
+// two files.
+func firstDiff(expected, got []byte) string {
+	elines := bytes.Split(expected, []byte{'\n'})
+	glines := bytes.Split(got, []byte{'\n'})
+	for i := 0; i < len(elines) && i < len(glines); i++ {
+		if !bytes.Equal(elines[i], glines[i]) {
+			return fmt.Sprintf("Line %d differs.\nExpected: %q\nGot:      %q",
+				i+1, elines[i], glines[i])
+		}
+	}
+	return fmt.Sprintf("Expected %d lines but got %d.",
+		len(elines), len(glines))
+}
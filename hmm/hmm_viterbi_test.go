@@ -4,16 +4,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/TuftsBCB/seq"
 )
 
-func ExampleViterbiScore() {
+// The residues of the nodes of the sermam profile (its consensus) resemble a
+// serine protease, and share the GDSGGP motif of its catalytic serine.
+func ExampleReadHMM_serineProtease() {
 	query := "IVEGQDAEVGLSPWQVMLFRKSPQELLCGASLISDRWVLTAAHCLLYPPWDKNFTVDDLLVR" +
 		"IGKHSRTRYERKVEKISMLDKIYIHPRYNWKENLDRDIALLKLKRPIELSDYIHPVCLPDKQTAAKL" +
 		"LHAGFKGRVTGWGNRRETWTTSVAEVQPSVLQVVNLPLVERPVCKASTRIRITDNMFCAGYKPGEGK" +
 		"RGDACEGDSGGPFVMKSPYNNRWYQMGIVSWGEGCDRDGKYGFYTHVFRLKKWIQKVIDRLGS"
-	squery := seq.NewSequenceString("query", query)
 
 	hmmf, err := os.Open("sermam.hmm")
 	if err != nil {
@@ -25,7 +27,15 @@ func ExampleViterbiScore() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println(profile.HMM.ViterbiScore(squery))
+	cons := make([]seq.Residue, len(profile.HMM.Nodes))
+	for i, node := range profile.HMM.Nodes {
+		cons[i] = node.Residue
+	}
+	fmt.Printf("%s\n%s\n", query[:20], cons[:20])
+	fmt.Println(strings.Index(fmt.Sprintf("%s", cons), "GDSGGP")+1,
+		strings.Index(query, "GDSGGP")+1)
 	// Output:
-	// NotWorking
+	// IVEGQDAEVGLSPWQVMLFR
+	// IVGGEEAEKESVPWQVSLQA
+	// 182 203
 }
@@ -0,0 +1,223 @@
+package hmm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// defaultHMMERVersion is the format version written by WriteHMM when the
+// HMM's meta data does not specify a HMMER3 format.
+const defaultHMMERVersion = "HMMER3/f [3.1b2 | February 2015]"
+
+// WriteHMM writes an hmm file that can be read by HMMER.
+//
+// If the FormatVersion of the HMM is a HMMER3 format (e.g., "HMMER3/b [3.0 |
+// March 2010]"), then the file is written in that format. Otherwise, the
+// "HMMER3/f" format is used. The LENG line is always the number of nodes in
+// the HMM.
+//
+// If the begin state has no insertion emissions, then the NULL emissions are
+// used. If there are no node annotations, then each node's residue is used as
+// its consensus residue and all other annotations are absent.
+func WriteHMM(w io.Writer, hmm *HMM) error {
+	buf := bufio.NewWriter(w)
+	version := hmm.Meta.FormatVersion
+	if !strings.HasPrefix(version, "HMMER3/") || len(version) < 8 {
+		version = defaultHMMERVersion
+	}
+	if err := writeHMMERMeta(buf, version, hmm); err != nil {
+		return err
+	}
+	if err := writeHMMERNodes(buf, version[7], hmm); err != nil {
+		return err
+	}
+	if _, err := buf.WriteString("//\n"); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+func writeHMMERMeta(buf *bufio.Writer, version string, hmm *HMM) error {
+	var err error
+	w := func(format string, v ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(buf, format+"\n", v...)
+	}
+	yesno := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	cutoffs := func(tag string, scores []float64) {
+		if len(scores) == 2 {
+			w("%-5s %.2f %.2f;", tag, scores[0], scores[1])
+		}
+	}
+	stats := func(name string, s Stats) {
+		if s.Lambda != 0 {
+			w("STATS LOCAL %-8s %8.4f %8.5f", name, s.Loc, s.Lambda)
+		}
+	}
+	meta := hmm.Meta
+	format := version[7]
+
+	w("%s", version)
+	w("NAME  %s", meta.Name)
+	if len(meta.Acc) > 0 {
+		w("ACC   %s", meta.Acc)
+	}
+	if len(meta.Desc) > 0 {
+		w("DESC  %s", meta.Desc)
+	}
+	w("LENG  %d", len(hmm.HMM.Nodes))
+	if meta.MaxL > 0 {
+		w("MAXL  %d", meta.MaxL)
+	}
+	if len(meta.Alph) > 0 {
+		w("ALPH  %s", meta.Alph)
+	} else {
+		w("ALPH  amino")
+	}
+	w("RF    %s", yesno(meta.RF))
+	if format >= 'f' {
+		w("MM    %s", yesno(meta.MM))
+	}
+	if format >= 'c' {
+		w("CONS  %s", yesno(meta.Cons))
+	}
+	w("CS    %s", yesno(meta.CS))
+	w("MAP   %s", yesno(meta.Map))
+	if date := dateStr(meta); len(date) > 0 {
+		w("DATE  %s", date)
+	}
+	if len(meta.Com) > 0 {
+		for _, com := range strings.Split(meta.Com, "\n") {
+			w("COM   %s", com)
+		}
+	}
+	if meta.NSeq > 0 {
+		w("NSEQ  %d", meta.NSeq)
+	}
+	if meta.EffN > 0 {
+		w("EFFN  %f", meta.EffN)
+	}
+	if meta.Cksum > 0 {
+		w("CKSUM %d", meta.Cksum)
+	}
+	cutoffs("GA", meta.GA)
+	cutoffs("TC", meta.TC)
+	cutoffs("NC", meta.NC)
+	for _, extra := range meta.Extra {
+		w("%s", extra)
+	}
+	stats("MSV", meta.StatsMSV)
+	stats("VITERBI", meta.StatsViterbi)
+	stats("FORWARD", meta.StatsForward)
+	return err
+}
+
+func writeHMMERNodes(buf *bufio.Writer, version byte, hmm *HMM) error {
+	var err error
+	w := func(format string, v ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(buf, format, v...)
+	}
+	alphabet := hmm.HMM.Alphabet
+	emissions := func(ep seq.EProbs) {
+		for _, residue := range alphabet {
+			w(" %8s", logProbStr(ep.Lookup(residue)))
+		}
+	}
+	transitions := func(tp seq.TProbs) {
+		for _, p := range []seq.Prob{
+			tp.MM, tp.MI, tp.MD, tp.IM, tp.II, tp.DM, tp.DD,
+		} {
+			w(" %8s", logProbStr(p))
+		}
+	}
+	meta := hmm.Meta
+
+	w("HMM     ")
+	for _, residue := range alphabet {
+		w("     %c   ", residue)
+	}
+	w("\n        %8s %8s %8s %8s %8s %8s %8s\n",
+		"m->m", "m->i", "m->d", "i->m", "i->i", "d->m", "d->d")
+
+	if hmm.Compo.Probs != nil {
+		w("  COMPO ")
+		emissions(hmm.Compo)
+		w("\n")
+	}
+
+	w("        ")
+	if hmm.Begin.InsEmit.Probs != nil {
+		emissions(hmm.Begin.InsEmit)
+	} else {
+		emissions(hmm.HMM.Null)
+	}
+	w("\n        ")
+	transitions(hmm.Begin.Transitions)
+	w("\n")
+
+	for i, node := range hmm.HMM.Nodes {
+		annotation := NodeAnnotation{
+			Cons: node.Residue, RF: '-', MM: '-', CS: '-',
+		}
+		if len(hmm.Annotations) == len(hmm.HMM.Nodes) {
+			annotation = hmm.Annotations[i]
+		}
+		flag := func(set bool, r seq.Residue) seq.Residue {
+			if set {
+				return r
+			}
+			return '-'
+		}
+
+		w(" %6d ", i+1)
+		emissions(node.MatEmit)
+		if meta.Map && annotation.Map > 0 {
+			w(" %6d", annotation.Map)
+		} else {
+			w(" %6s", "-")
+		}
+		if version >= 'c' {
+			w(" %c", flag(meta.Cons, annotation.Cons))
+		}
+		w(" %c", flag(meta.RF, annotation.RF))
+		if version >= 'f' {
+			w(" %c", flag(meta.MM, annotation.MM))
+		}
+		w(" %c\n", flag(meta.CS, annotation.CS))
+
+		w("        ")
+		emissions(node.InsEmit)
+		w("\n        ")
+		transitions(node.Transitions)
+		w("\n")
+	}
+	return err
+}
+
+// logProbStr converts a log_2 probability to a negative natural logarithm as
+// written in HMMER files.
+func logProbStr(p seq.Prob) string {
+	if p.IsMin() {
+		return "*"
+	}
+	nat := -float64(p) * math.Ln2
+	if nat <= 0 {
+		nat = 0
+	}
+	return fmt.Sprintf("%.5f", nat)
+}
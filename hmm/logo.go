@@ -0,0 +1,234 @@
+package hmm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// InformationContent returns the information content in bits of the match
+// emissions of every node: log_2(N) minus the entropy of the emissions, where
+// N is the size of the alphabet.
+func InformationContent(hmm *seq.HMM) []float64 {
+	max := math.Log2(float64(len(hmm.Alphabet)))
+	ic := make([]float64, len(hmm.Nodes))
+	for i, node := range hmm.Nodes {
+		ic[i] = max
+		for _, r := range hmm.Alphabet {
+			if p := node.MatEmit.Lookup(r); !p.IsMin() {
+				ic[i] += math.Exp2(float64(p)) * float64(p)
+			}
+		}
+	}
+	return ic
+}
+
+// RelativeEntropy returns the relative entropy (Kullback-Leibler divergence)
+// in bits of the match emissions of every node with respect to the NULL
+// emissions of the HMM. If the HMM has no NULL emissions, a uniform
+// distribution is used.
+func RelativeEntropy(hmm *seq.HMM) []float64 {
+	uniform := -math.Log2(float64(len(hmm.Alphabet)))
+	re := make([]float64, len(hmm.Nodes))
+	for i, node := range hmm.Nodes {
+		for _, r := range hmm.Alphabet {
+			p := node.MatEmit.Lookup(r)
+			if p.IsMin() {
+				continue
+			}
+			null := uniform
+			if hmm.Null.Probs != nil && !hmm.Null.Lookup(r).IsMin() {
+				null = float64(hmm.Null.Lookup(r))
+			}
+			re[i] += math.Exp2(float64(p)) * (float64(p) - null)
+		}
+	}
+	return re
+}
+
+// ConsensusRule determines how the consensus residue of a node is chosen
+// from its match emissions.
+type ConsensusRule int
+
+const (
+	// ConsensusMax always uses the most probable residue in upper case.
+	ConsensusMax ConsensusRule = iota
+
+	// ConsensusHMMER uses the most probable residue, which is in upper case
+	// if its probability is at least 0.5 (for amino acids) or 0.9 (for
+	// other alphabets) and lower case otherwise. This is the rule HMMER
+	// uses for CONS annotations.
+	ConsensusHMMER
+
+	// ConsensusHHsuite uses the most probable residue in upper case if its
+	// probability is greater than 0.6, in lower case if it is greater than
+	// 0.4 and 'x' otherwise. This is the rule hhmake uses for the
+	// "Consensus" sequence.
+	ConsensusHHsuite
+)
+
+// Consensus returns the consensus residue of every node according to the
+// given rule.
+func Consensus(hmm *seq.HMM, rule ConsensusRule) []seq.Residue {
+	amino := len(hmm.Alphabet) >= 20
+	residues := make([]seq.Residue, len(hmm.Nodes))
+	for i, node := range hmm.Nodes {
+		best := consensus(hmm.Alphabet, node.MatEmit)
+		p := 0.0
+		if lp := node.MatEmit.Lookup(best); !lp.IsMin() {
+			p = math.Exp2(float64(lp))
+		}
+		best = upper(best)
+		switch rule {
+		case ConsensusMax:
+			residues[i] = best
+		case ConsensusHMMER:
+			if (amino && p >= 0.5) || p >= 0.9 {
+				residues[i] = best
+			} else {
+				residues[i] = lower(best)
+			}
+		case ConsensusHHsuite:
+			residues[i] = consensusResidue(best, p)
+		}
+	}
+	return residues
+}
+
+// LogoOptions control how a sequence logo is drawn by WriteLogo. Zero values
+// are replaced with defaults.
+type LogoOptions struct {
+	// The width of each column and the height of one bit in pixels.
+	// (Defaults: 20 and 40.)
+	ColumnWidth, BitHeight int
+
+	// When set, the height of each column is its relative entropy with
+	// respect to the NULL emissions instead of its information content.
+	// Columns with a negative relative entropy are empty.
+	RelativeEntropy bool
+
+	// Colors maps residues to SVG colors. Residues without a color are
+	// black. (Default: the "chemistry" colors used by WebLogo.)
+	Colors map[seq.Residue]string
+}
+
+// LogoColors are the WebLogo "chemistry" colors for amino acids.
+var LogoColors = map[seq.Residue]string{
+	'G': "green", 'S': "green", 'T': "green", 'Y': "green", 'C': "green",
+	'N': "purple", 'Q': "purple",
+	'K': "blue", 'R': "blue", 'H': "blue",
+	'D': "red", 'E': "red",
+	'A': "black", 'V': "black", 'L': "black", 'I': "black",
+	'P': "black", 'W': "black", 'F': "black", 'M': "black",
+}
+
+// WriteLogo draws a sequence logo of the match emissions of an HMM as an SVG
+// image. Each node is a column whose height is its information content (or
+// relative entropy), which is divided among residues in proportion to their
+// emission probabilities. The most probable residue is drawn on top.
+func WriteLogo(w io.Writer, hmm *seq.HMM, opts LogoOptions) error {
+	if opts.ColumnWidth <= 0 {
+		opts.ColumnWidth = 20
+	}
+	if opts.BitHeight <= 0 {
+		opts.BitHeight = 40
+	}
+	if opts.Colors == nil {
+		opts.Colors = LogoColors
+	}
+
+	heights := InformationContent(hmm)
+	maxBits := math.Log2(float64(len(hmm.Alphabet)))
+	if opts.RelativeEntropy {
+		heights = RelativeEntropy(hmm)
+		for _, h := range heights {
+			maxBits = math.Max(maxBits, h)
+		}
+	}
+
+	const margin = 30 // room for the axis and the node numbers
+	colw, bith := float64(opts.ColumnWidth), float64(opts.BitHeight)
+	width := margin + colw*float64(len(hmm.Nodes)) + 10
+	height := bith*math.Ceil(maxBits) + 2*margin
+	base := height - margin
+
+	buf := bufio.NewWriter(w)
+	pf := func(format string, v ...interface{}) {
+		fmt.Fprintf(buf, format, v...)
+	}
+	pf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	pf("<svg xmlns=\"http://www.w3.org/2000/svg\" "+
+		"width=\"%.0f\" height=\"%.0f\">\n", width, height)
+	pf("<g font-family=\"Arial, Helvetica, sans-serif\" " +
+		"font-weight=\"bold\">\n")
+
+	// The y axis, with a tick for every bit.
+	top := base - bith*math.Ceil(maxBits)
+	pf("<line x1=\"%d\" y1=\"%.2f\" x2=\"%d\" y2=\"%.2f\" "+
+		"stroke=\"black\"/>\n", margin-5, base, margin-5, top)
+	for bit := 0; bit <= int(math.Ceil(maxBits)); bit++ {
+		y := base - bith*float64(bit)
+		pf("<text x=\"%d\" y=\"%.2f\" font-size=\"10\" "+
+			"text-anchor=\"end\">%d</text>\n", margin-8, y+4, bit)
+	}
+	pf("<text x=\"10\" y=\"%.2f\" font-size=\"10\" "+
+		"transform=\"rotate(-90 10 %.2f)\">bits</text>\n",
+		base-bith*maxBits/2, base-bith*maxBits/2)
+
+	// Letters are drawn at a font size of 100, where the height of a capital
+	// letter is about 72 and its width is about 70. They are then scaled to
+	// fill their box.
+	for i, node := range hmm.Nodes {
+		x := margin + colw*float64(i)
+		letters := make([]logoLetter, 0, len(hmm.Alphabet))
+		total := 0.0
+		for _, r := range hmm.Alphabet {
+			if p := node.MatEmit.Lookup(r); !p.IsMin() {
+				l := logoLetter{r, math.Exp2(float64(p))}
+				letters = append(letters, l)
+				total += l.p
+			}
+		}
+		sort.Sort(byProb(letters))
+
+		y := base
+		for _, l := range letters {
+			h := bith * heights[i] * l.p / total
+			if h < 0.5 {
+				continue
+			}
+			color, ok := opts.Colors[l.r]
+			if !ok {
+				color = "black"
+			}
+			pf("<text transform=\"translate(%.2f %.2f) scale(%.4f %.4f)\" "+
+				"font-size=\"100\" fill=\"%s\">%c</text>\n",
+				x, y, colw/70, h/72, color, l.r)
+			y -= h
+		}
+		if (i+1)%10 == 0 || i == 0 {
+			pf("<text x=\"%.2f\" y=\"%.2f\" font-size=\"10\" "+
+				"text-anchor=\"middle\">%d</text>\n",
+				x+colw/2, base+14, node.NodeNum)
+		}
+	}
+	pf("</g>\n</svg>\n")
+	return buf.Flush()
+}
+
+type logoLetter struct {
+	r seq.Residue
+	p float64
+}
+
+// byProb sorts letters by increasing probability, so that the most probable
+// letter is drawn last (on top).
+type byProb []logoLetter
+
+func (ls byProb) Len() int           { return len(ls) }
+func (ls byProb) Less(i, j int) bool { return ls[i].p < ls[j].p }
+func (ls byProb) Swap(i, j int)      { ls[i], ls[j] = ls[j], ls[i] }
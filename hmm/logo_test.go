@@ -0,0 +1,107 @@
+package hmm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+func ExampleInformationContent() {
+	f, err := os.Open("sermam6.hmm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	hmm, err := ReadHMM(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ic := InformationContent(hmm.HMM)
+	re := RelativeEntropy(hmm.HMM)
+	cons := Consensus(hmm.HMM, ConsensusHMMER)
+	for i := range hmm.HMM.Nodes {
+		fmt.Printf("%d %c %.3f %.3f\n", i+1, cons[i], ic[i], re[i])
+	}
+	// Output:
+	// 1 i 1.189 0.951
+	// 2 v 0.953 0.700
+	// 3 g 0.950 0.698
+	// 4 G 2.677 2.280
+	// 5 e 0.260 0.147
+	// 6 e 0.405 0.268
+}
+
+func TestInformationContent(t *testing.T) {
+	alphabet := seq.NewAlphabet('A', 'C', 'G', 'T')
+	uniform, fixed := seq.NewEProbs(alphabet), seq.NewEProbs(alphabet)
+	for _, r := range alphabet {
+		uniform.Set(r, -2)
+		fixed.Set(r, seq.MinProb)
+	}
+	fixed.Set('G', 0)
+	nodes := []seq.HMMNode{
+		{Residue: 'A', NodeNum: 1, MatEmit: uniform},
+		{Residue: 'G', NodeNum: 2, MatEmit: fixed},
+	}
+	hmm := seq.NewHMM(nodes, alphabet, uniform)
+
+	ic := InformationContent(hmm)
+	if math.Abs(ic[0]) > 1e-9 || math.Abs(ic[1]-2) > 1e-9 {
+		t.Fatalf("Expected information content [0 2] but got %v.", ic)
+	}
+	re := RelativeEntropy(hmm)
+	if math.Abs(re[0]) > 1e-9 || math.Abs(re[1]-2) > 1e-9 {
+		t.Fatalf("Expected relative entropy [0 2] but got %v.", re)
+	}
+	cons := Consensus(hmm, ConsensusHHsuite)
+	if string(cons) != "xG" {
+		t.Fatalf("Expected consensus 'xG' but got '%s'.", cons)
+	}
+}
+
+func TestWriteLogo(t *testing.T) {
+	f, err := os.Open("sermam6.hmm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer f.Close()
+	hmm, err := ReadHMM(f)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for _, opts := range []LogoOptions{{}, {RelativeEntropy: true}} {
+		buf := new(bytes.Buffer)
+		if err := WriteLogo(buf, hmm.HMM, opts); err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		// The logo must be well formed XML with a letter for the consensus
+		// residue of the most conserved node (node 4, a glycine).
+		dec := xml.NewDecoder(buf)
+		letters := 0
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Invalid SVG: %s", err)
+			}
+			if cd, ok := tok.(xml.CharData); ok && string(cd) == "G" {
+				letters++
+			}
+		}
+		if letters == 0 {
+			t.Fatalf("No 'G' letters in the logo.")
+		}
+	}
+}
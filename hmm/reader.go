@@ -0,0 +1,231 @@
+package hmm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An HHMReader reads HHMs one at a time from a database of concatenated hhm
+// files. (Each HHM is terminated by a "//" line.) NUL bytes at the start of a
+// line are ignored, so that hhsuite "_hhm.ffdata" files may be read directly.
+type HHMReader struct {
+	lr *lineReader
+}
+
+// NewHHMReader creates a new HHMReader that is ready to read HHMs from some
+// io.Reader.
+func NewHHMReader(r io.Reader) *HHMReader {
+	return &HHMReader{newLineReader(r)}
+}
+
+// Read reads the next HHM in the input. When there are no more HHMs, io.EOF
+// is returned. Line numbers in errors are relative to the start of the input.
+//
+// After an error, Read may be called again to skip to the next HHM.
+func (r *HHMReader) Read() (*HHM, error) {
+	return readHHM(r.lr)
+}
+
+// ReadAll reads all remaining HHMs in the input. If an error is encountered,
+// processing is stopped, and the error is returned.
+func (r *HHMReader) ReadAll() ([]*HHM, error) {
+	hhms := make([]*HHM, 0, 10)
+	for {
+		hhm, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		hhms = append(hhms, hhm)
+	}
+	return hhms, nil
+}
+
+// An HMMReader reads HMMs one at a time from a database of concatenated hmm
+// files produced by HMMER. (e.g., Pfam-A.hmm.) Like an HHMReader, NUL bytes at
+// the start of a line are ignored.
+type HMMReader struct {
+	lr *lineReader
+}
+
+// NewHMMReader creates a new HMMReader that is ready to read HMMs from some
+// io.Reader.
+func NewHMMReader(r io.Reader) *HMMReader {
+	return &HMMReader{newLineReader(r)}
+}
+
+// Read reads the next HMM in the input. When there are no more HMMs, io.EOF
+// is returned. Line numbers in errors are relative to the start of the input.
+func (r *HMMReader) Read() (*HMM, error) {
+	return readHMMER(r.lr)
+}
+
+// ReadAll reads all remaining HMMs in the input. If an error is encountered,
+// processing is stopped, and the error is returned.
+func (r *HMMReader) ReadAll() ([]*HMM, error) {
+	hmms := make([]*HMM, 0, 10)
+	for {
+		hmm, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		hmms = append(hmms, hmm)
+	}
+	return hmms, nil
+}
+
+// An Index provides random access to the profiles in a database of
+// concatenated hhm or hmm files by name or accession. Both formats may be
+// mixed in the same database, but it is up to the caller to use the read
+// method that matches the format of each profile.
+type Index struct {
+	r io.ReadSeeker
+
+	// The profiles in the database, in the order they appear.
+	Entries []IndexEntry
+
+	keys map[string]int
+}
+
+// IndexEntry describes the location of a single profile in a database.
+type IndexEntry struct {
+	// The NAME of the profile and its ACC. (Only HMMER files have ACC lines.)
+	Name, Acc string
+
+	// The byte offset of the first line of the profile and its length in
+	// bytes, up to and including its "//" line.
+	Offset, Length int64
+}
+
+// NewIndex reads an entire database and records the location of every
+// profile in it. The ReadSeeker must remain open for as long as the index is
+// used.
+//
+// Each profile can be looked up by its full NAME, the first word of its NAME
+// (in hhsuite databases, this is often an identifier like "PF00001.19"), its
+// ACC or its ACC without a version suffix (e.g., "PF00001"). If more than one
+// profile has the same key, then the first one is used.
+func NewIndex(r io.ReadSeeker) (*Index, error) {
+	if _, err := r.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	idx := &Index{r: r, keys: make(map[string]int, 100)}
+	buf := bufio.NewReader(r)
+	var offset int64
+	var entry IndexEntry
+	inEntry, inHeader := false, false
+	for {
+		line, err := buf.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		start := offset
+		offset += int64(len(line))
+		line = trim(bytes.TrimLeft(line, "\x00"))
+
+		switch {
+		case !inEntry:
+			if len(line) == 0 {
+				continue
+			}
+			entry = IndexEntry{Offset: start}
+			inEntry, inHeader = true, true
+		case hasPrefix(line, "//"):
+			entry.Length = offset - entry.Offset
+			idx.add(entry)
+			inEntry = false
+			continue
+		}
+		if !inHeader {
+			continue
+		}
+		switch {
+		case hasPrefix(line, "NAME") && len(entry.Name) == 0:
+			entry.Name = str(line[4:])
+		case hasPrefix(line, "ACC") && len(entry.Acc) == 0:
+			entry.Acc = str(line[3:])
+		case hasPrefix(line, "SEQ"), hasPrefix(line, "HMM "):
+			inHeader = false
+		}
+	}
+	if inEntry {
+		return nil, fmt.Errorf("Profile starting at byte %d has no "+
+			"terminating '//'.", entry.Offset)
+	}
+	return idx, nil
+}
+
+func (idx *Index) add(entry IndexEntry) {
+	i := len(idx.Entries)
+	idx.Entries = append(idx.Entries, entry)
+
+	keys := []string{entry.Name, entry.Acc}
+	if fields := strings.Fields(entry.Name); len(fields) > 0 {
+		keys = append(keys, fields[0])
+	}
+	if dot := strings.LastIndex(entry.Acc, "."); dot > 0 {
+		keys = append(keys, entry.Acc[:dot])
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			continue
+		}
+		if _, ok := idx.keys[key]; !ok {
+			idx.keys[key] = i
+		}
+	}
+}
+
+// Lookup returns the entry of the profile with the given name or accession.
+func (idx *Index) Lookup(key string) (IndexEntry, bool) {
+	i, ok := idx.keys[key]
+	if !ok {
+		return IndexEntry{}, false
+	}
+	return idx.Entries[i], true
+}
+
+// ReadHHM reads the HHM with the given name or accession. Line numbers in
+// errors are relative to the start of the profile.
+func (idx *Index) ReadHHM(key string) (*HHM, error) {
+	r, err := idx.section(key)
+	if err != nil {
+		return nil, err
+	}
+	return readHHM(newLineReader(r))
+}
+
+// ReadHMM reads the HMMER HMM with the given name or accession. Line numbers
+// in errors are relative to the start of the profile.
+func (idx *Index) ReadHMM(key string) (*HMM, error) {
+	r, err := idx.section(key)
+	if err != nil {
+		return nil, err
+	}
+	return readHMMER(newLineReader(r))
+}
+
+// section seeks to the profile with the given key and returns a reader that
+// stops at the end of the profile.
+func (idx *Index) section(key string) (io.Reader, error) {
+	entry, ok := idx.Lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("No profile with name or accession '%s'.", key)
+	}
+	if _, err := idx.r.Seek(entry.Offset, 0); err != nil {
+		return nil, err
+	}
+	return io.LimitReader(idx.r, entry.Length), nil
+}
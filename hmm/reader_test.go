@@ -0,0 +1,125 @@
+package hmm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// hmmDatabase concatenates the HMMER test files into one database.
+func hmmDatabase(t *testing.T) []byte {
+	db := new(bytes.Buffer)
+	fnames := []string{"sermam6.hmm", "sermam.hmm", "sermam6.hmm2"}
+	for _, fname := range fnames {
+		bs, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		db.Write(bs)
+	}
+	return db.Bytes()
+}
+
+// hhmDatabase concatenates the sliced HHM test files into one database in the
+// style of an ffindex data file, where each entry ends with a NUL byte. Each
+// HHM is renamed so that it can be looked up.
+func hhmDatabase(t *testing.T) []byte {
+	db := new(bytes.Buffer)
+	for _, name := range []string{"yal001c_1-11", "yal001c_2-12"} {
+		bs, err := ioutil.ReadFile(name + ".hhm")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		bs = bytes.Replace(bs, []byte("NAME  YAL001C"),
+			[]byte("NAME  "+name), 1)
+		db.Write(bs)
+		db.WriteByte(0)
+	}
+	return db.Bytes()
+}
+
+func TestHMMReader(t *testing.T) {
+	hmms, err := NewHMMReader(bytes.NewReader(hmmDatabase(t))).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hmms) != 3 {
+		t.Fatalf("Expected 3 HMMs but got %d.", len(hmms))
+	}
+	for i, name := range []string{"sermam6", "sermam", "sermam6"} {
+		if hmms[i].Meta.Name != name {
+			t.Fatalf("Expected HMM %d to be '%s' but got '%s'.",
+				i, name, hmms[i].Meta.Name)
+		}
+	}
+	if len(hmms[1].HMM.Nodes) != 234 {
+		t.Fatalf("Expected 234 nodes but got %d.", len(hmms[1].HMM.Nodes))
+	}
+}
+
+func TestHHMReader(t *testing.T) {
+	hhms, err := NewHHMReader(bytes.NewReader(hhmDatabase(t))).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hhms) != 2 {
+		t.Fatalf("Expected 2 HHMs but got %d.", len(hhms))
+	}
+	for i, hhm := range hhms {
+		if len(hhm.HMM.Nodes) != 11 {
+			t.Fatalf("Expected 11 nodes in HHM %d but got %d.",
+				i, len(hhm.HMM.Nodes))
+		}
+	}
+	if hhms[1].MSA.Entries[0].Residues[0] != 'V' {
+		t.Fatalf("Second HHM did not start at the second residue.")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx, err := NewIndex(bytes.NewReader(hmmDatabase(t)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(idx.Entries) != 3 {
+		t.Fatalf("Expected 3 entries but got %d.", len(idx.Entries))
+	}
+
+	// Look up the same HMM by name and accession, with and without version.
+	for _, key := range []string{"sermam6", "PF99999.1", "PF99999"} {
+		hmm, err := idx.ReadHMM(key)
+		if err != nil {
+			t.Fatalf("%s: %s", key, err)
+		}
+		if hmm.Meta.Name != "sermam6" || len(hmm.HMM.Nodes) != 6 {
+			t.Fatalf("%s: Got the wrong HMM: %s", key, hmm.Meta.Name)
+		}
+	}
+	hmm, err := idx.ReadHMM("sermam")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hmm.HMM.Nodes) != 234 {
+		t.Fatalf("Expected 234 nodes but got %d.", len(hmm.HMM.Nodes))
+	}
+	if _, err := idx.ReadHMM("sermam7"); err == nil {
+		t.Fatalf("Expected an error for a missing HMM.")
+	}
+
+	idx, err = NewIndex(bytes.NewReader(hhmDatabase(t)))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hhm, err := idx.ReadHHM("yal001c_2-12")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if hhm.MSA.Entries[0].Residues[0] != 'V' {
+		t.Fatalf("Got the wrong HHM.")
+	}
+
+	_, err = NewIndex(bytes.NewReader([]byte("HMMER3/f\nNAME  x\n")))
+	if err == nil {
+		t.Fatalf("Expected an error for an unterminated profile.")
+	}
+}
@@ -0,0 +1,12 @@
+/*
+Package hmmer provides routines for reading the results of HMMER's search
+programs (e.g., hmmsearch, hmmscan, phmmer and jackhmmer). Both the default
+text output, including the alignment of every domain, and the tables written
+with the --tblout, --domtblout and --pfamtblout options can be read.
+
+Output is read one record (or one query report) at a time, so that the
+results of large searches need not be in memory at once. Alignments written
+with '-A' are in the Stockholm format, which can be read with
+msa.ReadStockholm.
+*/
+package hmmer
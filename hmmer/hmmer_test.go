@@ -0,0 +1,268 @@
+package hmmer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func ExampleTblReader() {
+	f, err := os.Open("pkinase.tbl")
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer f.Close()
+
+	r := NewTblReader(f)
+	for {
+		hit, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		fmt.Println(hit.Target, hit.Full.EValue, hit.Full.Score, hit.Dom)
+	}
+	// Output:
+	// sp|P06493|CDK1_HUMAN 1.2e-71 239.8 1
+	// sp|Q13523|PRP4B_HUMAN 3.4e-48 162.7 2
+	// tr|A0A0B4J2F0|A0A0B4J2F0_HUMAN 0.0071 14.6 1
+}
+
+func ExampleDomTblReader() {
+	f, err := os.Open("pkinase.domtbl")
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer f.Close()
+
+	doms, err := NewDomTblReader(f).ReadAll()
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	for _, d := range doms {
+		fmt.Printf("%s %d/%d %g env %d-%d ali %d-%d hmm %d-%d\n",
+			d.Target, d.Num, d.Of, d.IEValue, d.EnvFrom, d.EnvTo,
+			d.AliFrom, d.AliTo, d.HMMFrom, d.HMMTo)
+	}
+	// Output:
+	// sp|P06493|CDK1_HUMAN 1/1 1.5e-71 env 4-286 ali 4-286 hmm 1-264
+	// sp|Q13523|PRP4B_HUMAN 1/2 4.1e-45 env 690-887 ali 690-881 hmm 1-187
+	// sp|Q13523|PRP4B_HUMAN 2/2 0.74 env 943-1006 ali 948-1002 hmm 206-262
+	// tr|A0A0B4J2F0|A0A0B4J2F0_HUMAN 1/1 0.0089 env 3-96 ali 12-85 hmm 120-190
+}
+
+func openFile(t *testing.T, fname string) *os.File {
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return f
+}
+
+func TestReadTbl(t *testing.T) {
+	f := openFile(t, "pkinase.tbl")
+	defer f.Close()
+
+	hits, err := NewTblReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hits) != 3 {
+		t.Fatalf("Expected 3 hits but got %d.", len(hits))
+	}
+	expected := Hit{
+		Target:   "sp|Q13523|PRP4B_HUMAN",
+		Query:    "Pkinase",
+		QueryAcc: "PF00069.25",
+		Full:     Score{EValue: 3.4e-48, Score: 162.7, Bias: 0.3},
+		Best:     Score{EValue: 4.1e-45, Score: 152.5, Bias: 0},
+		Exp:      2.2,
+		Reg:      2,
+		Env:      2,
+		Dom:      2,
+		Rep:      2,
+		Inc:      1,
+		Description: "Serine/threonine-protein kinase PRP4 homolog " +
+			"OS=Homo sapiens OX=9606 GN=PRPF4B PE=1 SV=3",
+	}
+	if hits[1] != expected {
+		t.Fatalf("Expected\n%#v\nbut got\n%#v", expected, hits[1])
+	}
+	if hits[2].TargetAcc != "" || hits[2].Description != "" {
+		t.Fatalf("Expected an empty accession and description but got "+
+			"'%s' and '%s'.", hits[2].TargetAcc, hits[2].Description)
+	}
+}
+
+func TestReadScanDomTbl(t *testing.T) {
+	f := openFile(t, "cdk1.domtbl")
+	defer f.Close()
+
+	// The targets of hmmscan are profiles, so their ranges are the ranges
+	// of the profile, and the range of the query is the aligned sequence.
+	r := NewDomTblReader(f)
+	r.Program = "hmmscan"
+	doms, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(doms) != 2 {
+		t.Fatalf("Expected 2 domains but got %d.", len(doms))
+	}
+	d := doms[1]
+	if d.Program != "hmmscan" || d.Target != "Pkinase_Tyr" ||
+		d.Query != "sp|P06493|CDK1_HUMAN" || d.TargetLen != 259 {
+		t.Fatalf("Unexpected domain: %#v", d)
+	}
+	qstart, qend := d.QueryRange()
+	tstart, tend := d.TargetRange()
+	ranges := [4]int{6, 279, 3, 253}
+	if got := [4]int{qstart, qend, tstart, tend}; got != ranges {
+		t.Fatalf("Expected ranges %v but got %v.", ranges, got)
+	}
+}
+
+func TestReadPfamTbl(t *testing.T) {
+	f := openFile(t, "pkinase.pfamtbl")
+	defer f.Close()
+
+	hits, doms, err := NewPfamTblReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hits) != 3 || len(doms) != 4 {
+		t.Fatalf("Expected 3 hits and 4 domains but got %d and %d.",
+			len(hits), len(doms))
+	}
+	hit := Hit{
+		Target: "sp|Q13523|PRP4B_HUMAN",
+		Full:   Score{EValue: 3.4e-48, Score: 162.7, Bias: 0.3},
+		Exp:    2.2,
+		Dom:    2,
+		Description: "Serine/threonine-protein kinase PRP4 homolog " +
+			"OS=Homo sapiens OX=9606 GN=PRPF4B PE=1 SV=3",
+	}
+	if hits[1] != hit {
+		t.Fatalf("Expected\n%#v\nbut got\n%#v", hit, hits[1])
+	}
+
+	// Domains are sorted by score, and the columns are in a different order
+	// than in a --domtblout table.
+	dom := Domain{
+		Target:  "tr|A0A0B4J2F0|A0A0B4J2F0_HUMAN",
+		Num:     1,
+		IEValue: 0.0089,
+		Score:   14.3,
+		Bias:    0.1,
+		HMMFrom: 120,
+		HMMTo:   190,
+		AliFrom: 12,
+		AliTo:   85,
+		EnvFrom: 3,
+		EnvTo:   96,
+	}
+	if doms[2] != dom {
+		t.Fatalf("Expected\n%#v\nbut got\n%#v", dom, doms[2])
+	}
+}
+
+func TestPfamTblSkipHits(t *testing.T) {
+	f := openFile(t, "pkinase.pfamtbl")
+	defer f.Close()
+
+	r := NewPfamTblReader(f)
+	if _, err := r.ReadHit(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	dom, err := r.ReadDomain()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if dom.Target != "sp|P06493|CDK1_HUMAN" || dom.Score != 239.5 {
+		t.Fatalf("Unexpected first domain: %#v", dom)
+	}
+	if _, err := r.ReadHit(); err != io.EOF {
+		t.Fatalf("Expected io.EOF but got '%v'.", err)
+	}
+}
+
+func TestReadDescriptions(t *testing.T) {
+	// Descriptions keep their inner spaces, and may be missing.
+	tbl := "# comment\n" +
+		"t1 - q1 - 1e-10 40.0 0.1 1e-10 40.0 0.1 1.0 1 0 0 1 1 1 1 " +
+		"a  description\twith   spaces  \r\n" +
+		"\n" +
+		"t2\tacc\tq1\t-\t1\t1\t0\t1\t1\t0\t1.0\t1\t0\t0\t1\t1\t1\t0\n" +
+		"t3 - q1 - 1e-10 40.0 0.1 1e-10 40.0 0.1 1.0 1 0 0 1 1 1 1 -\n"
+	hits, err := NewTblReader(strings.NewReader(tbl)).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	descs := []string{"a  description\twith   spaces", "", ""}
+	if len(hits) != len(descs) {
+		t.Fatalf("Expected %d hits but got %d.", len(descs), len(hits))
+	}
+	for i, hit := range hits {
+		if hit.Description != descs[i] {
+			t.Fatalf("Expected description '%s' but got '%s'.",
+				descs[i], hit.Description)
+		}
+	}
+	if hits[1].TargetAcc != "acc" || hits[1].Inc != 0 {
+		t.Fatalf("Unexpected hit: %#v", hits[1])
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		fname string
+		line  int
+		old   string
+		new   string
+	}{
+		{"pkinase.tbl", 5, "162.7", "high"},
+		{"pkinase.tbl", 6, "   0   1   1   1   0 -", ""},
+		{"pkinase.domtbl", 6, " 948 ", " 948.5 "},
+		{"pkinase.pfamtbl", 7, "   2   2.2", " two 2.2"},
+		{"pkinase.pfamtbl", 13, "hmm-en", "end"},
+		{"pkinase.pfamtbl", 16, "152.5", "-"},
+	}
+	for _, test := range tests {
+		original, err := ioutil.ReadFile(test.fname)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		lines := strings.SplitAfter(string(original), "\n")
+		if !strings.Contains(lines[test.line-1], test.old) {
+			t.Fatalf("%s: Line %d does not contain '%s'.",
+				test.fname, test.line, test.old)
+		}
+		lines[test.line-1] = strings.Replace(
+			lines[test.line-1], test.old, test.new, 1)
+		corrupt := strings.NewReader(strings.Join(lines, ""))
+
+		switch test.fname {
+		case "pkinase.tbl":
+			_, err = NewTblReader(corrupt).ReadAll()
+		case "pkinase.domtbl":
+			_, err = NewDomTblReader(corrupt).ReadAll()
+		case "pkinase.pfamtbl":
+			_, _, err = NewPfamTblReader(corrupt).ReadAll()
+		}
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("%s: Line %d: Expected a *ParseError but got '%v'.",
+				test.fname, test.line, err)
+		}
+		if perr.Line != test.line {
+			t.Fatalf("%s: Line %d: Unexpected error: %s",
+				test.fname, test.line, perr)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package hmmer
+
+import (
+	"fmt"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// MSA returns the alignment of the domain as a multiple sequence alignment
+// with two rows: the consensus of the profile and the sequence. The match
+// columns are the match states of the profile, so residues of the sequence
+// that are inserted between match states are insertions.
+//
+// The profile's row is named after the profile and the sequence's row is
+// named after the sequence and its aligned range (e.g., "CDK1_HUMAN/4-286").
+func (d ReportDomain) MSA() seq.MSA {
+	a := d.Aligned
+	var mrow, srow []seq.Residue
+	for col := 0; col < len(a.Model) && col < len(a.Seq); col++ {
+		m, s := a.Model[col], a.Seq[col]
+		if m == '.' {
+			mrow, srow = append(mrow, '-'), append(srow, lower(s))
+		} else {
+			mrow, srow = append(mrow, upper(m)), append(srow, upper(s))
+		}
+	}
+
+	msa := seq.NewMSA()
+	msa.AddFasta(seq.Sequence{Name: a.ModelName, Residues: mrow})
+	msa.AddFasta(seq.Sequence{Name: d.rowName(), Residues: srow})
+	return msa
+}
+
+// A3M returns the sequence's row of the domain's alignment in A3M format,
+// where the match columns are the match states of the profile from 1 to
+// length. Match states before and after the aligned range of the profile
+// are deletions.
+func (d ReportDomain) A3M(length int) seq.Sequence {
+	a := d.Aligned
+	rs := make([]seq.Residue, 0, length+len(a.Seq))
+	for k := 1; k < d.HMMFrom; k++ {
+		rs = append(rs, '-')
+	}
+	for col := 0; col < len(a.Model) && col < len(a.Seq); col++ {
+		if a.Model[col] == '.' {
+			rs = append(rs, lower(a.Seq[col]))
+		} else {
+			rs = append(rs, upper(a.Seq[col]))
+		}
+	}
+	for k := d.HMMTo; k < length; k++ {
+		rs = append(rs, '-')
+	}
+	return seq.Sequence{Name: d.rowName(), Residues: rs}
+}
+
+// MSA returns the alignment of every included domain of every hit with the
+// profile of the query, in the same way as the alignment written by hmmsearch
+// with '-A'. The match columns are the QueryLen match states of the profile.
+// (See ReportDomain.A3M.)
+//
+// This is only meaningful when the query is a profile, as it is for
+// hmmsearch and jackhmmer.
+func (rep *Report) MSA() seq.MSA {
+	msa := seq.NewMSA()
+	for _, hit := range rep.Hits {
+		for _, d := range hit.Domains {
+			if d.Included {
+				msa.Add(d.A3M(rep.QueryLen))
+			}
+		}
+	}
+	return msa
+}
+
+// rowName returns the name of the sequence of a domain followed by its
+// aligned range, which is how HMMER names the rows of its alignments.
+func (d ReportDomain) rowName() string {
+	name := d.Aligned.SeqName
+	if len(name) == 0 {
+		name = d.Target
+	}
+	return fmt.Sprintf("%s/%d-%d", name, d.AliFrom, d.AliTo)
+}
+
+func upper(r seq.Residue) seq.Residue {
+	if r >= 'a' && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
+
+func lower(r seq.Residue) seq.Residue {
+	if r >= 'A' && r <= 'Z' {
+		return r - 'A' + 'a'
+	}
+	return r
+}
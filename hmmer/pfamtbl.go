@@ -0,0 +1,227 @@
+package hmmer
+
+import (
+	"io"
+	"strings"
+)
+
+// pfamSeqColumns and pfamDomColumns are the columns of the sequence and
+// domain sections of a --pfamtblout table that are read, by their names in
+// the header of each section.
+var (
+	pfamSeqColumns = []string{"name", "bits", "E-value", "n", "exp", "bias"}
+	pfamDomColumns = []string{
+		"name", "bits", "E-value", "hit", "bias",
+		"env-st", "env-en", "ali-st", "ali-en", "hmm-st", "hmm-en",
+	}
+)
+
+// Sections of a --pfamtblout table.
+const (
+	pfamNone = iota
+	pfamSeqs
+	pfamDoms
+)
+
+// PfamTblReader reads a --pfamtblout table, which is written by hmmsearch in
+// the format used by Pfam. The table has two sections: the scores of every
+// target sequence ("Sequence scores") and the scores of every domain
+// ("Domain scores"), in that order.
+//
+// ReadHit is called until it returns io.EOF, and then ReadDomain is called
+// until it returns io.EOF.
+//
+// Columns are found by their names in the header of each section, so their
+// order does not matter. The table does not include the names of the query
+// or its length, so the Query, QueryAcc and QueryLen of hits and domains are
+// empty. Neither does it include the conditional E-value or the mean
+// posterior probability of domains, and only the number of domains defined
+// (Dom) and the expected number of domains (Exp) of hits.
+type PfamTblReader struct {
+	lines   *lineReader
+	section int
+
+	// The names of the columns of the current section before the
+	// description, and the index of every column by its name.
+	names   []string
+	columns map[string]int
+
+	// A row that was read but not used, if unread is set.
+	pending tblLine
+	unread  bool
+}
+
+// NewPfamTblReader creates a new PfamTblReader that is ready to read hits
+// from some io.Reader.
+func NewPfamTblReader(r io.Reader) *PfamTblReader {
+	return &PfamTblReader{lines: newLineReader(r)}
+}
+
+// ReadHit reads the next hit of the sequence section. When there are no more
+// hits, io.EOF is returned.
+func (r *PfamTblReader) ReadHit() (Hit, error) {
+	l, err := r.nextRow()
+	if err != nil {
+		return Hit{}, err
+	}
+	if r.section != pfamSeqs {
+		r.unread, r.pending = true, l
+		return Hit{}, io.EOF
+	}
+	f, err := r.fields(l)
+	if err != nil {
+		return Hit{}, err
+	}
+	hit := Hit{
+		Target: f.str(r.col("name")),
+		Full: Score{
+			EValue: f.float(r.col("E-value")),
+			Score:  f.float(r.col("bits")),
+			Bias:   f.float(r.col("bias")),
+		},
+		Exp:         f.float(r.col("exp")),
+		Dom:         f.int(r.col("n")),
+		Description: f.desc,
+	}
+	if f.err != nil {
+		return Hit{}, f.err
+	}
+	return hit, nil
+}
+
+// ReadDomain reads the next domain of the domain section. Any hits that
+// haven't been read are skipped. When there are no more domains, io.EOF is
+// returned.
+//
+// The E-value of a domain is its independent E-value (IEValue).
+func (r *PfamTblReader) ReadDomain() (Domain, error) {
+	for {
+		l, err := r.nextRow()
+		if err != nil {
+			return Domain{}, err
+		}
+		if r.section != pfamDoms {
+			continue
+		}
+		f, err := r.fields(l)
+		if err != nil {
+			return Domain{}, err
+		}
+		dom := Domain{
+			Target:      f.str(r.col("name")),
+			Num:         f.int(r.col("hit")),
+			IEValue:     f.float(r.col("E-value")),
+			Score:       f.float(r.col("bits")),
+			Bias:        f.float(r.col("bias")),
+			HMMFrom:     f.int(r.col("hmm-st")),
+			HMMTo:       f.int(r.col("hmm-en")),
+			AliFrom:     f.int(r.col("ali-st")),
+			AliTo:       f.int(r.col("ali-en")),
+			EnvFrom:     f.int(r.col("env-st")),
+			EnvTo:       f.int(r.col("env-en")),
+			Description: f.desc,
+		}
+		if f.err != nil {
+			return Domain{}, f.err
+		}
+		return dom, nil
+	}
+}
+
+// ReadAll reads all remaining hits and domains. If an error is encountered,
+// processing is stopped, and the error is returned.
+func (r *PfamTblReader) ReadAll() ([]Hit, []Domain, error) {
+	hits := make([]Hit, 0, 100)
+	for {
+		hit, err := r.ReadHit()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		hits = append(hits, hit)
+	}
+	doms := make([]Domain, 0, 100)
+	for {
+		dom, err := r.ReadDomain()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		doms = append(doms, dom)
+	}
+	return hits, doms, nil
+}
+
+// col returns the index of a column of the current section.
+func (r *PfamTblReader) col(name string) int {
+	return r.columns[name]
+}
+
+// fields splits a row of the current section into its columns.
+func (r *PfamTblReader) fields(l tblLine) (*fields, error) {
+	if r.columns == nil {
+		return nil, l.errorf(PfamTbl, "Row does not follow a column header.")
+	}
+	return newFields(PfamTbl, l, r.names)
+}
+
+// nextRow returns the next row of the table. The comments before it are used
+// to keep track of the current section and its columns.
+func (r *PfamTblReader) nextRow() (tblLine, error) {
+	if r.unread {
+		r.unread = false
+		return r.pending, nil
+	}
+	for {
+		l, err := r.lines.next()
+		if err != nil {
+			return tblLine{}, err
+		}
+		line := strings.TrimSpace(l.text)
+		switch {
+		case len(line) == 0:
+			continue
+		case line[0] != '#':
+			return l, nil
+		}
+
+		comment := strings.TrimSpace(line[1:])
+		switch {
+		case strings.HasPrefix(comment, "Sequence scores"):
+			r.section, r.names, r.columns = pfamSeqs, nil, nil
+		case strings.HasPrefix(comment, "Domain scores"):
+			r.section, r.names, r.columns = pfamDoms, nil, nil
+		case strings.HasPrefix(comment, "name "):
+			if err := r.readHeader(l, strings.Fields(comment)); err != nil {
+				return tblLine{}, err
+			}
+		}
+	}
+}
+
+// readHeader reads the names of the columns of the current section. The last
+// column is the description.
+func (r *PfamTblReader) readHeader(l tblLine, names []string) error {
+	required := pfamSeqColumns
+	if r.section == pfamDoms {
+		required = pfamDomColumns
+	} else if r.section != pfamSeqs {
+		return l.errorf(PfamTbl, "Column header is not in a section.")
+	}
+
+	r.names = names[:len(names)-1]
+	r.columns = make(map[string]int, len(r.names))
+	for i, name := range r.names {
+		r.columns[name] = i
+	}
+	for _, name := range required {
+		if _, ok := r.columns[name]; !ok {
+			return l.errorf(PfamTbl, "Column '%s' is missing.", name)
+		}
+	}
+	return nil
+}
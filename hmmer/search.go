@@ -0,0 +1,84 @@
+package hmmer
+
+import (
+	"github.com/TuftsBCB/io/search"
+	"github.com/TuftsBCB/seq"
+)
+
+// SearchHits returns the domains of every hit in a report as search hits.
+func (rep *Report) SearchHits() []search.Hit {
+	hits := make([]search.Hit, 0, len(rep.Hits))
+	for _, hit := range rep.Hits {
+		for _, d := range hit.Domains {
+			hits = append(hits, d)
+		}
+	}
+	return hits
+}
+
+// The methods of Domain and ReportDomain below satisfy the search.Hit
+// interface. A domain is a hit, since it has its own score and alignment.
+//
+// The query ranges of domains are the ranges of the profile (HMMFrom and
+// HMMTo), and the target ranges are the ranges of the aligned sequence
+// (AliFrom and AliTo), as for hmmsearch, phmmer and jackhmmer. For domains
+// found by hmmscan (see Domain.Program), where the query is a sequence, they
+// are the other way around.
+
+// TargetName returns the name of the target.
+func (d Domain) TargetName() string {
+	return d.Target
+}
+
+// Expect returns the independent E-value of the domain.
+func (d Domain) Expect() float64 {
+	return d.IEValue
+}
+
+// BitScore returns the score of the domain.
+func (d Domain) BitScore() float64 {
+	return d.Score
+}
+
+// Probability returns -1, since HMMER does not compute probabilities for
+// domains. (Acc is the mean posterior probability of the aligned residues,
+// which is not the probability of the domain.)
+func (d Domain) Probability() float64 {
+	return -1
+}
+
+// QueryRange returns the range of the query in the alignment.
+func (d Domain) QueryRange() (start, end int) {
+	if d.scan() {
+		return d.AliFrom, d.AliTo
+	}
+	return d.HMMFrom, d.HMMTo
+}
+
+// TargetRange returns the range of the target in the alignment.
+func (d Domain) TargetRange() (start, end int) {
+	if d.scan() {
+		return d.HMMFrom, d.HMMTo
+	}
+	return d.AliFrom, d.AliTo
+}
+
+// Alignment returns nil, since tables don't have alignments.
+func (d Domain) Alignment() (query, target []seq.Residue) {
+	return nil, nil
+}
+
+// Alignment returns the consensus of the profile and the aligned sequence,
+// in the order of the query and the target.
+func (d ReportDomain) Alignment() (query, target []seq.Residue) {
+	if d.scan() {
+		return d.Aligned.Seq, d.Aligned.Model
+	}
+	return d.Aligned.Model, d.Aligned.Seq
+}
+
+// scan returns true if the domain was found by hmmscan, whose queries are
+// sequences and whose targets are profiles.
+func (d Domain) scan() bool {
+	return d.Program == "hmmscan"
+}
@@ -0,0 +1,386 @@
+package hmmer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Names of the output formats of HMMER, as reported in a ParseError.
+const (
+	Text    = "text"
+	Tbl     = "tblout"
+	DomTbl  = "domtblout"
+	PfamTbl = "pfamtblout"
+)
+
+// Score is an E-value, a bit score and the bias correction that was
+// subtracted from the bit score.
+type Score struct {
+	EValue float64
+	Score  float64
+	Bias   float64
+}
+
+// Hit corresponds to a single row in a --tblout table, which describes the
+// match of a query with a target as a whole.
+//
+// For hmmsearch, phmmer and jackhmmer the targets are sequences and the
+// queries are profiles (or sequences). For hmmscan the targets are profiles.
+// Accessions and descriptions that HMMER writes as "-" are empty.
+type Hit struct {
+	Target, TargetAcc string
+	Query, QueryAcc   string
+
+	// The scores of the full target and of its best scoring domain.
+	Full, Best Score
+
+	// The estimation of the number of domains: the expected number of
+	// domains, the number of regions, clusters, overlaps and envelopes that
+	// were defined, and the number of domains that were defined, reported
+	// and included.
+	Exp               float64
+	Reg, Clu, Ov, Env int
+	Dom, Rep, Inc     int
+
+	Description string
+}
+
+// Domain corresponds to a single row in a --domtblout table, which describes
+// one domain of a hit.
+//
+// Coordinates start at 1 and are inclusive. The envelope (EnvFrom and EnvTo)
+// is the region of the target that the domain was found in. The alignment of
+// the domain starts at AliFrom in the target and at HMMFrom in the query.
+// (For hmmscan, the query is a sequence and HMMFrom and HMMTo are positions
+// in the target profile instead.)
+type Domain struct {
+	// The program that found the domain, which is only known for the
+	// domains of a Report, or when it is given to a DomTblReader. (Tables
+	// name it in their last lines, after the domains have been read.) It
+	// decides whether the query or the target is the profile in QueryRange
+	// and TargetRange.
+	Program string
+
+	Target, TargetAcc string
+	TargetLen         int
+	Query, QueryAcc   string
+	QueryLen          int
+
+	// The scores of the full target, which are the same for every domain of
+	// a hit.
+	Full Score
+
+	// The number of the domain and the number of domains in the hit.
+	Num, Of int
+
+	// The conditional and independent E-values of the domain, and its bit
+	// score and bias.
+	CEValue, IEValue float64
+	Score, Bias      float64
+
+	HMMFrom, HMMTo int
+	AliFrom, AliTo int
+	EnvFrom, EnvTo int
+
+	// The mean posterior probability of the aligned residues.
+	Acc float64
+
+	Description string
+}
+
+// ParseError is returned when the output of HMMER is malformed. It records
+// the output format, the line number (counted from the start of the input)
+// and the text of the offending line.
+type ParseError struct {
+	Format string
+	Line   int
+	Text   string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error on line %d of HMMER %s output: %s (line: '%s')",
+		e.Line, e.Format, e.Err, e.Text)
+}
+
+// tblLine is a single line of HMMER's output along with its line number.
+type tblLine struct {
+	num  int
+	text string
+}
+
+func (l tblLine) errorf(outfmt, format string, v ...interface{}) error {
+	return &ParseError{
+		Format: outfmt,
+		Line:   l.num,
+		Text:   l.text,
+		Err:    fmt.Errorf(format, v...),
+	}
+}
+
+// tblColumns and domTblColumns are the names of the columns of a --tblout
+// and --domtblout table, respectively, that precede the description.
+var (
+	tblColumns = []string{
+		"target name", "target accession", "query name", "query accession",
+		"full E-value", "full score", "full bias",
+		"best E-value", "best score", "best bias",
+		"exp", "reg", "clu", "ov", "env", "dom", "rep", "inc",
+	}
+	domTblColumns = []string{
+		"target name", "target accession", "tlen",
+		"query name", "query accession", "qlen",
+		"full E-value", "full score", "full bias", "#", "of",
+		"c-Evalue", "i-Evalue", "score", "bias",
+		"hmm from", "hmm to", "ali from", "ali to", "env from", "env to",
+		"acc",
+	}
+)
+
+// TblReader reads hits from a --tblout table one at a time. Comment lines,
+// which start with '#', and empty lines are skipped. So the input may be
+// several tables, one after the other. (e.g., the iterations of jackhmmer.)
+type TblReader struct {
+	lines *lineReader
+}
+
+// NewTblReader creates a new TblReader that is ready to read hits from some
+// io.Reader.
+func NewTblReader(r io.Reader) *TblReader {
+	return &TblReader{newLineReader(r)}
+}
+
+// Read reads the next hit. When there are no more hits, io.EOF is returned.
+// If the row of the hit is malformed, then a *ParseError is returned.
+func (r *TblReader) Read() (Hit, error) {
+	l, err := r.lines.nextRow()
+	if err != nil {
+		return Hit{}, err
+	}
+	f, err := newFields(Tbl, l, tblColumns)
+	if err != nil {
+		return Hit{}, err
+	}
+	hit := Hit{
+		Target:    f.str(0),
+		TargetAcc: f.str(1),
+		Query:     f.str(2),
+		QueryAcc:  f.str(3),
+		Full:      Score{f.float(4), f.float(5), f.float(6)},
+		Best:      Score{f.float(7), f.float(8), f.float(9)},
+		Exp:       f.float(10),
+		Reg:       f.int(11),
+		Clu:       f.int(12),
+		Ov:        f.int(13),
+		Env:       f.int(14),
+		Dom:       f.int(15),
+		Rep:       f.int(16),
+		Inc:       f.int(17),
+
+		Description: f.desc,
+	}
+	if f.err != nil {
+		return Hit{}, f.err
+	}
+	return hit, nil
+}
+
+// ReadAll reads all remaining hits. If an error is encountered, processing is
+// stopped, and the error is returned.
+func (r *TblReader) ReadAll() ([]Hit, error) {
+	hits := make([]Hit, 0, 100)
+	for {
+		hit, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// DomTblReader reads domains from a --domtblout table one at a time. Comment
+// lines, which start with '#', and empty lines are skipped.
+type DomTblReader struct {
+	// The program that wrote the table (e.g., "hmmscan"), which becomes the
+	// Program of every domain read. It should be set for tables written by
+	// hmmscan, whose queries are sequences and whose targets are profiles.
+	// This may be set at any time.
+	Program string
+	lines   *lineReader
+}
+
+// NewDomTblReader creates a new DomTblReader that is ready to read domains
+// from some io.Reader.
+func NewDomTblReader(r io.Reader) *DomTblReader {
+	return &DomTblReader{lines: newLineReader(r)}
+}
+
+// Read reads the next domain. When there are no more domains, io.EOF is
+// returned. If the row of the domain is malformed, then a *ParseError is
+// returned.
+func (r *DomTblReader) Read() (Domain, error) {
+	l, err := r.lines.nextRow()
+	if err != nil {
+		return Domain{}, err
+	}
+	f, err := newFields(DomTbl, l, domTblColumns)
+	if err != nil {
+		return Domain{}, err
+	}
+	dom := Domain{
+		Program:   r.Program,
+		Target:    f.str(0),
+		TargetAcc: f.str(1),
+		TargetLen: f.int(2),
+		Query:     f.str(3),
+		QueryAcc:  f.str(4),
+		QueryLen:  f.int(5),
+		Full:      Score{f.float(6), f.float(7), f.float(8)},
+		Num:       f.int(9),
+		Of:        f.int(10),
+		CEValue:   f.float(11),
+		IEValue:   f.float(12),
+		Score:     f.float(13),
+		Bias:      f.float(14),
+		HMMFrom:   f.int(15),
+		HMMTo:     f.int(16),
+		AliFrom:   f.int(17),
+		AliTo:     f.int(18),
+		EnvFrom:   f.int(19),
+		EnvTo:     f.int(20),
+		Acc:       f.float(21),
+
+		Description: f.desc,
+	}
+	if f.err != nil {
+		return Domain{}, f.err
+	}
+	return dom, nil
+}
+
+// ReadAll reads all remaining domains. If an error is encountered, processing
+// is stopped, and the error is returned.
+func (r *DomTblReader) ReadAll() ([]Domain, error) {
+	doms := make([]Domain, 0, 100)
+	for {
+		dom, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		doms = append(doms, dom)
+	}
+	return doms, nil
+}
+
+// fields is a row of a table split into the values of its columns and its
+// description. The first error encountered while converting values is kept in
+// err.
+type fields struct {
+	table   string
+	line    tblLine
+	columns []string
+	values  []string
+	desc    string
+	err     error
+}
+
+// newFields splits a row into a value for every column and a description.
+//
+// Values are separated by one or more spaces (or tabs). HMMER writes the
+// description of the target as is in the last column, so the description is
+// the rest of the line after the last value, with its inner spaces intact.
+// A row without a description is allowed.
+func newFields(table string, l tblLine, columns []string) (*fields, error) {
+	f := &fields{table: table, line: l, columns: columns}
+	rest := l.text
+	for len(f.values) < len(columns) {
+		rest = strings.TrimLeft(rest, " \t")
+		if len(rest) == 0 {
+			return nil, l.errorf(table,
+				"Expected at least %d columns but got %d.",
+				len(columns), len(f.values))
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end == -1 {
+			end = len(rest)
+		}
+		f.values = append(f.values, rest[:end])
+		rest = rest[end:]
+	}
+	f.desc = strings.TrimSpace(rest)
+	if f.desc == "-" {
+		f.desc = ""
+	}
+	return f, nil
+}
+
+// str returns the value of the i'th column, where "-" is empty.
+func (f *fields) str(i int) string {
+	if f.values[i] == "-" {
+		return ""
+	}
+	return f.values[i]
+}
+
+func (f *fields) float(i int) float64 {
+	n, err := strconv.ParseFloat(f.values[i], 64)
+	if err != nil && f.err == nil {
+		f.err = f.line.errorf(f.table, "Invalid %s: %s", f.columns[i], err)
+	}
+	return n
+}
+
+func (f *fields) int(i int) int {
+	n, err := strconv.Atoi(f.values[i])
+	if err != nil && f.err == nil {
+		f.err = f.line.errorf(f.table, "Invalid %s: %s", f.columns[i], err)
+	}
+	return n
+}
+
+// lineReader reads the lines of HMMER's output along with their line numbers.
+type lineReader struct {
+	buf    *bufio.Reader
+	lineno int
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{buf: bufio.NewReader(r)}
+}
+
+// next returns the next line of the input without its line terminator. At
+// the end of the input, io.EOF is returned.
+func (r *lineReader) next() (tblLine, error) {
+	line, err := r.buf.ReadString('\n')
+	if err == io.EOF && len(line) == 0 {
+		return tblLine{}, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return tblLine{}, fmt.Errorf("Error reading HMMER output: %s", err)
+	}
+	r.lineno++
+	return tblLine{r.lineno, strings.TrimRight(line, "\r\n")}, nil
+}
+
+// nextRow returns the next line that is not empty or a comment.
+func (r *lineReader) nextRow() (tblLine, error) {
+	for {
+		l, err := r.next()
+		if err != nil {
+			return tblLine{}, err
+		}
+		if line := strings.TrimSpace(l.text); len(line) > 0 && line[0] != '#' {
+			return l, nil
+		}
+	}
+}
@@ -0,0 +1,589 @@
+package hmmer
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// Report is the text output of a HMMER search program for a single query,
+// which is HMMER's default output.
+type Report struct {
+	// The program that wrote the report (e.g., "hmmsearch" or "hmmscan"),
+	// as read from the header of the output. It is empty if the output has
+	// no header.
+	Program string
+
+	Query, QueryAcc, QueryDesc string
+
+	// The length of the query, which is the number of match states of a
+	// profile ("[M=...]") or the number of residues of a sequence
+	// ("[L=...]").
+	QueryLen int
+
+	// The hits in the order of the scores for complete sequences (or
+	// models, for hmmscan), along with their domains.
+	Hits []ReportHit
+}
+
+// ReportHit is a hit in the text output along with its domains. The target,
+// description and the E-values and scores of the embedded Hit are read from
+// the scores for complete sequences, and the number of domains in that list
+// is in Rep. Query and QueryAcc are those of the report. The other fields of
+// the Hit are not in the text output and are zero.
+type ReportHit struct {
+	Hit
+
+	// Whether the hit satisfies the inclusion thresholds (i.e., it is above
+	// the "inclusion threshold" line).
+	Included bool
+
+	Domains []ReportDomain
+}
+
+// ReportDomain is a domain in the domain annotation of a hit along with its
+// alignment. The names, scores and description of the embedded Domain are
+// those of its hit and report, and the rest is read from the domain
+// annotation. TargetAcc and TargetLen are not in the text output and are
+// zero.
+type ReportDomain struct {
+	Domain
+
+	// Whether the domain satisfies the inclusion thresholds ('!' instead of
+	// '?').
+	Included bool
+
+	// The bounds of the profile, the alignment and the envelope, as written
+	// by HMMER. (e.g., "[]" when the alignment spans the full profile, or
+	// ".." when it starts and ends inside of it.)
+	HMMBounds, AliBounds, EnvBounds string
+
+	Aligned Alignment
+}
+
+// Alignment is the alignment of a domain, as it is shown in the text output.
+// Every row has the same length. Rows that are not in the output are empty.
+type Alignment struct {
+	// The names of the profile and the sequence. (For hmmsearch, the
+	// profile is the query and the sequence is the target. For hmmscan, it
+	// is the other way around.)
+	ModelName, SeqName string
+
+	// The consensus of the profile, where '.' marks a residue of the
+	// sequence that is inserted between match states.
+	Model []seq.Residue
+
+	// The match line between the profile and the sequence. Identical
+	// residues are shown, '+' marks a positive score and ' ' otherwise.
+	Match []seq.Residue
+
+	// The aligned sequence. Residues in match states are uppercase, inserted
+	// residues are lowercase and '-' marks a deletion.
+	Seq []seq.Residue
+
+	// The posterior probability of every residue of the sequence, from '0'
+	// to '9' and '*', with '.' for a deletion.
+	PP []seq.Residue
+
+	// The consensus structure and the reference annotation of the profile,
+	// if it has them.
+	CS, RF []seq.Residue
+}
+
+// Posteriors returns the posterior probability of every column of the
+// alignment: a digit d is d/10 and '*' (0.95 or more) is 1. Columns without
+// a probability (deletions) are -1.
+func (a Alignment) Posteriors() []float64 {
+	probs := make([]float64, len(a.PP))
+	for i, r := range a.PP {
+		switch {
+		case r >= '0' && r <= '9':
+			probs[i] = float64(r-'0') / 10
+		case r == '*':
+			probs[i] = 1
+		default:
+			probs[i] = -1
+		}
+	}
+	return probs
+}
+
+// ReadText reads the text output of hmmsearch, hmmscan, phmmer or jackhmmer.
+// Only the report of the first query is read. (Use a TextReader to read all
+// of them.) If the input has no report, then io.EOF is returned.
+//
+// If the output is malformed, then a *ParseError is returned.
+func ReadText(r io.Reader) (*Report, error) {
+	return NewTextReader(r).Read()
+}
+
+// TextReader reads the text output of a HMMER search program one query
+// report at a time. Each report starts with a "Query:" line and ends with a
+// "//" line.
+type TextReader struct {
+	lines *lineReader
+
+	// The program in the header of the output, which only precedes the
+	// first report.
+	program string
+
+	// A line that was read but not used, if unread is set.
+	pending tblLine
+	unread  bool
+}
+
+// NewTextReader creates a new TextReader that is ready to read query reports
+// from some io.Reader.
+func NewTextReader(r io.Reader) *TextReader {
+	return &TextReader{lines: newLineReader(r)}
+}
+
+// Read reads the next query report. When there are no more reports, io.EOF
+// is returned.
+func (r *TextReader) Read() (*Report, error) {
+	// Skip the header of the output and anything else before the report.
+	var lines []tblLine
+	for {
+		l, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(l.text, "Query:") {
+			lines = append(lines, l)
+			break
+		}
+		// e.g., "# hmmscan :: search sequence(s) against a profile database"
+		if fields := strings.Fields(l.text); len(fields) >= 3 &&
+			fields[0] == "#" && fields[2] == "::" {
+			r.program = fields[1]
+		}
+	}
+	for {
+		l, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(l.text, "//") {
+			break
+		}
+		if strings.HasPrefix(l.text, "Query:") {
+			r.unread, r.pending = true, l
+			break
+		}
+		lines = append(lines, l)
+	}
+	return readReport(lines, r.program)
+}
+
+// ReadAll reads all remaining query reports. If an error is encountered,
+// processing is stopped, and the error is returned.
+func (r *TextReader) ReadAll() ([]*Report, error) {
+	reports := make([]*Report, 0, 10)
+	for {
+		rep, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, rep)
+	}
+	return reports, nil
+}
+
+func (r *TextReader) next() (tblLine, error) {
+	if r.unread {
+		r.unread = false
+		return r.pending, nil
+	}
+	return r.lines.next()
+}
+
+// Sections of a query report.
+const (
+	textQuery = iota
+	textHits
+	textDomains
+)
+
+// hitColumns and domColumns are the names of the columns in the scores for
+// complete sequences and in the domain annotation of a hit, respectively,
+// that precede the description.
+var (
+	hitColumns = []string{
+		"full E-value", "full score", "full bias",
+		"best E-value", "best score", "best bias", "exp", "N", "name",
+	}
+	domColumns = []string{
+		"#", "inclusion", "score", "bias", "c-Evalue", "i-Evalue",
+		"hmm from", "hmm to", "hmm bounds", "ali from", "ali to",
+		"ali bounds", "env from", "env to", "env bounds", "acc",
+	}
+)
+
+// readReport reads the lines of a single query report of the given program,
+// which start at the "Query:" line. The rest of the lines of the report
+// (e.g., the pipeline statistics) are ignored.
+func readReport(lines []tblLine, program string) (*Report, error) {
+	rep := &Report{Program: program}
+	section := textQuery
+	included := true
+	var hit *ReportHit
+	var dom *ReportDomain
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		line := strings.TrimSpace(l.text)
+		switch {
+		case strings.HasPrefix(line, "Internal pipeline statistics"):
+			return rep, nil
+		case section == textQuery:
+			switch {
+			case strings.HasPrefix(line, "Query:"):
+				if err := readQuery(l, rep); err != nil {
+					return nil, err
+				}
+			case strings.HasPrefix(line, "Accession:"):
+				rep.QueryAcc = strings.TrimSpace(line[10:])
+			case strings.HasPrefix(line, "Description:"):
+				rep.QueryDesc = strings.TrimSpace(line[12:])
+			case strings.HasPrefix(line, "Scores for complete"):
+				section = textHits
+			}
+		case section == textHits:
+			switch {
+			case strings.HasPrefix(line, "Domain annotation"):
+				section = textDomains
+			case strings.Contains(line, "inclusion threshold"):
+				included = false
+			case len(line) == 0 || line[0] == '-' || line[0] == '[' ||
+				strings.HasPrefix(line, "E-value"):
+				// Column headers and "[No hits detected...]".
+			default:
+				h, err := readHitRow(l, rep)
+				if err != nil {
+					return nil, err
+				}
+				h.Included = included
+				rep.Hits = append(rep.Hits, h)
+			}
+		case section == textDomains:
+			var err error
+			switch {
+			case strings.HasPrefix(line, ">>"):
+				hit, dom = nil, nil
+				if hit, err = findHit(l, rep); err != nil {
+					return nil, err
+				}
+			case strings.HasPrefix(line, "=="):
+				if dom, err = findDomain(l, hit); err != nil {
+					return nil, err
+				}
+			case len(line) == 0:
+			case dom != nil:
+				if i, err = readBlock(lines, i, dom); err != nil {
+					return nil, err
+				}
+			case line[0] == '#' || line[0] == '-' || line[0] == '[' ||
+				strings.HasPrefix(line, "Alignments for"):
+				// Column headers and "[No individual domains...]".
+			case hit != nil:
+				d, err := readDomainRow(l, rep, hit)
+				if err != nil {
+					return nil, err
+				}
+				hit.Domains = append(hit.Domains, d)
+			default:
+				return nil, l.errorf(Text,
+					"Domain does not follow a '>>' line.")
+			}
+		}
+	}
+	return rep, nil
+}
+
+// readQuery reads the name and length of the query from a line like
+// "Query:       zf-C2H2  [M=23]".
+func readQuery(l tblLine, rep *Report) error {
+	fields := strings.Fields(l.text)
+	if len(fields) < 2 {
+		return l.errorf(Text, "Query has no name.")
+	}
+	rep.Query = fields[1]
+	if len(fields) < 3 {
+		return nil
+	}
+	length := fields[2]
+	if !strings.HasPrefix(length, "[M=") && !strings.HasPrefix(length, "[L=") {
+		return l.errorf(Text, "Unrecognized query length '%s'.", length)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length[3:], "]"))
+	if err != nil {
+		return l.errorf(Text, "Invalid query length: %s", err)
+	}
+	rep.QueryLen = n
+	return nil
+}
+
+// readHitRow reads a row of the scores for complete sequences.
+func readHitRow(l tblLine, rep *Report) (ReportHit, error) {
+	// jackhmmer marks new and lost hits with '+' and '*' in the first column.
+	row := l
+	if t := strings.TrimSpace(row.text); t[0] == '+' || t[0] == '*' {
+		row.text = t[1:]
+	}
+	f, err := newFields(Text, row, hitColumns)
+	if err != nil {
+		return ReportHit{}, err
+	}
+	f.line = l
+	hit := ReportHit{Hit: Hit{
+		Target:      f.str(8),
+		Query:       rep.Query,
+		QueryAcc:    rep.QueryAcc,
+		Full:        Score{f.float(0), f.float(1), f.float(2)},
+		Best:        Score{f.float(3), f.float(4), f.float(5)},
+		Exp:         f.float(6),
+		Rep:         f.int(7),
+		Description: f.desc,
+	}}
+	if f.err != nil {
+		return ReportHit{}, f.err
+	}
+	return hit, nil
+}
+
+// findHit returns the hit whose domain annotation starts at a '>>' line.
+func findHit(l tblLine, rep *Report) (*ReportHit, error) {
+	fields := strings.Fields(l.text[2:])
+	if len(fields) == 0 {
+		return nil, l.errorf(Text, "Missing name of hit.")
+	}
+	for i := range rep.Hits {
+		if rep.Hits[i].Target == fields[0] {
+			return &rep.Hits[i], nil
+		}
+	}
+	return nil, l.errorf(Text, "Hit '%s' is not in the scores for "+
+		"complete sequences.", fields[0])
+}
+
+// readDomainRow reads a row of the domain annotation of a hit.
+func readDomainRow(
+	l tblLine,
+	rep *Report,
+	hit *ReportHit,
+) (ReportDomain, error) {
+	f, err := newFields(Text, l, domColumns)
+	if err != nil {
+		return ReportDomain{}, err
+	}
+	d := ReportDomain{
+		Domain: Domain{
+			Program:  rep.Program,
+			Target:   hit.Target,
+			Query:    rep.Query,
+			QueryAcc: rep.QueryAcc,
+			QueryLen: rep.QueryLen,
+			Full:     hit.Full,
+			Num:      f.int(0),
+			Of:       hit.Rep,
+			Score:    f.float(2),
+			Bias:     f.float(3),
+			CEValue:  f.float(4),
+			IEValue:  f.float(5),
+			HMMFrom:  f.int(6),
+			HMMTo:    f.int(7),
+			AliFrom:  f.int(9),
+			AliTo:    f.int(10),
+			EnvFrom:  f.int(12),
+			EnvTo:    f.int(13),
+			Acc:      f.float(15),
+
+			Description: hit.Description,
+		},
+		Included:  f.values[1] == "!",
+		HMMBounds: f.values[8],
+		AliBounds: f.values[11],
+		EnvBounds: f.values[14],
+	}
+	if f.err != nil {
+		return ReportDomain{}, f.err
+	}
+	return d, nil
+}
+
+// findDomain returns the domain whose alignment starts at a line like
+// "== domain 2  score: 30.1 bits;  conditional E-value: 2e-10".
+func findDomain(l tblLine, hit *ReportHit) (*ReportDomain, error) {
+	if hit == nil {
+		return nil, l.errorf(Text, "Alignment does not follow a '>>' line.")
+	}
+	fields := strings.Fields(l.text)
+	if len(fields) < 3 || fields[1] != "domain" {
+		return nil, l.errorf(Text, "Expected '== domain N'.")
+	}
+	num, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, l.errorf(Text, "Invalid domain number: %s", err)
+	}
+	for i := range hit.Domains {
+		if hit.Domains[i].Num == num {
+			return &hit.Domains[i], nil
+		}
+	}
+	return nil, l.errorf(Text, "Domain %d is not in the domain annotation "+
+		"of '%s'.", num, hit.Target)
+}
+
+// readBlock reads a block of the alignment of a domain that starts at
+// lines[i], and returns the index of the last line of the block. A block
+// has optional CS and RF lines, a line of the profile, a match line, a line
+// of the sequence and an optional PP line. Every line after the match line
+// is aligned with the line of the profile.
+//
+// The residue numbers of every block must continue from the previous block,
+// starting at the ranges in the domain annotation. (Except for rows without
+// residues, e.g., inside of a long insertion or deletion, whose start and end
+// are "-".)
+func readBlock(lines []tblLine, i int, dom *ReportDomain) (int, error) {
+	a := &dom.Aligned
+	var cs, rf tblLine
+	for ; i < len(lines); i++ {
+		if hasSuffix(lines[i].text, " CS") {
+			cs = lines[i]
+		} else if hasSuffix(lines[i].text, " RF") {
+			rf = lines[i]
+		} else {
+			break
+		}
+	}
+	if i+2 >= len(lines) {
+		return 0, lines[len(lines)-1].errorf(Text, "Incomplete alignment.")
+	}
+
+	lmodel, lmatch, lseq := lines[i], lines[i+1], lines[i+2]
+	name, model, start, err := readAlignedLine(lmodel)
+	if err != nil {
+		return 0, err
+	}
+	want := dom.HMMFrom + residueCount(a.Model, '.')
+	if start != 0 && start != want {
+		return 0, lmodel.errorf(Text,
+			"Expected the profile to start at %d but it starts at %d.",
+			want, start)
+	}
+	a.ModelName = name
+
+	offset := alignedOffset(lmodel.text)
+	width := len(model)
+	name, sequence, start, err := readAlignedLine(lseq)
+	if err != nil {
+		return 0, err
+	}
+	if len(sequence) != width {
+		return 0, lseq.errorf(Text, "Expected %d columns but got %d.",
+			width, len(sequence))
+	}
+	want = dom.AliFrom + residueCount(a.Seq, '-')
+	if start != 0 && start != want {
+		return 0, lseq.errorf(Text,
+			"Expected the sequence to start at %d but it starts at %d.",
+			want, start)
+	}
+	a.SeqName = name
+
+	a.Model = append(a.Model, model...)
+	a.Match = append(a.Match, column(lmatch.text, offset, width)...)
+	a.Seq = append(a.Seq, sequence...)
+	if len(cs.text) > 0 {
+		a.CS = append(a.CS, column(cs.text, offset, width)...)
+	}
+	if len(rf.text) > 0 {
+		a.RF = append(a.RF, column(rf.text, offset, width)...)
+	}
+	i += 2
+	if i+1 < len(lines) && hasSuffix(lines[i+1].text, " PP") {
+		i++
+		a.PP = append(a.PP, column(lines[i].text, offset, width)...)
+	}
+	return i, nil
+}
+
+// readAlignedLine reads a line of the profile or the sequence in a block of
+// an alignment, e.g., "  zf-C2H2   1 ykCpdCgksFsrksnLkrHlrtH 23 ". The
+// start is 0 when the row has no residues in the block, which HMMER shows
+// with "-" as the start and the end.
+func readAlignedLine(l tblLine) (string, []seq.Residue, int, error) {
+	fields := strings.Fields(l.text)
+	if len(fields) != 4 {
+		return "", nil, 0, l.errorf(Text,
+			"Expected a name, a start, aligned residues and an end.")
+	}
+	if fields[1] == "-" && fields[3] == "-" {
+		return fields[0], []seq.Residue(fields[2]), 0, nil
+	}
+	start, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", nil, 0, l.errorf(Text, "Invalid start: %s", err)
+	}
+	if _, err := strconv.Atoi(fields[3]); err != nil {
+		return "", nil, 0, l.errorf(Text, "Invalid end: %s", err)
+	}
+	return fields[0], []seq.Residue(fields[2]), start, nil
+}
+
+// alignedOffset returns the position of the aligned residues in a line of
+// the profile or the sequence, which follow the name and the start. (The
+// residues can't be searched for, since a short block may be found in the
+// name.)
+func alignedOffset(line string) int {
+	i := 0
+	skip := func(space bool) {
+		for i < len(line) && (line[i] == ' ') == space {
+			i++
+		}
+	}
+	skip(true)
+	skip(false) // name
+	skip(true)
+	skip(false) // start
+	skip(true)
+	return i
+}
+
+// column returns width characters of a line starting at offset. Lines that
+// are too short (e.g., because trailing spaces were removed) are padded with
+// spaces.
+func column(line string, offset, width int) []seq.Residue {
+	rs := make([]seq.Residue, width)
+	for i := range rs {
+		if offset+i < len(line) {
+			rs[i] = seq.Residue(line[offset+i])
+		} else {
+			rs[i] = ' '
+		}
+	}
+	return rs
+}
+
+// residueCount returns the number of residues in a row of an alignment,
+// which excludes the given gap character.
+func residueCount(rs []seq.Residue, gap seq.Residue) int {
+	n := 0
+	for _, r := range rs {
+		if r != gap {
+			n++
+		}
+	}
+	return n
+}
+
+func hasSuffix(line, suffix string) bool {
+	return strings.HasSuffix(strings.TrimRight(line, " "), suffix)
+}
@@ -0,0 +1,425 @@
+package hmmer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+func ExampleReadText() {
+	f, err := os.Open("zf.out")
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer f.Close()
+
+	rep, err := ReadText(f)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	fmt.Println(rep.Query, rep.QueryLen)
+	for _, hit := range rep.Hits {
+		fmt.Println(hit.Target, hit.Full.EValue, hit.Included)
+	}
+
+	d := rep.Hits[0].Domains[1]
+	fmt.Println(d.HMMFrom, d.HMMTo, d.HMMBounds, d.AliFrom, d.AliTo)
+	fmt.Printf("%s\n", d.Aligned.Model)
+	fmt.Printf("%s\n", d.Aligned.Match)
+	fmt.Printf("%s\n", d.Aligned.Seq)
+	fmt.Printf("%s\n", d.Aligned.PP)
+	// Output:
+	// zf-C2H2 23
+	// sp|P08042|ZNF41_HUMAN 2.1e-25 true
+	// sp|Q9UK13|ZN221_HUMAN 3.3e-09 true
+	// tr|B4DKL1|B4DKL1_HUMAN 0.034 false
+	// 1 23 [] 327 350
+	// ykCpdCgksFsrk..snLkrHlrtH
+	//   +PDCG+SF+RK   + KR+LR+H
+	// ENWPDCGISFDRKsq-WMKRSLRRH
+	// *8*7********8*7.***7*8***
+}
+
+func readText(t *testing.T, fname string) []*Report {
+	f := openFile(t, fname)
+	defer f.Close()
+
+	reps, err := NewTextReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("%s: %s", fname, err)
+	}
+	return reps
+}
+
+func TestReadText(t *testing.T) {
+	reps := readText(t, "zf.out")
+	if len(reps) != 2 {
+		t.Fatalf("Expected 2 reports but got %d.", len(reps))
+	}
+	rep := reps[0]
+	if rep.Program != "hmmsearch" || reps[1].Program != "hmmsearch" {
+		t.Fatalf("Expected the program 'hmmsearch' but got '%s' and '%s'.",
+			rep.Program, reps[1].Program)
+	}
+	if rep.QueryAcc != "PF00096.27" ||
+		rep.QueryDesc != "Zinc finger, C2H2 type" {
+		t.Fatalf("Unexpected query: %#v", rep)
+	}
+
+	hit := rep.Hits[2]
+	expected := Hit{
+		Target:   "tr|B4DKL1|B4DKL1_HUMAN",
+		Query:    "zf-C2H2",
+		QueryAcc: "PF00096.27",
+		Full:     Score{EValue: 0.034, Score: 12.7, Bias: 0},
+		Best:     Score{EValue: 0.059, Score: 11.9, Bias: 0.1},
+		Exp:      1.4,
+		Rep:      2,
+	}
+	if hit.Hit != expected || len(hit.Domains) != 2 {
+		t.Fatalf("Expected\n%#v\nbut got\n%#v", expected, hit.Hit)
+	}
+	dom := Domain{
+		Program:  "hmmsearch",
+		Target:   "tr|B4DKL1|B4DKL1_HUMAN",
+		Query:    "zf-C2H2",
+		QueryAcc: "PF00096.27",
+		QueryLen: 23,
+		Full:     expected.Full,
+		Num:      2,
+		Of:       2,
+		CEValue:  0.012,
+		IEValue:  31,
+		Score:    3.2,
+		Bias:     0.1,
+		HMMFrom:  10,
+		HMMTo:    20,
+		AliFrom:  140,
+		AliTo:    149,
+		EnvFrom:  140,
+		EnvTo:    149,
+		Acc:      0.72,
+	}
+	if d := hit.Domains[1]; d.Domain != dom || d.Included {
+		t.Fatalf("Expected\n%#v\nbut got\n%#v", dom, d.Domain)
+	}
+
+	// Domains whose envelope is larger than their alignment.
+	d := rep.Hits[0].Domains[2]
+	if d.EnvFrom != 354 || d.EnvTo != 377 || d.HMMBounds != ".." {
+		t.Fatalf("Unexpected domain: %#v", d.Domain)
+	}
+}
+
+func TestReadTextBlocks(t *testing.T) {
+	// The alignment of the second report is split into two blocks and has
+	// a consensus structure.
+	rep := readText(t, "zf.out")[1]
+	if rep.Query != "Ank_2" || rep.QueryLen != 84 || len(rep.Hits) != 1 {
+		t.Fatalf("Unexpected report: %#v", rep)
+	}
+	d := rep.Hits[0].Domains[0]
+	a := d.Aligned
+	if a.ModelName != "Ank_2" || a.SeqName != "sp|P53355|DAPK1_HUMAN" {
+		t.Fatalf("Unexpected names '%s' and '%s'.", a.ModelName, a.SeqName)
+	}
+	n := len(a.Model)
+	if n != 91 || len(a.Match) != n || len(a.Seq) != n || len(a.PP) != n ||
+		len(a.CS) != n || len(a.RF) != 0 {
+		t.Fatalf("Unexpected lengths of rows: %d %d %d %d %d %d", n,
+			len(a.Match), len(a.Seq), len(a.PP), len(a.CS), len(a.RF))
+	}
+	if got := residueCount(a.Model, '.'); got != d.HMMTo-d.HMMFrom+1 {
+		t.Fatalf("Expected %d match states but got %d.",
+			d.HMMTo-d.HMMFrom+1, got)
+	}
+	if got := residueCount(a.Seq, '-'); got != d.AliTo-d.AliFrom+1 {
+		t.Fatalf("Expected %d residues but got %d.",
+			d.AliTo-d.AliFrom+1, got)
+	}
+	if tail := string(seqBytes(a.Seq[n-3:])); tail != "IPT" {
+		t.Fatalf("Expected the alignment to end with 'IPT' but got '%s'.",
+			tail)
+	}
+
+	probs := a.Posteriors()
+	if probs[0] != 1 || probs[5] != 0.7 || probs[28] != -1 {
+		t.Fatalf("Unexpected posterior probabilities: %v", probs[:30])
+	}
+}
+
+func TestReadTextShortBlock(t *testing.T) {
+	original, err := ioutil.ReadFile("zf.out")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Move two columns of the last block of the second report to the first
+	// block, so that the last block has a single column, which is also in
+	// the name of the profile.
+	text := strings.Replace(string(original), "Ank_2", "Ant_2", -1)
+	for _, r := range []struct{ old, new string }{
+		{"E-TSTHHHHEH CS", "E-TSTHHHHEHH- CS"},
+		{"aWnAdGlcVh....syqGgTakRpW 81", "aWnAdGlcVh....syqGgTakRpWCF 83"},
+		{"VH    SY + T KRP+\n", "VH    SY + T KRP+++\n"},
+		{"SYENHTVKRPP 454", "SYENHTVKRPPIP 456"},
+		{"*8*8*98****** PP", "*8*8*98******** PP"},
+		{"H-T CS", "T CS"},
+		{"  82 CFt 84 ", "  84 t 84 "},
+		{"++T\n", "T\n"},
+		{"455 IPT 457", "457 T 457"},
+		{"*** PP\n", "* PP\n"},
+	} {
+		if !strings.Contains(text, r.old) {
+			t.Fatalf("zf.out does not contain '%s'.", r.old)
+		}
+		text = strings.Replace(text, r.old, r.new, 1)
+	}
+
+	r := NewTextReader(strings.NewReader(text))
+	if _, err := r.Read(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	rep, err := r.Read()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	a := rep.Hits[0].Domains[0].Aligned
+	n := len(a.Model)
+	if n != 91 || len(a.Match) != n || len(a.PP) != n || len(a.CS) != n {
+		t.Fatalf("Unexpected lengths of rows: %d %d %d %d", n,
+			len(a.Match), len(a.PP), len(a.CS))
+	}
+	rows := []string{
+		string(seqBytes(a.CS[n-3:])), string(seqBytes(a.Model[n-3:])),
+		string(seqBytes(a.Match[n-3:])), string(seqBytes(a.Seq[n-3:])),
+		string(seqBytes(a.PP[n-3:])),
+	}
+	expected := []string{"H-T", "CFt", "++T", "IPT", "***"}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected the alignment to end with %q but got %q.",
+			expected, rows)
+	}
+}
+
+func TestReadTextLongIndels(t *testing.T) {
+	original, err := ioutil.ReadFile("zf.out")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Replace the last block of the second report with a block inside of a
+	// long insertion, whose profile row has no residues, a block inside of
+	// a deletion, whose sequence row has no residues, and a block with the
+	// rest of the alignment.
+	last := `                            H-T CS
+                  Ank_2  82 CFt 84 
+                            ++T
+  sp|P53355|DAPK1_HUMAN 455 IPT 457
+                            *** PP
+`
+	blocks := `                            .......... CS
+                  Ank_2   - .......... -  
+                                      
+  sp|P53355|DAPK1_HUMAN 455 iptvlkeagl 464
+                            7899****** PP
+
+                            H- CS
+                  Ank_2  82 CF 83 
+                              
+  sp|P53355|DAPK1_HUMAN   - -- -  
+                            .. PP
+
+                            T CS
+                  Ank_2  84 t 84 
+                            +
+  sp|P53355|DAPK1_HUMAN 465 T 465
+                            * PP
+`
+	text := string(original)
+	for _, r := range []struct{ old, new string }{
+		{last, blocks},
+		{"371     457 ..     371     457", "371     465 ..     371     465"},
+	} {
+		if !strings.Contains(text, r.old) {
+			t.Fatalf("zf.out does not contain '%s'.", r.old)
+		}
+		text = strings.Replace(text, r.old, r.new, 1)
+	}
+
+	r := NewTextReader(strings.NewReader(text))
+	if _, err := r.Read(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	rep, err := r.Read()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	a := rep.Hits[0].Domains[0].Aligned
+	n := len(a.Model)
+	if n != 101 || len(a.Match) != n || len(a.Seq) != n ||
+		len(a.PP) != n || len(a.CS) != n {
+		t.Fatalf("Unexpected lengths of rows: %d %d %d %d %d", n,
+			len(a.Match), len(a.Seq), len(a.PP), len(a.CS))
+	}
+	rows := []string{
+		string(seqBytes(a.CS[n-13:])), string(seqBytes(a.Model[n-13:])),
+		string(seqBytes(a.Match[n-13:])), string(seqBytes(a.Seq[n-13:])),
+		string(seqBytes(a.PP[n-13:])),
+	}
+	expected := []string{
+		"..........H-T", "..........CFt", "            +", "iptvlkeagl--T",
+		"7899******..*",
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected the alignment to end with %q but got %q.",
+			expected, rows)
+	}
+}
+
+func TestSearchHitRanges(t *testing.T) {
+	original, err := ioutil.ReadFile("zf.out")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	for _, program := range []string{"hmmsearch", "hmmscan"} {
+		text := strings.Replace(string(original),
+			"# hmmsearch ::", "# "+program+" ::", 1)
+		rep, err := ReadText(strings.NewReader(text))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		hit := rep.SearchHits()[0]
+		qstart, qend := hit.QueryRange()
+		tstart, tend := hit.TargetRange()
+		query, target := hit.Alignment()
+
+		// The query of hmmscan is the sequence and its target is the
+		// profile.
+		qrow, trow := "ykCpdCgksFsrksnLkrHlrtH", "YKDEDCGKSFSREWWLKRHLRTH"
+		ranges := [4]int{1, 23, 271, 293}
+		if program == "hmmscan" {
+			qrow, trow = trow, qrow
+			ranges = [4]int{271, 293, 1, 23}
+		}
+		if got := [4]int{qstart, qend, tstart, tend}; got != ranges {
+			t.Fatalf("%s: Expected ranges %v but got %v.",
+				program, ranges, got)
+		}
+		if string(seqBytes(query)) != qrow ||
+			string(seqBytes(target)) != trow {
+			t.Fatalf("%s: Unexpected alignment '%s' and '%s'.",
+				program, seqBytes(query), seqBytes(target))
+		}
+	}
+}
+
+func TestReportMSA(t *testing.T) {
+	rep := readText(t, "zf.out")[0]
+
+	// Only included domains are in the alignment, and every row spans the
+	// full profile.
+	msa := rep.MSA()
+	rows := []string{
+		"YKDEDCGKSFSRE..WWLKRHLRTH",
+		"ENWPDCGISFDRKsq-WMKRSLRRH",
+		"--CPDCGKSVSIK..SNLKTCVR--",
+		"-CRPDCGFYFRRK..T-LK-DLRTH",
+	}
+	if len(msa.Entries) != len(rows) {
+		t.Fatalf("Expected %d rows but got %d.", len(rows), len(msa.Entries))
+	}
+	for i, row := range rows {
+		if got := string(seqBytes(msa.GetA2M(i).Residues)); got != row {
+			t.Fatalf("Expected row\n%s\nbut got\n%s", row, got)
+		}
+	}
+	if name := msa.Entries[1].Name; name != "sp|P08042|ZNF41_HUMAN/327-350" {
+		t.Fatalf("Unexpected name '%s'.", name)
+	}
+
+	// The alignment of a single domain only spans its aligned range.
+	pair := rep.Hits[0].Domains[2].MSA()
+	expected := []string{"CPDCGKSFSRKSNLKRHLR", "CPDCGKSVSIKSNLKTCVR"}
+	for i, row := range expected {
+		if got := string(seqBytes(pair.GetA2M(i).Residues)); got != row {
+			t.Fatalf("Expected row\n%s\nbut got\n%s", row, got)
+		}
+	}
+}
+
+func TestReadTextReports(t *testing.T) {
+	// ReadText only reads the first report, and the reports of a
+	// TextReader are the same.
+	f := openFile(t, "zf.out")
+	defer f.Close()
+	first, err := ReadText(f)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if reps := readText(t, "zf.out"); !reflect.DeepEqual(first, reps[0]) {
+		t.Fatalf("The first report of ReadText and a TextReader differ.")
+	}
+
+	r := NewTextReader(strings.NewReader("# hmmsearch\n[ok]\n"))
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("Expected io.EOF but got '%v'.", err)
+	}
+}
+
+func TestReadTextErrors(t *testing.T) {
+	original, err := ioutil.ReadFile("zf.out")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	lines := strings.SplitAfter(string(original), "\n")
+
+	tests := []struct {
+		line int
+		old  string
+		new  string
+	}{
+		{10, "[M=23]", "[M=twenty]"},
+		{17, "2.1e-25", "2.1e-25e"},
+		{24, "ZNF41_HUMAN", "ZNF42_HUMAN"},
+		{28, "    2e-10", "         "},
+		{32, "domain 1", "domain 4"},
+		{33, " 1 ykC", " 2 ykC"},
+		{35, " 271 ", " 270 "},
+		{41, "Ksq-", "Ksq"},
+	}
+	for _, test := range tests {
+		corrupt := make([]string, len(lines))
+		copy(corrupt, lines)
+		if !strings.Contains(corrupt[test.line-1], test.old) {
+			t.Fatalf("Line %d does not contain '%s'.", test.line, test.old)
+		}
+		corrupt[test.line-1] = strings.Replace(
+			corrupt[test.line-1], test.old, test.new, 1)
+
+		_, err := ReadText(strings.NewReader(strings.Join(corrupt, "")))
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("Line %d: Expected a *ParseError but got '%v'.",
+				test.line, err)
+		}
+		if perr.Line != test.line || perr.Format != Text {
+			t.Fatalf("Line %d: Unexpected error: %s", test.line, perr)
+		}
+	}
+}
+
+func seqBytes(rs []seq.Residue) []byte {
+	bs := make([]byte, len(rs))
+	for i, r := range rs {
+		bs[i] = byte(r)
+	}
+	return bs
+}
@@ -59,6 +59,30 @@ func TestA3M(t *testing.T) {
 	}
 }
 
+func TestStockholmBlocks(t *testing.T) {
+	sto := []string{
+		"# STOCKHOLM 1.0",
+		"",
+		"#=GS seq1/1-9 DE first",
+		"seq1/1-9   ACD.EF",
+		"#=GR seq1/1-9 PP **.***",
+		"seq2/4-11  AC-.EF",
+		"",
+		"seq1/1-9   G.HI",
+		"seq2/4-11  GkHI",
+		"//",
+	}
+	computed, err := ReadStockholm(makeBuffer(sto))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	answer := makeMSA(makeSeqs([]string{"ACD.EFG.HI", "AC-.EFGkHI"}))
+	testEqualAlign(t, computed, answer)
+	if name := computed.Entries[1].Name; name != "seq2/4-11" {
+		t.Fatalf("Expected name 'seq2/4-11' but got '%s'.", name)
+	}
+}
+
 func TestReaderError(t *testing.T) {
 	_, err := Read(bytes.NewBuffer(testBadAlignedInput))
 	if err == nil {
@@ -12,6 +12,8 @@ import (
 // ReadStockholm reads an MSA from a Stockholm formatted file. Note that
 // features are completely ignored. This reader only checks for the Stockholm
 // header (and version), and then slurps up the sequence data into an MSA.
+// Sequences that are split into blocks (e.g., the alignments written by
+// HMMER's hmmsearch with '-A') are joined.
 func ReadStockholm(r io.Reader) (seq.MSA, error) {
 	return readStockholm(r, false)
 }
@@ -55,13 +57,18 @@ func readStockholm(r io.Reader, trusted bool) (seq.MSA, error) {
 			return seq.MSA{}, ef("First line does not contain 'STOCKHOLM 1.0'.")
 		}
 	}
+	// A long alignment may be split into blocks, which have a line for every
+	// sequence. The lines of each sequence are joined in the order that the
+	// sequences first appear.
+	var names []string
+	rows := make(map[string][]seq.Residue)
 	for scanner.Scan() {
 		line := bytes.TrimSpace(scanner.Bytes())
-		if line[0] == '#' {
+		if len(line) == 0 || line[0] == '#' {
 			continue
 		}
-		if line[0] == '/' && line[1] == '/' { // alignment done, says the spec
-			break
+		if bytes.HasPrefix(line, []byte("//")) {
+			break // alignment done, says the spec
 		}
 
 		pieces := bytes.Fields(line)
@@ -70,26 +77,29 @@ func readStockholm(r io.Reader, trusted bool) (seq.MSA, error) {
 			return seq.MSA{}, err
 		}
 
-		s := seq.Sequence{
-			Name:     string(concat(pieces[0 : len(pieces)-1])),
-			Residues: residues,
+		name := string(concat(pieces[0 : len(pieces)-1]))
+		if _, ok := rows[name]; !ok {
+			names = append(names, name)
 		}
-		msa.Add(s)
+		rows[name] = append(rows[name], residues...)
+	}
+	if err := scanner.Err(); err != nil {
+		return seq.MSA{}, err
+	}
+	for _, name := range names {
+		msa.Add(seq.Sequence{Name: name, Residues: rows[name]})
 		if len(msa.Entries) > 1 {
-			// We can't use 's' directly, because a sequence added to an MSA
-			// may be modified if it isn't already in A2M format.
+			// We can't use the row directly, because a sequence added to an
+			// MSA may be modified if it isn't already in A2M format.
 			lastEntry := msa.Entries[len(msa.Entries)-1]
 			if lastEntry.Len() != msa.Entries[0].Len() {
 				return seq.MSA{},
 					fmt.Errorf("Sequence '%s' has length %d, but other "+
 						"sequences have length %d.",
-						s.Name, lastEntry, msa.Entries[0].Len())
+						name, lastEntry.Len(), msa.Entries[0].Len())
 			}
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return seq.MSA{}, err
-	}
 	return msa, nil
 }
 
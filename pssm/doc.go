@@ -0,0 +1,17 @@
+/*
+Package pssm reads and writes the ASCII position-specific scoring matrices
+produced by PSI-BLAST (i.e., with the -out_ascii_pssm flag).
+
+Each position in a PSSM contains the query residue, a log-odds score for
+every residue in the alphabet, the weighted observed percentages (rounded
+down), the information content of the position and the relative weight of
+gapless real matches to pseudocounts. The Karlin-Altschul parameters at the
+end of the file are also kept.
+
+Binary and ASN.1 PSI-BLAST checkpoint files (i.e., -out_pssm) are not
+supported.
+
+A PSSM can be converted to a seq.HMM with only match states, so that it can be
+used with the hmm package.
+*/
+package pssm
@@ -0,0 +1,189 @@
+package pssm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// DefaultLambda is the ungapped Lambda used to interpret PSSM scores when a
+// PSSM does not list its own "PSI Ungapped" Karlin-Altschul parameters.
+const DefaultLambda = 0.3176
+
+// AlphaPSIBLAST is the order of residues used by PSI-BLAST in its ASCII PSSMs.
+var AlphaPSIBLAST = seq.NewAlphabet(
+	'A', 'R', 'N', 'D', 'C', 'Q', 'E', 'G', 'H', 'I',
+	'L', 'K', 'M', 'F', 'P', 'S', 'T', 'W', 'Y', 'V',
+)
+
+// Background corresponds to the Robinson and Robinson amino acid frequencies
+// that BLAST uses as its background model. The frequencies are ordered by
+// AlphaPSIBLAST.
+var Background = []float64{
+	0.07805, 0.05129, 0.04487, 0.05364, 0.01925,
+	0.04264, 0.06295, 0.07377, 0.02199, 0.05142,
+	0.09019, 0.05744, 0.02243, 0.03856, 0.05203,
+	0.07120, 0.05841, 0.01330, 0.03216, 0.06441,
+}
+
+// PSSM corresponds to an ASCII position-specific scoring matrix produced by
+// PSI-BLAST.
+type PSSM struct {
+	// The order of residues in the score and percentage columns of each
+	// position. This is almost always AlphaPSIBLAST.
+	Alphabet seq.Alphabet
+
+	// The positions of the PSSM, in the order of the query sequence.
+	Positions []Position
+
+	// The Karlin-Altschul parameters listed at the end of the PSSM.
+	// This may be empty.
+	Stats []Stats
+}
+
+// Position corresponds to a single row in a PSSM.
+type Position struct {
+	// The residue in the query sequence at this position.
+	Residue seq.Residue
+
+	// Log-odds scores for each residue, in the order of the alphabet.
+	Scores []int
+
+	// Weighted observed percentages for each residue, in the order of the
+	// alphabet. PSI-BLAST rounds these down.
+	Observed []int
+
+	// Information content of this position, in bits.
+	Info float64
+
+	// Relative weight of gapless real matches to pseudocounts.
+	RelWeight float64
+}
+
+// Stats corresponds to a row of Karlin-Altschul parameters listed at the end
+// of a PSSM. e.g., "PSI Ungapped".
+type Stats struct {
+	Name      string
+	K, Lambda float64
+}
+
+// Len returns the number of positions in the PSSM.
+func (p *PSSM) Len() int {
+	return len(p.Positions)
+}
+
+// Query returns the query sequence of the PSSM with the given name.
+func (p *PSSM) Query(name string) seq.Sequence {
+	rs := make([]seq.Residue, len(p.Positions))
+	for i, pos := range p.Positions {
+		rs[i] = pos.Residue
+	}
+	return seq.Sequence{Name: name, Residues: rs}
+}
+
+// Score returns the score of residue r at position i (starting from 0).
+// If r is not in the PSSM's alphabet, then the smallest score at that
+// position is returned.
+func (p *PSSM) Score(i int, r seq.Residue) int {
+	pos := p.Positions[i]
+	if j := alphaIndex(p.Alphabet, r); j >= 0 {
+		return pos.Scores[j]
+	}
+	min := pos.Scores[0]
+	for _, s := range pos.Scores[1:] {
+		if s < min {
+			min = s
+		}
+	}
+	return min
+}
+
+// Lambda returns the Lambda from the "PSI Ungapped" Karlin-Altschul
+// parameters of the PSSM. If they are not present, DefaultLambda is returned.
+func (p *PSSM) Lambda() float64 {
+	for _, stats := range p.Stats {
+		if stats.Name == "PSI Ungapped" && stats.Lambda > 0 {
+			return stats.Lambda
+		}
+	}
+	return DefaultLambda
+}
+
+// HMM converts the PSSM to an HMM with only match states. Emission
+// probabilities are recovered from the log-odds scores using the PSSM's
+// ungapped Lambda and the BLAST background frequencies (which also become the
+// NULL model and insertion emissions). The weighted observed percentages are
+// not used, since they are rounded and do not include pseudocounts.
+//
+// Probabilities are stored as log_2 values (with seq.MinProb corresponding to
+// a probability of zero), which is the same representation used by the hmm
+// package. Transitions always go from match state to match state.
+//
+// An error is returned if the PSSM's alphabet contains a residue without a
+// background frequency.
+func (p *PSSM) HMM() (*seq.HMM, error) {
+	bg := make([]float64, len(p.Alphabet))
+	for i, r := range p.Alphabet {
+		j := alphaIndex(AlphaPSIBLAST, r)
+		if j < 0 {
+			return nil, fmt.Errorf("No background frequency for residue '%c'.",
+				r)
+		}
+		bg[i] = Background[j]
+	}
+
+	// Every node gets its own insertion emissions, so that changing one
+	// doesn't change the others (or the null model).
+	background := func() seq.EProbs {
+		emit := seq.NewEProbs(p.Alphabet)
+		for i, r := range p.Alphabet {
+			emit.Set(r, log2Prob(bg[i]))
+		}
+		return emit
+	}
+
+	lambda := p.Lambda()
+	nodes := make([]seq.HMMNode, len(p.Positions))
+	for i, pos := range p.Positions {
+		total := 0.0
+		odds := make([]float64, len(p.Alphabet))
+		for j := range p.Alphabet {
+			odds[j] = bg[j] * math.Exp(lambda*float64(pos.Scores[j]))
+			total += odds[j]
+		}
+
+		memit := seq.NewEProbs(p.Alphabet)
+		for j, r := range p.Alphabet {
+			memit.Set(r, log2Prob(odds[j]/total))
+		}
+		nodes[i] = seq.HMMNode{
+			Residue: pos.Residue,
+			NodeNum: i + 1,
+			InsEmit: background(),
+			MatEmit: memit,
+			Transitions: seq.TProbs{
+				MM: 0, MI: seq.MinProb, MD: seq.MinProb,
+				IM: 0, II: seq.MinProb,
+				DM: 0, DD: seq.MinProb,
+			},
+		}
+	}
+	return seq.NewHMM(nodes, p.Alphabet, background()), nil
+}
+
+func alphaIndex(alphabet seq.Alphabet, r seq.Residue) int {
+	for i, residue := range alphabet {
+		if residue == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func log2Prob(p float64) seq.Prob {
+	if p <= 0 {
+		return seq.MinProb
+	}
+	return seq.Prob(math.Log2(p))
+}
@@ -0,0 +1,109 @@
+package pssm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/seq"
+)
+
+func ExampleRead() {
+	f, err := os.Open("test.pssm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	p, err := Read(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pos := p.Positions[3]
+	fmt.Println(p.Len())
+	fmt.Printf("%s\n", p.Query("query").Residues)
+	fmt.Printf("%c\n", pos.Residue)
+	fmt.Println(p.Score(3, 'L'))
+	fmt.Println(pos.Observed[10])
+	fmt.Println(pos.Info, pos.RelWeight)
+	fmt.Println(p.Lambda())
+	// Output:
+	// 12
+	// MKVLAAGIVGLW
+	// L
+	// 9
+	// 59
+	// 1.17 1.15
+	// 0.3166
+}
+
+func TestReadWrite(t *testing.T) {
+	original, err := ioutil.ReadFile("test.pssm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	p, err := Read(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	written := new(bytes.Buffer)
+	if err := Write(written, p); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !bytes.Equal(original, written.Bytes()) {
+		t.Fatalf("Writing a PSSM did not reproduce the original. Got:\n%s",
+			written)
+	}
+}
+
+func TestHMM(t *testing.T) {
+	f, err := os.Open("test.pssm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer f.Close()
+
+	p, err := Read(f)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hmm, err := p.HMM()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(hmm.Nodes) != p.Len() {
+		t.Fatalf("Expected %d nodes but got %d.", p.Len(), len(hmm.Nodes))
+	}
+	for i, node := range hmm.Nodes {
+		total := 0.0
+		best, bestOdds := seq.Residue(0), math.Inf(-1)
+		for _, r := range p.Alphabet {
+			lp := node.MatEmit.Lookup(r)
+			total += math.Pow(2, float64(lp))
+			if odds := float64(lp - hmm.Null.Lookup(r)); odds > bestOdds {
+				best, bestOdds = r, odds
+			}
+		}
+		if total < 0.999 || total > 1.001 {
+			t.Fatalf("Match emissions of node %d sum to %f.", i+1, total)
+		}
+		if best != p.Positions[i].Residue {
+			t.Fatalf("Expected '%c' to have the best odds in node "+
+				"%d, but got '%c'.", p.Positions[i].Residue, i+1, best)
+		}
+	}
+	// Emissions are not shared between nodes or with the null model.
+	r := p.Alphabet[0]
+	null := hmm.Null.Lookup(r)
+	hmm.Nodes[0].InsEmit.Set(r, 0)
+	if hmm.Nodes[1].InsEmit.Lookup(r) != null || hmm.Null.Lookup(r) != null {
+		t.Fatalf("Setting the insertion emissions of node 1 changed " +
+			"those of node 2 or the null model.")
+	}
+}
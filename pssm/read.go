@@ -0,0 +1,196 @@
+package pssm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/TuftsBCB/seq"
+)
+
+// The first nine characters of each position line contain the position
+// number and the query residue. Each score is then right aligned in a column
+// that is three characters wide.
+const (
+	scoresStart = 9
+	scoreWidth  = 3
+)
+
+// Read reads an ASCII PSSM produced by PSI-BLAST.
+//
+// Reading stops at EOF. Everything before the alphabet header line is
+// ignored, so that the leading "Last position-specific scoring matrix..."
+// description is not required.
+func Read(r io.Reader) (*PSSM, error) {
+	p := &PSSM{}
+	lineno := 0
+	scanner := bufio.NewScanner(r)
+	mode := 1 // 1 for preamble, 2 for positions and 3 for statistics
+	for scanner.Scan() {
+		lineno++
+		line := bytes.TrimRight(scanner.Bytes(), " \t\r")
+		trimmed := bytes.TrimSpace(line)
+
+		switch {
+		case mode == 1 && hasPrefix(trimmed, "A "):
+			alphabet, err := readAlphabet(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("Error on line %d: %s", lineno, err)
+			}
+			p.Alphabet = alphabet
+			mode = 2
+			continue
+		case mode == 1:
+			continue
+		case mode == 2 && len(trimmed) == 0:
+			if len(p.Positions) > 0 {
+				mode = 3
+			}
+			continue
+		}
+
+		switch mode {
+		case 2:
+			pos, err := readPosition(p.Alphabet, line)
+			if err != nil {
+				return nil, fmt.Errorf("Error on line %d: %s", lineno, err)
+			}
+			if pos.num != len(p.Positions)+1 {
+				return nil, fmt.Errorf("Error on line %d: Expected position "+
+					"%d but got %d.", lineno, len(p.Positions)+1, pos.num)
+			}
+			p.Positions = append(p.Positions, pos.Position)
+		case 3:
+			if len(trimmed) == 0 || hasPrefix(trimmed, "K ") {
+				continue
+			}
+			stats, err := readStats(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("Error on line %d: %s", lineno, err)
+			}
+			p.Stats = append(p.Stats, stats)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading PSSM: %s", err)
+	}
+	if p.Alphabet == nil {
+		return nil, fmt.Errorf("Could not find the PSSM alphabet header.")
+	}
+	return p, nil
+}
+
+// readAlphabet reads the header line of a PSSM, which lists the alphabet
+// twice: once for the scores and once for the observed percentages.
+func readAlphabet(line []byte) (seq.Alphabet, error) {
+	fields := bytes.Fields(line)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("Invalid PSSM header '%s'.", line)
+	}
+	half := len(fields) / 2
+	alphabet := make(seq.Alphabet, half)
+	for i := 0; i < half; i++ {
+		if len(fields[i]) != 1 || !bytes.Equal(fields[i], fields[half+i]) {
+			return nil, fmt.Errorf("Invalid PSSM header '%s'.", line)
+		}
+		alphabet[i] = seq.Residue(fields[i][0])
+	}
+	return alphabet, nil
+}
+
+type numberedPosition struct {
+	Position
+	num int
+}
+
+func readPosition(alphabet seq.Alphabet, line []byte) (numberedPosition, error) {
+	pos := numberedPosition{}
+	scoresEnd := scoresStart + scoreWidth*len(alphabet)
+	if len(line) < scoresEnd {
+		return pos, fmt.Errorf("Position line '%s' is too short.", line)
+	}
+
+	head := bytes.Fields(line[0:scoresStart])
+	if len(head) != 2 || len(head[1]) != 1 {
+		return pos, fmt.Errorf("Invalid position and residue '%s'.",
+			line[0:scoresStart])
+	}
+	num, err := strconv.Atoi(string(head[0]))
+	if err != nil {
+		return pos, fmt.Errorf("Invalid position number '%s': %s", head[0], err)
+	}
+	pos.num = num
+	pos.Residue = seq.Residue(head[1][0])
+
+	// Scores may run into each other when they are large negative
+	// numbers, so we use the fixed width columns to read them.
+	pos.Scores = make([]int, len(alphabet))
+	for i := range alphabet {
+		start := scoresStart + i*scoreWidth
+		field := str(line[start : start+scoreWidth])
+		if pos.Scores[i], err = strconv.Atoi(field); err != nil {
+			return pos, fmt.Errorf("Invalid score '%s': %s", field, err)
+		}
+	}
+
+	rest := bytes.Fields(line[scoresEnd:])
+	if len(rest) != len(alphabet)+2 {
+		return pos, fmt.Errorf("Expected %d percentages followed by the "+
+			"information content and relative weight, but got %d fields.",
+			len(alphabet), len(rest))
+	}
+	pos.Observed = make([]int, len(alphabet))
+	for i := range alphabet {
+		if pos.Observed[i], err = strconv.Atoi(string(rest[i])); err != nil {
+			return pos, fmt.Errorf("Invalid percentage '%s': %s", rest[i], err)
+		}
+	}
+	if pos.Info, err = readFloat(rest[len(alphabet)]); err != nil {
+		return pos, err
+	}
+	if pos.RelWeight, err = readFloat(rest[len(alphabet)+1]); err != nil {
+		return pos, err
+	}
+	return pos, nil
+}
+
+// readStats reads a line of Karlin-Altschul parameters, which looks like
+// "PSI Ungapped         0.1360     0.3177".
+func readStats(line []byte) (Stats, error) {
+	fields := bytes.Fields(line)
+	if len(fields) < 3 {
+		return Stats{}, fmt.Errorf("Invalid statistics line '%s'.", line)
+	}
+	n := len(fields)
+	k, err := readFloat(fields[n-2])
+	if err != nil {
+		return Stats{}, err
+	}
+	lambda, err := readFloat(fields[n-1])
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{
+		Name:   string(bytes.Join(fields[0:n-2], []byte{' '})),
+		K:      k,
+		Lambda: lambda,
+	}, nil
+}
+
+func readFloat(bs []byte) (float64, error) {
+	f, err := strconv.ParseFloat(str(bs), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid number '%s': %s", bs, err)
+	}
+	return f, nil
+}
+
+func hasPrefix(bs []byte, prefix string) bool {
+	return bytes.HasPrefix(bs, []byte(prefix))
+}
+
+func str(bs []byte) string {
+	return string(bytes.TrimSpace(bs))
+}
@@ -0,0 +1,68 @@
+package pssm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Write writes a PSSM in the same ASCII format that PSI-BLAST uses with its
+// -out_ascii_pssm flag.
+//
+// An error is returned if the number of scores or percentages at any position
+// does not match the size of the PSSM's alphabet.
+func Write(w io.Writer, p *PSSM) error {
+	buf := bufio.NewWriter(w)
+	var err error
+	pf := func(format string, v ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(buf, format, v...)
+	}
+
+	pf("\nLast position-specific scoring matrix computed, weighted " +
+		"observed percentages rounded down, information per position, " +
+		"and relative weight of gapless real matches to pseudocounts\n")
+	pf("         ")
+	for _, r := range p.Alphabet {
+		pf("  %c", r)
+	}
+	for _, r := range p.Alphabet {
+		pf("   %c", r)
+	}
+	pf("\n")
+
+	for i, pos := range p.Positions {
+		if len(pos.Scores) != len(p.Alphabet) {
+			return fmt.Errorf("Position %d has %d scores, but the alphabet "+
+				"has %d residues.", i+1, len(pos.Scores), len(p.Alphabet))
+		}
+		if len(pos.Observed) != len(p.Alphabet) {
+			return fmt.Errorf("Position %d has %d percentages, but the "+
+				"alphabet has %d residues.",
+				i+1, len(pos.Observed), len(p.Alphabet))
+		}
+
+		pf("%5d %c  ", i+1, pos.Residue)
+		for _, score := range pos.Scores {
+			pf("%3d", score)
+		}
+		pf(" ")
+		for _, percent := range pos.Observed {
+			pf("%4d", percent)
+		}
+		pf("  %4.2f %4.2f\n", pos.Info, pos.RelWeight)
+	}
+
+	if len(p.Stats) > 0 {
+		pf("\n\n%23s%15s\n", "K", "Lambda")
+		for _, stats := range p.Stats {
+			pf("%-21s%6.4f%11.4f\n", stats.Name, stats.K, stats.Lambda)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,17 @@
+/*
+Package search provides a common interface for the hits of sequence and
+profile searches, so that the results of different tools can be ranked in the
+same way. It is implemented by hhr.Hit (hhsearch and hhblits), blast.Hit and
+the domains of HMMER's output (hmmer.Domain and hmmer.ReportDomain).
+
+Collections of hits can be sorted with By, filtered with Filter and the
+predicates MaxExpect, MinProbability and MinCoverage, and reduced to hits
+that cover different regions of the query with NonOverlapping. For example,
+to keep the most probable hits of an hhr file that cover at least half of the
+query without overlapping each other:
+
+	hits := search.Filter(results.SearchHits(), search.MinCoverage(qlen, 0.5))
+	search.ByProbability.Sort(hits)
+	hits = search.NonOverlapping(hits, 10)
+*/
+package search
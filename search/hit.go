@@ -0,0 +1,71 @@
+package search
+
+import (
+	"github.com/TuftsBCB/seq"
+)
+
+// Hit is a single hit of a query in a search: a target (a sequence or a
+// profile) that is aligned with a range of the query.
+//
+// Residue numbers of ranges start at 1 and are inclusive. The start of a
+// range is never greater than its end. A hit without an alignment has empty
+// ranges, which are 0-0.
+type Hit interface {
+	// TargetName is the name of the target that was hit.
+	TargetName() string
+
+	// Expect is the E-value of the hit.
+	Expect() float64
+
+	// BitScore is the score of the hit in bits.
+	BitScore() float64
+
+	// Probability is the probability that the hit is a true positive, from
+	// 0 to 1. It is -1 if the tool does not compute one.
+	Probability() float64
+
+	// QueryRange is the range of the query that is aligned with the target.
+	QueryRange() (start, end int)
+
+	// TargetRange is the range of the target that is aligned with the query.
+	TargetRange() (start, end int)
+
+	// Alignment is the aligned query and target sequences, which have the
+	// same length. Gaps are written as the tool writes them (e.g., '-', or
+	// '.' in a profile where the target has an insertion). Both are nil if
+	// the hit does not have an alignment.
+	Alignment() (query, target []seq.Residue)
+}
+
+// Coverage returns the fraction of a query with the given length that is
+// covered by the query range of a hit.
+func Coverage(hit Hit, queryLen int) float64 {
+	if queryLen <= 0 {
+		return 0
+	}
+	return float64(rangeLen(hit.QueryRange())) / float64(queryLen)
+}
+
+// Overlap returns the number of residues of the query that are in the query
+// ranges of both hits.
+func Overlap(hit1, hit2 Hit) int {
+	start1, end1 := hit1.QueryRange()
+	start2, end2 := hit2.QueryRange()
+	if rangeLen(start1, end1) == 0 || rangeLen(start2, end2) == 0 {
+		return 0
+	}
+	if start2 > start1 {
+		start1 = start2
+	}
+	if end2 < end1 {
+		end1 = end2
+	}
+	return rangeLen(start1, end1)
+}
+
+func rangeLen(start, end int) int {
+	if start < 1 || end < start {
+		return 0
+	}
+	return end - start + 1
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"sort"
+)
+
+// By is an order of hits, where less reports whether hit1 is better than
+// hit2.
+type By func(hit1, hit2 Hit) bool
+
+// The usual orders of hits, which put the best hits first.
+var (
+	ByExpect By = func(hit1, hit2 Hit) bool {
+		return hit1.Expect() < hit2.Expect()
+	}
+	ByBitScore By = func(hit1, hit2 Hit) bool {
+		return hit1.BitScore() > hit2.BitScore()
+	}
+	ByProbability By = func(hit1, hit2 Hit) bool {
+		return hit1.Probability() > hit2.Probability()
+	}
+)
+
+// Sort sorts hits in place. Hits that are equal keep their order.
+func (by By) Sort(hits []Hit) {
+	sort.Stable(byHits{hits, by})
+}
+
+type byHits struct {
+	hits []Hit
+	less By
+}
+
+func (bh byHits) Len() int           { return len(bh.hits) }
+func (bh byHits) Less(i, j int) bool { return bh.less(bh.hits[i], bh.hits[j]) }
+func (bh byHits) Swap(i, j int) {
+	bh.hits[i], bh.hits[j] = bh.hits[j], bh.hits[i]
+}
+
+// Predicate reports whether a hit should be kept by Filter.
+type Predicate func(hit Hit) bool
+
+// Filter returns the hits that satisfy every predicate, in order. The given
+// slice is not changed.
+func Filter(hits []Hit, keep ...Predicate) []Hit {
+	kept := make([]Hit, 0, len(hits))
+HITS:
+	for _, hit := range hits {
+		for _, pred := range keep {
+			if !pred(hit) {
+				continue HITS
+			}
+		}
+		kept = append(kept, hit)
+	}
+	return kept
+}
+
+// MaxExpect keeps hits with an E-value less than or equal to evalue.
+func MaxExpect(evalue float64) Predicate {
+	return func(hit Hit) bool {
+		return hit.Expect() <= evalue
+	}
+}
+
+// MinProbability keeps hits with a probability greater than or equal to
+// prob. Hits without a probability are not kept.
+func MinProbability(prob float64) Predicate {
+	return func(hit Hit) bool {
+		p := hit.Probability()
+		return p >= 0 && p >= prob
+	}
+}
+
+// MinCoverage keeps hits that cover at least the given fraction of a query
+// with length queryLen. (See Coverage.)
+func MinCoverage(queryLen int, fraction float64) Predicate {
+	return func(hit Hit) bool {
+		return Coverage(hit, queryLen) >= fraction
+	}
+}
+
+// NonOverlapping returns the hits that don't overlap a preceding hit that is
+// kept by more than maxOverlap residues of the query. Since earlier hits take
+// precedence, hits should be sorted first. The given slice is not changed.
+func NonOverlapping(hits []Hit, maxOverlap int) []Hit {
+	kept := make([]Hit, 0, len(hits))
+HITS:
+	for _, hit := range hits {
+		for _, other := range kept {
+			if Overlap(hit, other) > maxOverlap {
+				continue HITS
+			}
+		}
+		kept = append(kept, hit)
+	}
+	return kept
+}
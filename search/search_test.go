@@ -0,0 +1,202 @@
+package search_test
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/TuftsBCB/io/blast"
+	"github.com/TuftsBCB/io/hhr"
+	"github.com/TuftsBCB/io/hmmer"
+	"github.com/TuftsBCB/io/search"
+	"github.com/TuftsBCB/seq"
+)
+
+var (
+	_ search.Hit = hhr.Hit{}
+	_ search.Hit = blast.Hit{}
+	_ search.Hit = hmmer.Domain{}
+	_ search.Hit = hmmer.ReportDomain{}
+)
+
+func Example() {
+	f, err := os.Open("../hhr/yal001c.hhr")
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer f.Close()
+
+	results, err := hhr.Read(f)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	hits := search.Filter(results.SearchHits(), search.MinProbability(0.5))
+	search.ByBitScore.Sort(hits)
+	for _, hit := range search.NonOverlapping(hits, 10) {
+		start, end := hit.QueryRange()
+		fmt.Printf("%s %.1f %d-%d\n", hit.TargetName(), hit.BitScore(),
+			start, end)
+	}
+	// Output:
+	// 1p4xA 42.1 106-155
+	// 1xn7A 33.0 192-240
+}
+
+// hit is a search hit for testing.
+type hit struct {
+	name          string
+	evalue, score float64
+	prob          float64
+	qstart, qend  int
+}
+
+func (h hit) TargetName() string     { return h.name }
+func (h hit) Expect() float64        { return h.evalue }
+func (h hit) BitScore() float64      { return h.score }
+func (h hit) Probability() float64   { return h.prob }
+func (h hit) QueryRange() (int, int) { return h.qstart, h.qend }
+
+func (h hit) TargetRange() (int, int) {
+	return h.qstart, h.qend
+}
+
+func (h hit) Alignment() (query, target []seq.Residue) {
+	return nil, nil
+}
+
+func names(hits []search.Hit) string {
+	s := ""
+	for _, h := range hits {
+		s += h.TargetName()
+	}
+	return s
+}
+
+func testHits() []search.Hit {
+	return []search.Hit{
+		hit{"a", 1e-3, 30, 0.9, 1, 50},
+		hit{"b", 1e-9, 50, -1, 41, 90},
+		hit{"c", 1e-3, 20, 0.5, 0, 0},
+		hit{"d", 1.0, 10, 0.1, 60, 100},
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		by       search.By
+		expected string
+	}{
+		{search.ByExpect, "bacd"},
+		{search.ByBitScore, "bacd"},
+		{search.ByProbability, "acdb"},
+	}
+	for _, test := range tests {
+		hits := testHits()
+		test.by.Sort(hits)
+		if got := names(hits); got != test.expected {
+			t.Fatalf("Expected order '%s' but got '%s'.", test.expected, got)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		keep     []search.Predicate
+		expected string
+	}{
+		{nil, "abcd"},
+		{[]search.Predicate{search.MaxExpect(1e-3)}, "abc"},
+		{[]search.Predicate{search.MinProbability(0.5)}, "ac"},
+		{[]search.Predicate{search.MinProbability(0)}, "acd"},
+		{[]search.Predicate{search.MinCoverage(100, 0.5)}, "ab"},
+		{[]search.Predicate{
+			search.MaxExpect(1e-3), search.MinCoverage(100, 0.5),
+			search.MinProbability(0.5),
+		}, "a"},
+	}
+	for _, test := range tests {
+		hits := testHits()
+		got := names(search.Filter(hits, test.keep...))
+		if got != test.expected {
+			t.Fatalf("Expected hits '%s' but got '%s'.", test.expected, got)
+		}
+		if names(hits) != "abcd" {
+			t.Fatalf("Filter changed its input: '%s'.", names(hits))
+		}
+	}
+}
+
+func TestNonOverlapping(t *testing.T) {
+	hits := testHits()
+	if n := search.Overlap(hits[0], hits[1]); n != 10 {
+		t.Fatalf("Expected an overlap of 10 but got %d.", n)
+	}
+	if n := search.Overlap(hits[0], hits[2]); n != 0 {
+		t.Fatalf("Expected no overlap but got %d.", n)
+	}
+	if c := search.Coverage(hits[3], 100); c != 0.41 {
+		t.Fatalf("Expected a coverage of 0.41 but got %f.", c)
+	}
+
+	tests := []struct {
+		maxOverlap int
+		expected   string
+	}{
+		{0, "bc"},
+		{10, "bac"},
+		{31, "bacd"},
+	}
+	for _, test := range tests {
+		hits := testHits()
+		search.ByExpect.Sort(hits)
+		got := names(search.NonOverlapping(hits, test.maxOverlap))
+		if got != test.expected {
+			t.Fatalf("Expected hits '%s' with a maximum overlap of %d but "+
+				"got '%s'.", test.expected, test.maxOverlap, got)
+		}
+	}
+}
+
+func TestMixedHits(t *testing.T) {
+	fblast, err := os.Open("../blast/cdk1.xml")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer fblast.Close()
+	its, err := blast.NewXMLReader(fblast).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	fhmmer, err := os.Open("../hmmer/zf.out")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer fhmmer.Close()
+	rep, err := hmmer.ReadText(fhmmer)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	hits := append(its[0].SearchHits(), rep.SearchHits()...)
+	search.ByExpect.Sort(hits)
+	for i := 1; i < len(hits); i++ {
+		if hits[i].Expect() < hits[i-1].Expect() {
+			t.Fatalf("Hits are not sorted by E-value: %g < %g",
+				hits[i].Expect(), hits[i-1].Expect())
+		}
+	}
+	for _, hit := range hits {
+		query, target := hit.Alignment()
+		if len(query) == 0 || len(query) != len(target) {
+			t.Fatalf("%s: Expected aligned sequences of the same length "+
+				"but got '%s' and '%s'.", hit.TargetName(), query, target)
+		}
+		start, end := hit.QueryRange()
+		if start < 1 || end < start {
+			t.Fatalf("%s: Invalid query range %d-%d.",
+				hit.TargetName(), start, end)
+		}
+	}
+}